@@ -8,10 +8,9 @@ import (
 )
 
 // https://github.com/open-telemetry/opentelemetry-specification/tree/v1.16.0/specification/resource/semantic_conventions
-var ResourceNamespace = regexp.MustCompile(generateResourceNamespaceRegexp())
+var ResourceNamespace = regexp.MustCompile(generateResourceNamespaceRegexp(semconv.GetResourceSemanticConventionAttributeNames()))
 
-func generateResourceNamespaceRegexp() string {
-	semconvResourceAttributeNames := semconv.GetResourceSemanticConventionAttributeNames()
+func generateResourceNamespaceRegexp(semconvResourceAttributeNames []string) string {
 	components := make([]string, len(semconvResourceAttributeNames))
 	for i, attributeName := range semconvResourceAttributeNames {
 		components[i] = strings.ReplaceAll(attributeName, `.`, `\.`)
@@ -13,3 +13,61 @@ func TestResourceNamespace(t *testing.T) {
 	assert.True(t, ResourceNamespace.MatchString("faas.instance"))
 	assert.False(t, ResourceNamespace.MatchString("faas.execution"))
 }
+
+func TestResourceAttributeClassifier(t *testing.T) {
+	assert.True(t, DefaultResourceAttributeClassifier.IsResourceAttribute("service.name"))
+	assert.False(t, DefaultResourceAttributeClassifier.IsResourceAttribute("team"))
+
+	c, err := NewResourceAttributeClassifier(&ResourceAttributeClassifierConfig{
+		SemconvVersion:  "1.21.0",
+		IncludePatterns: []string{`^deployment\.region$`, `^team$`},
+		ExcludePatterns: []string{`^host\.id$`},
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, c.IsResourceAttribute("service.name"))
+		assert.True(t, c.IsResourceAttribute("deployment.region"))
+		assert.True(t, c.IsResourceAttribute("team"))
+		assert.False(t, c.IsResourceAttribute("host.id"))
+		assert.False(t, c.IsResourceAttribute("foo"))
+	}
+
+	_, err = NewResourceAttributeClassifier(&ResourceAttributeClassifierConfig{SemconvVersion: "0.0.1"})
+	assert.Error(t, err)
+	_, err = NewResourceAttributeClassifier(&ResourceAttributeClassifierConfig{IncludePatterns: []string{`(`}})
+	assert.Error(t, err)
+}
+
+func TestPrometheusUnits(t *testing.T) {
+	assert.Equal(t, "seconds", PrometheusUnitSuffix("s"))
+	assert.Equal(t, "bytes_per_second", PrometheusUnitSuffix("By/s"))
+	assert.Equal(t, "", PrometheusUnitSuffix("{requests}"))
+	assert.Equal(t, "", PrometheusUnitSuffix("1"))
+	assert.Equal(t, "", PrometheusUnitSuffix("By/{request}"))
+
+	unit, name := UnitFromPrometheusName("http_request_duration_seconds")
+	assert.Equal(t, "s", unit)
+	assert.Equal(t, "http_request_duration", name)
+	unit, name = UnitFromPrometheusName("network_io_bytes_per_second")
+	assert.Equal(t, "By/s", unit)
+	assert.Equal(t, "network_io", name)
+	unit, name = UnitFromPrometheusName("cpu_utilization_ratio")
+	assert.Equal(t, "1", unit)
+	assert.Equal(t, "cpu_utilization", name)
+	unit, name = UnitFromPrometheusName("seconds")
+	assert.Equal(t, "", unit)
+	assert.Equal(t, "seconds", name)
+	unit, name = UnitFromPrometheusName("http_requests")
+	assert.Equal(t, "", unit)
+	assert.Equal(t, "http_requests", name)
+}
+
+func TestHistogramQuantileFieldKey(t *testing.T) {
+	assert.Equal(t, "p50", HistogramQuantileFieldKey(0.5))
+	assert.Equal(t, "p99.9", HistogramQuantileFieldKey(0.999))
+	assert.True(t, IsHistogramQuantileFieldKey("p50"))
+	assert.True(t, IsHistogramQuantileFieldKey("p99.9"))
+	assert.False(t, IsHistogramQuantileFieldKey("p"))
+	assert.False(t, IsHistogramQuantileFieldKey("p101"))
+	assert.False(t, IsHistogramQuantileFieldKey("pInf"))
+	assert.False(t, IsHistogramQuantileFieldKey("count"))
+}
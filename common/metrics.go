@@ -1,5 +1,11 @@
 package common
 
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
 type InfluxMetricValueType uint8
 
 const (
@@ -54,3 +60,19 @@ var MetricsSchemata = map[string]MetricsSchema{
 	MetricsSchemaTelegrafPrometheusV2.String(): MetricsSchemaTelegrafPrometheusV2,
 	MetricsSchemaOtelV1.String():               MetricsSchemaOtelV1,
 }
+
+// HistogramQuantileFieldKey returns the field key, or field key suffix, of a quantile estimated from histogram buckets,
+// for example "p99" for 0.99 and "p99.9" for 0.999.
+func HistogramQuantileFieldKey(q float64) string {
+	return "p" + strconv.FormatFloat(math.Round(q*1e6)/1e4, 'f', -1, 64)
+}
+
+// IsHistogramQuantileFieldKey reports whether k has the form returned by HistogramQuantileFieldKey.
+func IsHistogramQuantileFieldKey(k string) bool {
+	percentile, found := strings.CutPrefix(k, "p")
+	if !found || percentile == "" || strings.Trim(percentile, "0123456789.") != "" {
+		return false
+	}
+	p, err := strconv.ParseFloat(percentile, 64)
+	return err == nil && p <= 100
+}
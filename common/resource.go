@@ -0,0 +1,128 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	semconv1_10_0 "go.opentelemetry.io/collector/semconv/v1.10.0"
+	semconv1_11_0 "go.opentelemetry.io/collector/semconv/v1.11.0"
+	semconv1_12_0 "go.opentelemetry.io/collector/semconv/v1.12.0"
+	semconv1_13_0 "go.opentelemetry.io/collector/semconv/v1.13.0"
+	semconv1_16_0 "go.opentelemetry.io/collector/semconv/v1.16.0"
+	semconv1_17_0 "go.opentelemetry.io/collector/semconv/v1.17.0"
+	semconv1_18_0 "go.opentelemetry.io/collector/semconv/v1.18.0"
+	semconv1_21_0 "go.opentelemetry.io/collector/semconv/v1.21.0"
+	semconv1_22_0 "go.opentelemetry.io/collector/semconv/v1.22.0"
+	semconv1_25_0 "go.opentelemetry.io/collector/semconv/v1.25.0"
+	semconv1_5_0 "go.opentelemetry.io/collector/semconv/v1.5.0"
+	semconv1_6_1 "go.opentelemetry.io/collector/semconv/v1.6.1"
+	semconv1_7_0 "go.opentelemetry.io/collector/semconv/v1.7.0"
+	semconv1_8_0 "go.opentelemetry.io/collector/semconv/v1.8.0"
+	semconv1_9_0 "go.opentelemetry.io/collector/semconv/v1.9.0"
+)
+
+// DefaultSemconvVersion is the semantic conventions version used to generate ResourceNamespace.
+const DefaultSemconvVersion = "1.16.0"
+
+var semconvResourceAttributeNames = map[string]func() []string{
+	"1.5.0":  semconv1_5_0.GetResourceSemanticConventionAttributeNames,
+	"1.6.1":  semconv1_6_1.GetResourceSemanticConventionAttributeNames,
+	"1.7.0":  semconv1_7_0.GetResourceSemanticConventionAttributeNames,
+	"1.8.0":  semconv1_8_0.GetResourceSemanticConventionAttributeNames,
+	"1.9.0":  semconv1_9_0.GetResourceSemanticConventionAttributeNames,
+	"1.10.0": semconv1_10_0.GetResourceSemanticConventionAttributeNames,
+	"1.11.0": semconv1_11_0.GetResourceSemanticConventionAttributeNames,
+	"1.12.0": semconv1_12_0.GetResourceSemanticConventionAttributeNames,
+	"1.13.0": semconv1_13_0.GetResourceSemanticConventionAttributeNames,
+	"1.16.0": semconv1_16_0.GetResourceSemanticConventionAttributeNames,
+	"1.17.0": semconv1_17_0.GetResourceSemanticConventionAttributeNames,
+	"1.18.0": semconv1_18_0.GetResourceSemanticConventionAttributeNames,
+	"1.21.0": semconv1_21_0.GetResourceSemanticConventionAttributeNames,
+	"1.22.0": semconv1_22_0.GetResourceSemanticConventionAttributeNames,
+	"1.25.0": semconv1_25_0.GetResourceSemanticConventionAttributeNames,
+}
+
+// SemconvVersions returns the semantic conventions versions accepted by NewResourceAttributeClassifier.
+func SemconvVersions() []string {
+	versions := make([]string, 0, len(semconvResourceAttributeNames))
+	for version := range semconvResourceAttributeNames {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// ResourceAttributeClassifierConfig configures a ResourceAttributeClassifier.
+type ResourceAttributeClassifierConfig struct {
+	// SemconvVersion selects the semantic conventions resource attribute namespaces, for example "1.21.0".
+	// The default is DefaultSemconvVersion.
+	SemconvVersion string
+	// IncludePatterns are regular expressions matching additional resource attribute keys,
+	// for example `^deployment\.region$` or `^team$`.
+	IncludePatterns []string
+	// ExcludePatterns are regular expressions matching keys that are never resource attributes.
+	// ExcludePatterns take precedence over IncludePatterns and semantic conventions.
+	ExcludePatterns []string
+}
+
+// ResourceAttributeClassifier decides which tags (or columns) are resource attributes,
+// as opposed to data point or span attributes.
+type ResourceAttributeClassifier struct {
+	namespace *regexp.Regexp
+	include   []*regexp.Regexp
+	exclude   []*regexp.Regexp
+}
+
+// DefaultResourceAttributeClassifier classifies keys by ResourceNamespace only.
+var DefaultResourceAttributeClassifier = &ResourceAttributeClassifier{namespace: ResourceNamespace}
+
+func NewResourceAttributeClassifier(config *ResourceAttributeClassifierConfig) (*ResourceAttributeClassifier, error) {
+	c := new(ResourceAttributeClassifier)
+
+	switch config.SemconvVersion {
+	case "", DefaultSemconvVersion:
+		c.namespace = ResourceNamespace
+	default:
+		names, found := semconvResourceAttributeNames[config.SemconvVersion]
+		if !found {
+			return nil, fmt.Errorf("unsupported semantic conventions version '%s'", config.SemconvVersion)
+		}
+		c.namespace = regexp.MustCompile(generateResourceNamespaceRegexp(names()))
+	}
+
+	for _, pattern := range config.IncludePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource attribute include pattern '%s': %w", pattern, err)
+		}
+		c.include = append(c.include, re)
+	}
+	for _, pattern := range config.ExcludePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource attribute exclude pattern '%s': %w", pattern, err)
+		}
+		c.exclude = append(c.exclude, re)
+	}
+
+	return c, nil
+}
+
+// IsResourceAttribute reports whether k is a resource attribute key.
+func (c *ResourceAttributeClassifier) IsResourceAttribute(k string) bool {
+	for _, re := range c.exclude {
+		if re.MatchString(k) {
+			return false
+		}
+	}
+	if c.namespace.MatchString(k) {
+		return true
+	}
+	for _, re := range c.include {
+		if re.MatchString(k) {
+			return true
+		}
+	}
+	return false
+}
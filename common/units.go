@@ -0,0 +1,122 @@
+package common
+
+import (
+	"strings"
+)
+
+// Prometheus metric name suffixes and the corresponding UCUM units, per the
+// OpenTelemetry-Prometheus compatibility specification.
+// https://github.com/open-telemetry/opentelemetry-specification/blob/v1.33.0/specification/compatibility/prometheus_and_openmetrics.md#metric-metadata-1
+
+const (
+	MetricCounterSuffix = "_total"
+	MetricRatioSuffix   = "_ratio"
+)
+
+var prometheusUnitByUCUM = map[string]string{
+	// time
+	"d":   "days",
+	"h":   "hours",
+	"min": "minutes",
+	"s":   "seconds",
+	"ms":  "milliseconds",
+	"us":  "microseconds",
+	"ns":  "nanoseconds",
+
+	// bytes
+	"By":   "bytes",
+	"KiBy": "kibibytes",
+	"MiBy": "mebibytes",
+	"GiBy": "gibibytes",
+	"TiBy": "tibibytes",
+	"KBy":  "kilobytes",
+	"MBy":  "megabytes",
+	"GBy":  "gigabytes",
+	"TBy":  "terabytes",
+
+	// SI
+	"m":   "meters",
+	"V":   "volts",
+	"A":   "amperes",
+	"J":   "joules",
+	"W":   "watts",
+	"g":   "grams",
+	"Cel": "celsius",
+	"Hz":  "hertz",
+	"%":   "percent",
+}
+
+var prometheusPerUnitByUCUM = map[string]string{
+	"s":  "second",
+	"m":  "minute",
+	"h":  "hour",
+	"d":  "day",
+	"w":  "week",
+	"mo": "month",
+	"y":  "year",
+}
+
+var (
+	ucumByPrometheusUnit    = invertStringMap(prometheusUnitByUCUM)
+	ucumByPrometheusPerUnit = invertStringMap(prometheusPerUnitByUCUM)
+)
+
+func invertStringMap(m map[string]string) map[string]string {
+	inverted := make(map[string]string, len(m))
+	for k, v := range m {
+		inverted[v] = k
+	}
+	return inverted
+}
+
+// PrometheusUnitSuffix returns the Prometheus metric name suffix for a UCUM unit, without leading underscore,
+// for example "seconds" for "s" and "bytes_per_second" for "By/s".
+// Annotations in curly braces are ignored. Returns "" for units without a Prometheus equivalent,
+// including "1"; see MetricRatioSuffix.
+func PrometheusUnitSuffix(unit string) string {
+	if i := strings.IndexByte(unit, '{'); i >= 0 {
+		unit = unit[:i]
+	}
+	unit = strings.TrimSpace(unit)
+	if unit == "" || unit == "1" {
+		return ""
+	}
+
+	mainUnit, perUnit, hasPerUnit := strings.Cut(unit, "/")
+	suffix, found := prometheusUnitByUCUM[mainUnit]
+	if !found {
+		return ""
+	}
+	if !hasPerUnit {
+		return suffix
+	}
+	perSuffix, found := prometheusPerUnitByUCUM[perUnit]
+	if !found {
+		return ""
+	}
+	return suffix + "_per_" + perSuffix
+}
+
+// UnitFromPrometheusName infers the UCUM unit from the suffix of a Prometheus metric name.
+// The name should not end with MetricCounterSuffix.
+// Returns the unit and the name without the unit suffix, or empty unit and the unchanged name.
+func UnitFromPrometheusName(name string) (string, string) {
+	if strings.HasSuffix(name, MetricRatioSuffix) && len(name) > len(MetricRatioSuffix) {
+		return "1", strings.TrimSuffix(name, MetricRatioSuffix)
+	}
+
+	parts := strings.Split(name, "_")
+	if len(parts) >= 4 && parts[len(parts)-2] == "per" {
+		unit, foundUnit := ucumByPrometheusUnit[parts[len(parts)-3]]
+		perUnit, foundPerUnit := ucumByPrometheusPerUnit[parts[len(parts)-1]]
+		if foundUnit && foundPerUnit {
+			return unit + "/" + perUnit, strings.Join(parts[:len(parts)-3], "_")
+		}
+	}
+	if len(parts) >= 2 {
+		if unit, found := ucumByPrometheusUnit[parts[len(parts)-1]]; found {
+			return unit, strings.Join(parts[:len(parts)-1], "_")
+		}
+	}
+	return "", name
+}
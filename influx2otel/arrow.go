@@ -0,0 +1,140 @@
+package influx2otel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// InfluxDB 3 annotates each column of a query result schema with its InfluxDB column type.
+const (
+	arrowColumnTypeMetadataKey = "iox::column::type"
+	arrowColumnTypeTag         = "iox::column_type::tag"
+	arrowColumnTypeTimestamp   = "iox::column_type::timestamp"
+)
+
+type arrowColumnKind uint8
+
+const (
+	arrowColumnField arrowColumnKind = iota
+	arrowColumnTag
+	arrowColumnTime
+)
+
+// arrowColumnKinds classifies the columns of a record as tags, fields, or the time column.
+// The InfluxDB column type metadata is used if present;
+// otherwise dictionary-encoded string columns are tags, and the timestamp column named time is the time column.
+func arrowColumnKinds(schema *arrow.Schema) ([]arrowColumnKind, error) {
+	kinds := make([]arrowColumnKind, schema.NumFields())
+	foundTime := false
+	for i, field := range schema.Fields() {
+		if columnType, found := field.Metadata.GetValue(arrowColumnTypeMetadataKey); found {
+			switch columnType {
+			case arrowColumnTypeTag:
+				kinds[i] = arrowColumnTag
+			case arrowColumnTypeTimestamp:
+				kinds[i] = arrowColumnTime
+			default:
+				kinds[i] = arrowColumnField
+			}
+		} else if dictionaryType, ok := field.Type.(*arrow.DictionaryType); ok && isArrowStringType(dictionaryType.ValueType) {
+			kinds[i] = arrowColumnTag
+		} else if field.Type.ID() == arrow.TIMESTAMP && field.Name == common.AttributeTime {
+			kinds[i] = arrowColumnTime
+		} else {
+			kinds[i] = arrowColumnField
+		}
+		if kinds[i] == arrowColumnTime {
+			if foundTime {
+				return nil, fmt.Errorf("record has more than one time column")
+			}
+			if field.Type.ID() != arrow.TIMESTAMP {
+				return nil, fmt.Errorf("time column '%s' has type %s", field.Name, field.Type)
+			}
+			foundTime = true
+		}
+	}
+	if !foundTime {
+		return nil, fmt.Errorf("record has no time column")
+	}
+	return kinds, nil
+}
+
+func isArrowStringType(dataType arrow.DataType) bool {
+	switch dataType.ID() {
+	case arrow.STRING, arrow.LARGE_STRING, arrow.STRING_VIEW:
+		return true
+	default:
+		return false
+	}
+}
+
+// arrowTime returns the timestamp at row i of a timestamp column.
+func arrowTime(column arrow.Array, i int) (time.Time, bool) {
+	timestamps, ok := column.(*array.Timestamp)
+	if !ok || timestamps.IsNull(i) {
+		return time.Time{}, false
+	}
+	unit := timestamps.DataType().(*arrow.TimestampType).Unit
+	return timestamps.Value(i).ToTime(unit), true
+}
+
+// arrowValue returns the value at row i of a column as a line protocol field value:
+// float64, int64, uint64, bool or string.
+// Returns false if the value is null or the column type has no line protocol equivalent.
+func arrowValue(column arrow.Array, i int) (interface{}, bool) {
+	if column.IsNull(i) {
+		return nil, false
+	}
+	switch column := column.(type) {
+	case *array.Float64:
+		return column.Value(i), true
+	case *array.Float32:
+		return float64(column.Value(i)), true
+	case *array.Int64:
+		return column.Value(i), true
+	case *array.Int32:
+		return int64(column.Value(i)), true
+	case *array.Int16:
+		return int64(column.Value(i)), true
+	case *array.Int8:
+		return int64(column.Value(i)), true
+	case *array.Uint64:
+		return column.Value(i), true
+	case *array.Uint32:
+		return uint64(column.Value(i)), true
+	case *array.Uint16:
+		return uint64(column.Value(i)), true
+	case *array.Uint8:
+		return uint64(column.Value(i)), true
+	case *array.Boolean:
+		return column.Value(i), true
+	case *array.String:
+		return column.Value(i), true
+	case *array.LargeString:
+		return column.Value(i), true
+	case *array.StringView:
+		return column.Value(i), true
+	case *array.Timestamp:
+		t, _ := arrowTime(column, i)
+		return t.UnixNano(), true
+	case *array.Dictionary:
+		return arrowValue(column.Dictionary(), column.GetValueIndex(i))
+	default:
+		return nil, false
+	}
+}
+
+// arrowString returns the value at row i of a string column.
+func arrowString(column arrow.Array, i int) (string, bool) {
+	v, ok := arrowValue(column, i)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
@@ -3,54 +3,381 @@ package influx2otel
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"math"
+	"slices"
 	"sort"
 	"time"
 
 	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
 
 	"github.com/influxdata/influxdb-observability/common"
 )
 
+type LineProtocolToOtelMetricsConfig struct {
+	Logger common.Logger
+	// StatsdTiming selects how points tagged metric_type=timing,
+	// as written by the Telegraf statsd input plugin, are converted.
+	StatsdTiming StatsdTimingConversion
+	// ResourceAttributes decides which tags are resource attributes;
+	// all other tags, except instrumentation scope tags, become data point attributes.
+	ResourceAttributes *common.ResourceAttributeClassifier
+	// BoolFields selects how boolean field values are converted.
+	BoolFields BoolFieldConversion
+	// StringFields selects how string field values are converted.
+	StringFields StringFieldConversion
+	// StringOnlyPointsAsLogs converts points having only string fields to log records,
+	// which are retrieved with MetricsBatch.GetLogs.
+	StringOnlyPointsAsLogs bool
+	// TelegrafMappings converts untyped points from Telegraf input plugins to
+	// OpenTelemetry semantic convention metrics. See DefaultTelegrafMappings.
+	// If nil, no mapping is applied.
+	TelegrafMappings TelegrafMappings
+	// PrometheusV2MergeWindow merges Prometheus v2 histogram and summary lines
+	// (one line per bucket or quantile, plus one line for count and sum)
+	// whose timestamps differ by up to this duration into one data point,
+	// which keeps the timestamp of the first line.
+	// Zero merges lines with equal timestamps only.
+	// With a positive window, merged histograms that lack the count and sum line, or whose cumulative bucket counts
+	// decrease or do not match the count, are dropped and counted by MetricsBatch.IncompleteHistogramCount.
+	// With zero, histograms are emitted as they are, since the lines of one histogram may be split across batches.
+	PrometheusV2MergeWindow time.Duration
+	// Cumulative selects stateful handling of cumulative sums and histograms,
+	// tracking each series across all batches of the converter.
+	Cumulative CumulativeConversion
+	// CumulativeSeriesTTL is how long the state of a series is kept after its last observation,
+	// when Cumulative is not CumulativeAsIs. Zero keeps series state forever.
+	CumulativeSeriesTTL time.Duration
+	// InferUnitFromName sets the unit of metrics named with a Prometheus unit suffix,
+	// such as _seconds, _bytes or _ratio, per the OpenTelemetry-Prometheus compatibility specification.
+	// Sums named with the _total suffix are monotonic.
+	InferUnitFromName bool
+	// TrimNameSuffixes removes the unit suffix, and the _total suffix of sums, from metric names
+	// when InferUnitFromName is set.
+	// Names are not trimmed where the trimmed name would collide with another metric in the same scope.
+	TrimNameSuffixes bool
+	// AmbiguousDistributions selects whether untyped Telegraf Prometheus points that
+	// could be either histograms or summaries are converted to histograms or to summaries.
+	AmbiguousDistributions DistributionConversion
+	// AnnotatedCSVMaxBufferedPoints limits the points that MetricsBatch.AddAnnotatedCSV holds while it pivots rows.
+	// When the limit is reached, the buffered points are added to the batch, which flushes a streaming batch,
+	// before more input is read. Zero, the default, means no limit.
+	// Flux returns one table per field, so a limit can split the fields of one point into several points,
+	// unless the input is pivoted.
+	AnnotatedCSVMaxBufferedPoints int
+}
+
+func DefaultLineProtocolToOtelMetricsConfig() *LineProtocolToOtelMetricsConfig {
+	return &LineProtocolToOtelMetricsConfig{
+		Logger:              new(common.NoopLogger),
+		StatsdTiming:        StatsdTimingAsSummary,
+		ResourceAttributes:  common.DefaultResourceAttributeClassifier,
+		BoolFields:          BoolFieldsDrop,
+		StringFields:        StringFieldsDrop,
+		Cumulative:          CumulativeAsIs,
+		CumulativeSeriesTTL: 15 * time.Minute,
+	}
+}
+
 type LineProtocolToOtelMetrics struct {
-	logger common.Logger
+	logger                 common.Logger
+	statsdTiming           StatsdTimingConversion
+	resourceAttributes     *common.ResourceAttributeClassifier
+	boolFields             BoolFieldConversion
+	stringFields           StringFieldConversion
+	stringOnlyPointsAsLogs bool
+	telegrafMappings       TelegrafMappings
+	mergeWindowV2          time.Duration
+	cumulativeTracker      *cumulativeTracker
+	inferUnitFromName      bool
+	trimNameSuffixes       bool
+	ambiguousDistributions DistributionConversion
+	maxCSVBufferedPoints   int
 }
 
 func NewLineProtocolToOtelMetrics(logger common.Logger) (*LineProtocolToOtelMetrics, error) {
+	config := DefaultLineProtocolToOtelMetricsConfig()
+	config.Logger = logger
+	return NewLineProtocolToOtelMetricsWithConfig(config)
+}
+
+func NewLineProtocolToOtelMetricsWithConfig(config *LineProtocolToOtelMetricsConfig) (*LineProtocolToOtelMetrics, error) {
+	switch config.StatsdTiming {
+	case StatsdTimingAsSummary, StatsdTimingAsHistogram, StatsdTimingAsGauges:
+	default:
+		return nil, fmt.Errorf("unrecognized statsd timing conversion %d", config.StatsdTiming)
+	}
+	switch config.BoolFields {
+	case BoolFieldsDrop, BoolFieldsAsGauge:
+	default:
+		return nil, fmt.Errorf("unrecognized bool field conversion %d", config.BoolFields)
+	}
+	switch config.StringFields {
+	case StringFieldsDrop, StringFieldsAsAttributes, StringFieldsAsInfoGauge:
+	default:
+		return nil, fmt.Errorf("unrecognized string field conversion %d", config.StringFields)
+	}
+	if err := validateTelegrafMappings(config.TelegrafMappings); err != nil {
+		return nil, err
+	}
+	switch config.AmbiguousDistributions {
+	case DistributionsAsHistogram, DistributionsAsSummary:
+	default:
+		return nil, fmt.Errorf("unrecognized distribution conversion %d", config.AmbiguousDistributions)
+	}
+	if config.PrometheusV2MergeWindow < 0 {
+		return nil, fmt.Errorf("negative Prometheus v2 merge window %s", config.PrometheusV2MergeWindow)
+	}
+	if config.AnnotatedCSVMaxBufferedPoints < 0 {
+		return nil, fmt.Errorf("negative annotated CSV max buffered points %d", config.AnnotatedCSVMaxBufferedPoints)
+	}
+	var tracker *cumulativeTracker
+	switch config.Cumulative {
+	case CumulativeAsIs:
+	case CumulativeInferStartTime, CumulativeToDelta:
+		if config.CumulativeSeriesTTL < 0 {
+			return nil, fmt.Errorf("negative cumulative series TTL %s", config.CumulativeSeriesTTL)
+		}
+		tracker = newCumulativeTracker(config.Cumulative, config.CumulativeSeriesTTL)
+	default:
+		return nil, fmt.Errorf("unrecognized cumulative conversion %d", config.Cumulative)
+	}
+	resourceAttributes := config.ResourceAttributes
+	if resourceAttributes == nil {
+		resourceAttributes = common.DefaultResourceAttributeClassifier
+	}
 	return &LineProtocolToOtelMetrics{
-		logger: logger,
+		logger:                 config.Logger,
+		statsdTiming:           config.StatsdTiming,
+		resourceAttributes:     resourceAttributes,
+		boolFields:             config.BoolFields,
+		stringFields:           config.StringFields,
+		stringOnlyPointsAsLogs: config.StringOnlyPointsAsLogs,
+		telegrafMappings:       config.TelegrafMappings,
+		mergeWindowV2:          config.PrometheusV2MergeWindow,
+		cumulativeTracker:      tracker,
+		inferUnitFromName:      config.InferUnitFromName,
+		trimNameSuffixes:       config.TrimNameSuffixes,
+		ambiguousDistributions: config.AmbiguousDistributions,
+		maxCSVBufferedPoints:   config.AnnotatedCSVMaxBufferedPoints,
 	}, nil
 }
 
 func (c *LineProtocolToOtelMetrics) NewBatch() *MetricsBatch {
-	return &MetricsBatch{
-		rmByAttributes:            make(map[[16]byte]pmetric.ResourceMetrics),
-		ilmByRMAttributesAndIL:    make(map[[16]byte]map[string]pmetric.ScopeMetrics),
-		metricByRMIL:              make(map[[16]byte]map[string]map[string]pmetric.Metric),
-		histogramDataPointsByMDPK: make(map[pmetric.Metric]map[dataPointKey]pmetric.HistogramDataPoint),
-		summaryDataPointsByMDPK:   make(map[pmetric.Metric]map[dataPointKey]pmetric.SummaryDataPoint),
+	b := &MetricsBatch{
+		logger:                 c.logger,
+		statsdTiming:           c.statsdTiming,
+		resourceAttributes:     c.resourceAttributes,
+		boolFields:             c.boolFields,
+		stringFields:           c.stringFields,
+		stringOnlyPointsAsLogs: c.stringOnlyPointsAsLogs,
+		telegrafMappings:       c.telegrafMappings,
+		mergeWindowV2:          c.mergeWindowV2,
+		cumulativeTracker:      c.cumulativeTracker,
+		inferUnitFromName:      c.inferUnitFromName,
+		trimNameSuffixes:       c.trimNameSuffixes,
+		ambiguousDistributions: c.ambiguousDistributions,
+		maxCSVBufferedPoints:   c.maxCSVBufferedPoints,
+	}
+	b.Reset()
+	return b
+}
 
-		logger: c.logger,
+// MetricsFlushFunc receives the metrics emitted by a streaming MetricsBatch.
+// The batch does not retain the metrics after the call returns nil.
+// If the call returns an error, the batch retains the metrics and passes them again on the next flush.
+type MetricsFlushFunc func(pmetric.Metrics) error
+
+// NewStreamingBatch returns a MetricsBatch that passes its metrics to flush
+// whenever maxDataPoints data points have accumulated.
+// Call Flush after the last point to emit the remainder.
+//
+// A full batch is flushed before the next point is added, unless that point is another line
+// of the Prometheus v2 histogram or summary data point that the previous point belongs to;
+// the lines of such a data point must therefore be consecutive to be kept in one flush.
+// Exemplars are attached to the data points of the current batch only.
+func (c *LineProtocolToOtelMetrics) NewStreamingBatch(maxDataPoints int, flush MetricsFlushFunc) (*MetricsBatch, error) {
+	if maxDataPoints < 1 {
+		return nil, fmt.Errorf("max data points must be positive, got %d", maxDataPoints)
 	}
+	if flush == nil {
+		return nil, errors.New("flush func is nil")
+	}
+	b := c.NewBatch()
+	b.maxDataPoints = maxDataPoints
+	b.flush = flush
+	return b, nil
 }
 
 type MetricsBatch struct {
+	metrics                   pmetric.Metrics
+	dataPointCount            int
+	lastPointTime             time.Time
+	lastMultiLinePointKeyV2   string
 	rmByAttributes            map[[16]byte]pmetric.ResourceMetrics
 	ilmByRMAttributesAndIL    map[[16]byte]map[string]pmetric.ScopeMetrics
 	metricByRMIL              map[[16]byte]map[string]map[string]pmetric.Metric
-	histogramDataPointsByMDPK map[pmetric.Metric]map[dataPointKey]pmetric.HistogramDataPoint
+	histogramDataPointsByMDPK map[pmetric.Metric]map[dataPointKey]*histogramDataPointV2
 	summaryDataPointsByMDPK   map[pmetric.Metric]map[dataPointKey]pmetric.SummaryDataPoint
+	histogramDataPointsV2     []*histogramDataPointV2
+	incompleteHistogramCount  int
+	dataPointTimeByMA         map[pmetric.Metric]map[[16]byte]time.Time
+	distributionTypeByNameV2  map[string]common.InfluxMetricValueType
+	exemplars                 []exemplar
+	logs                      plog.Logs
+	rlByAttributes            map[[16]byte]plog.ResourceLogs
+	slByRLAttributesAndIL     map[[16]byte]map[string]plog.ScopeLogs
+
+	maxDataPoints int
+	flush         MetricsFlushFunc
+	unflushed     *pmetric.Metrics
+
+	logger                 common.Logger
+	statsdTiming           StatsdTimingConversion
+	resourceAttributes     *common.ResourceAttributeClassifier
+	boolFields             BoolFieldConversion
+	stringFields           StringFieldConversion
+	stringOnlyPointsAsLogs bool
+	telegrafMappings       TelegrafMappings
+	mergeWindowV2          time.Duration
+	cumulativeTracker      *cumulativeTracker
+	inferUnitFromName      bool
+	trimNameSuffixes       bool
+	ambiguousDistributions DistributionConversion
+	maxCSVBufferedPoints   int
+}
+
+// Reset discards all points added to the batch, so that the batch can be reused.
+// Metrics retained after a failed flush are discarded too.
+func (b *MetricsBatch) Reset() {
+	b.resetMetrics()
+	b.unflushed = nil
+	b.incompleteHistogramCount = 0
+	b.exemplars = b.exemplars[:0]
+	b.resetLogs()
+}
+
+func (b *MetricsBatch) resetMetrics() {
+	b.metrics = pmetric.NewMetrics()
+	b.dataPointCount = 0
+	b.rmByAttributes = make(map[[16]byte]pmetric.ResourceMetrics)
+	b.ilmByRMAttributesAndIL = make(map[[16]byte]map[string]pmetric.ScopeMetrics)
+	b.metricByRMIL = make(map[[16]byte]map[string]map[string]pmetric.Metric)
+	b.histogramDataPointsByMDPK = make(map[pmetric.Metric]map[dataPointKey]*histogramDataPointV2)
+	b.summaryDataPointsByMDPK = make(map[pmetric.Metric]map[dataPointKey]pmetric.SummaryDataPoint)
+	b.histogramDataPointsV2 = nil
+	b.dataPointTimeByMA = make(map[pmetric.Metric]map[[16]byte]time.Time)
+	b.distributionTypeByNameV2 = make(map[string]common.InfluxMetricValueType)
+}
+
+func (b *MetricsBatch) resetLogs() {
+	b.logs = plog.NewLogs()
+	b.rlByAttributes = make(map[[16]byte]plog.ResourceLogs)
+	b.slByRLAttributesAndIL = make(map[[16]byte]map[string]plog.ScopeLogs)
+}
+
+// DataPointCount returns the number of data points in the batch.
+func (b *MetricsBatch) DataPointCount() int {
+	return b.dataPointCount
+}
 
-	logger common.Logger
+// IncompleteHistogramCount returns the number of Prometheus v2 histogram data points
+// dropped as incomplete since the batch was created or reset; see PrometheusV2MergeWindow.
+func (b *MetricsBatch) IncompleteHistogramCount() int {
+	return b.incompleteHistogramCount
+}
+
+// Flush passes the metrics in a streaming batch to its flush func, then empties the batch.
+// Metrics retained after a previous failed flush are passed first.
+// If the flush func returns an error, the metrics are retained and Flush may be called again.
+// It does nothing if the batch is empty.
+func (b *MetricsBatch) Flush() error {
+	if b.flush == nil {
+		return errors.New("batch is not a streaming batch")
+	}
+	for {
+		if b.unflushed != nil {
+			if err := b.flush(*b.unflushed); err != nil {
+				return err
+			}
+			b.unflushed = nil
+		}
+		if b.dataPointCount == 0 {
+			return nil
+		}
+		metrics := b.GetMetrics()
+		b.unflushed = &metrics
+	}
+}
+
+func (b *MetricsBatch) appendNumberDataPoint(dataPoints pmetric.NumberDataPointSlice) pmetric.NumberDataPoint {
+	b.dataPointCount++
+	return dataPoints.AppendEmpty()
+}
+
+func (b *MetricsBatch) appendHistogramDataPoint(dataPoints pmetric.HistogramDataPointSlice) pmetric.HistogramDataPoint {
+	b.dataPointCount++
+	return dataPoints.AppendEmpty()
+}
+
+func (b *MetricsBatch) appendSummaryDataPoint(dataPoints pmetric.SummaryDataPointSlice) pmetric.SummaryDataPoint {
+	b.dataPointCount++
+	return dataPoints.AppendEmpty()
+}
+
+// flushIfFull flushes a full streaming batch before the point is added,
+// unless the point continues the Prometheus v2 histogram or summary data point of the previous point.
+func (b *MetricsBatch) flushIfFull(measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	if b.flush == nil {
+		return nil
+	}
+	var key string
+	if measurement == common.MeasurementPrometheus {
+		key, _ = multiLinePointKeyV2(tags, fields)
+	}
+	continuesPoint := key != "" && key == b.lastMultiLinePointKeyV2
+	if continuesPoint {
+		if d := ts.Sub(b.lastPointTime); d > b.mergeWindowV2 || d < -b.mergeWindowV2 {
+			continuesPoint = false
+		}
+	}
+	if !continuesPoint && (b.unflushed != nil || b.dataPointCount >= b.maxDataPoints) {
+		if err := b.Flush(); err != nil {
+			return err
+		}
+	}
+	b.lastMultiLinePointKeyV2 = key
+	return nil
 }
 
 // measurement - metric name
 func (b *MetricsBatch) AddPoint(measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time, vType common.InfluxMetricValueType) error {
+	if err := b.flushIfFull(measurement, tags, fields, ts); err != nil {
+		return err
+	}
+	b.lastPointTime = ts
+
+	if isExemplarPoint(measurement, tags) {
+		return b.addExemplar(measurement, tags, fields, ts)
+	}
+
+	tags, fields, handled, err := b.convertNonNumericFields(measurement, tags, fields, ts)
+	if err != nil || handled {
+		return err
+	}
+
+	if vType == common.InfluxMetricValueTypeUntyped {
+		if mapping, found := b.telegrafMappings[measurement]; found {
+			return b.addPointWithTelegrafMapping(mapping, measurement, tags, fields, ts)
+		}
+	}
+
 	if measurement == common.MeasurementPrometheus {
-		err := b.addPointTelegrafPrometheusV2(measurement, tags, fields, ts, vType)
+		err = b.addPointTelegrafPrometheusV2(measurement, tags, fields, ts, vType)
 		if err == errValueTypeUnknown {
 			return b.addPointWithUnknownSchema(measurement, tags, fields, ts)
 		} else {
@@ -59,12 +386,12 @@ func (b *MetricsBatch) AddPoint(measurement string, tags map[string]string, fiel
 	}
 
 	if mt, ok := tags["metric_type"]; ok {
-		if mt == "timing" {
-			return b.addPointWithUnknownSchema(measurement, tags, fields, ts)
+		if mt == statsdMetricTypeTiming {
+			return b.addPointStatsdTiming(measurement, tags, fields, ts)
 		}
 	}
 
-	err := b.addPointTelegrafPrometheusV1(measurement, tags, fields, ts, vType)
+	err = b.addPointTelegrafPrometheusV1(measurement, tags, fields, ts, vType)
 	if err == errValueTypeUnknown {
 		return b.addPointWithUnknownSchema(measurement, tags, fields, ts)
 	} else {
@@ -80,7 +407,8 @@ func (b *MetricsBatch) lookupMetric(metricName string, tags map[string]string, v
 	mAttributes := pcommon.NewMap()
 
 	var isDelta bool
-	for k, v := range tags {
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
 		switch {
 		case k == common.MetricHistogramBoundKeyV2 || k == common.MetricSummaryQuantileKeyV2:
 			continue
@@ -88,7 +416,7 @@ func (b *MetricsBatch) lookupMetric(metricName string, tags map[string]string, v
 			ilName = v
 		case k == semconv.OtelLibraryVersion:
 			ilVersion = v
-		case common.ResourceNamespace.MatchString(k):
+		case b.resourceAttributes.IsResourceAttribute(k):
 			rAttributes.PutStr(k, v)
 		case k == "temporality" && v == "delta":
 			isDelta = true
@@ -103,7 +431,7 @@ func (b *MetricsBatch) lookupMetric(metricName string, tags map[string]string, v
 	if rm, found := b.rmByAttributes[rKey]; found {
 		resourceMetrics = rm
 	} else {
-		resourceMetrics = pmetric.NewResourceMetrics()
+		resourceMetrics = b.metrics.ResourceMetrics().AppendEmpty()
 		rAttributes.CopyTo(resourceMetrics.Resource().Attributes())
 		b.rmByAttributes[rKey] = resourceMetrics
 		b.ilmByRMAttributesAndIL[rKey] = make(map[string]pmetric.ScopeMetrics)
@@ -135,6 +463,15 @@ func (b *MetricsBatch) lookupMetric(metricName string, tags map[string]string, v
 				return pmetric.Metric{}, pcommon.Map{}, fmt.Errorf("value type conflict for metric '%s'; expected '%s', got '%s'", metricName, common.InfluxMetricValueTypeHistogram, vType)
 			}
 		case pmetric.MetricTypeSummary:
+			if vType == common.InfluxMetricValueTypeHistogram && b.ambiguousDistributions == DistributionsAsSummary {
+				temporality := pmetric.AggregationTemporalityCumulative
+				if isDelta {
+					temporality = pmetric.AggregationTemporalityDelta
+				}
+				if b.convertSummaryToHistogram(m, temporality) {
+					break
+				}
+			}
 			if vType != common.InfluxMetricValueTypeSummary {
 				return pmetric.Metric{}, pcommon.Map{}, fmt.Errorf("value type conflict for metric '%s'; expected '%s', got '%s'", metricName, common.InfluxMetricValueTypeSummary, vType)
 			}
@@ -170,30 +507,40 @@ func (b *MetricsBatch) lookupMetric(metricName string, tags map[string]string, v
 			return pmetric.Metric{}, pcommon.Map{}, fmt.Errorf("unrecognized InfluxMetricValueType %d", vType)
 		}
 		b.metricByRMIL[rKey][ilmKey][metricName] = metric
-		b.histogramDataPointsByMDPK[metric] = make(map[dataPointKey]pmetric.HistogramDataPoint)
+		b.histogramDataPointsByMDPK[metric] = make(map[dataPointKey]*histogramDataPointV2)
 		b.summaryDataPointsByMDPK[metric] = make(map[dataPointKey]pmetric.SummaryDataPoint)
 	}
 
 	return metric, mAttributes, nil
 }
 
+// GetMetrics returns the metrics in the batch and empties the batch of metrics.
+// Log records are retained until GetLogs is called.
+//
+// Output order is deterministic: resources, scopes, metrics and data points appear in the order
+// they were first added, the fields of each point are converted in key order,
+// and attributes are added in key order.
 func (b *MetricsBatch) GetMetrics() pmetric.Metrics {
-	metrics := pmetric.NewMetrics()
+	b.attachExemplars()
+	if b.mergeWindowV2 > 0 {
+		b.validateHistogramsV2()
+	}
 	// Ensure that infinity histogram buckets exist.
-	for _, resourceMetrics := range b.rmByAttributes {
-		for i := 0; i < resourceMetrics.ScopeMetrics().Len(); i++ {
-			isMetrics := resourceMetrics.ScopeMetrics().At(i)
-			for j := 0; j < isMetrics.Metrics().Len(); j++ {
-				metric := isMetrics.Metrics().At(j)
+	for i := 0; i < b.metrics.ResourceMetrics().Len(); i++ {
+		resourceMetrics := b.metrics.ResourceMetrics().At(i)
+		for j := 0; j < resourceMetrics.ScopeMetrics().Len(); j++ {
+			isMetrics := resourceMetrics.ScopeMetrics().At(j)
+			for k := 0; k < isMetrics.Metrics().Len(); k++ {
+				metric := isMetrics.Metrics().At(k)
 				if metric.Type() == pmetric.MetricTypeHistogram {
-					for k := 0; k < metric.Histogram().DataPoints().Len(); k++ {
-						dataPoint := metric.Histogram().DataPoints().At(k)
+					for l := 0; l < metric.Histogram().DataPoints().Len(); l++ {
+						dataPoint := metric.Histogram().DataPoints().At(l)
 						if dataPoint.ExplicitBounds().Len() > 0 && math.IsInf(dataPoint.ExplicitBounds().At(dataPoint.ExplicitBounds().Len()-1), +1) {
 							dataPoint.ExplicitBounds().FromRaw(dataPoint.ExplicitBounds().AsRaw()[:dataPoint.ExplicitBounds().Len()-1])
 						} else if dataPoint.BucketCounts().Len() == dataPoint.ExplicitBounds().Len() {
 							infBucketCount := dataPoint.Count()
-							for l := 0; l < dataPoint.BucketCounts().Len(); l++ {
-								infBucketCount -= dataPoint.BucketCounts().At(l)
+							for m := 0; m < dataPoint.BucketCounts().Len(); m++ {
+								infBucketCount -= dataPoint.BucketCounts().At(m)
 							}
 							if infBucketCount <= dataPoint.Count() {
 								dataPoint.BucketCounts().Append(infBucketCount)
@@ -206,8 +553,13 @@ func (b *MetricsBatch) GetMetrics() pmetric.Metrics {
 				}
 			}
 		}
-		resourceMetrics.CopyTo(metrics.ResourceMetrics().AppendEmpty())
 	}
+
+	b.applyNameSuffixes()
+	b.adjustCumulative()
+
+	metrics := b.metrics
+	b.resetMetrics()
 	return metrics
 }
 
@@ -216,7 +568,8 @@ func (b *MetricsBatch) addPointWithUnknownSchema(measurement string, tags map[st
 		ts = time.Now()
 	}
 
-	for k, v := range fields {
+	for _, k := range sortedKeys(fields) {
+		v := fields[k]
 		if k == common.AttributeStartTimeStatsd {
 			continue
 		}
@@ -240,7 +593,7 @@ func (b *MetricsBatch) addPointWithUnknownSchema(measurement string, tags map[st
 		if err != nil {
 			return err
 		}
-		dataPoint := metric.Gauge().DataPoints().AppendEmpty()
+		dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		// set start_time, if exists and is RFC3339
@@ -265,6 +618,11 @@ func (b *MetricsBatch) addPointWithUnknownSchema(measurement string, tags map[st
 	return nil
 }
 
+// sortedKeys returns the keys of m in order, so that the same points always convert to the same output.
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
 func sortHistogramBuckets(bucketCounts []uint64, explicitBounds []float64) {
 	sBuckets := make(sortableBuckets, len(explicitBounds))
 	for i := 0; i < len(explicitBounds); i++ {
@@ -0,0 +1,321 @@
+package influx2otel
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// Annotated CSV is the output format of Flux queries.
+// https://docs.influxdata.com/influxdb/v2/reference/syntax/annotated-csv/
+
+const (
+	csvAnnotationDatatype = "#datatype"
+	csvAnnotationGroup    = "#group"
+	csvAnnotationDefault  = "#default"
+
+	csvColumnResult      = "result"
+	csvColumnTable       = "table"
+	csvColumnStart       = "_start"
+	csvColumnStop        = "_stop"
+	csvColumnTime        = "_time"
+	csvColumnValue       = "_value"
+	csvColumnField       = "_field"
+	csvColumnMeasurement = "_measurement"
+	csvColumnError       = "error"
+
+	csvDatatypeString       = "string"
+	csvDatatypeLong         = "long"
+	csvDatatypeUnsignedLong = "unsignedLong"
+	csvDatatypeDouble       = "double"
+	csvDatatypeBoolean      = "boolean"
+	csvDatatypeDateTime     = "dateTime"
+)
+
+// csvTable is the schema of one annotated CSV table.
+type csvTable struct {
+	columns   []string
+	datatypes []string
+	groups    []bool
+	defaults  []string
+	hasGroups bool
+}
+
+type csvPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]interface{}
+	ts          time.Time
+}
+
+// AddAnnotatedCSV adds points read from annotated CSV, as returned by Flux queries.
+//
+// Rows having _field and _value columns are pivoted back into points,
+// so that rows with equal _measurement, tags and _time become one point with several fields;
+// rows without _time, such as the output of aggregates, are timestamped with _stop;
+// all columns except result, table, _start, _stop, _time, _value, _field and _measurement are tags.
+// Rows without _field and _value columns, for example the output of Flux pivot(),
+// are points already: group key columns (or string columns, without a #group annotation) are tags,
+// and the other columns are fields.
+//
+// Points are added as untyped points after the whole input is read,
+// or earlier when the number of buffered points reaches the AnnotatedCSVMaxBufferedPoints limit, if set.
+// Flux returns one table per field, so a limit can split the fields of a point into several points,
+// which breaks Prometheus v1 histograms and summaries; pivoted input is not split.
+func (b *MetricsBatch) AddAnnotatedCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = false
+
+	var points []*csvPoint
+	pointsByKey := make(map[string]*csvPoint)
+
+	var table *csvTable
+	var annotations csvTable
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read annotated CSV: %w", err)
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		switch record[0] {
+		case csvAnnotationDatatype:
+			annotations.datatypes = record
+			table = nil
+			continue
+		case csvAnnotationGroup:
+			annotations.groups = make([]bool, len(record))
+			for i, v := range record {
+				annotations.groups[i] = v == "true"
+			}
+			annotations.hasGroups = true
+			table = nil
+			continue
+		case csvAnnotationDefault:
+			annotations.defaults = record
+			table = nil
+			continue
+		}
+		if strings.HasPrefix(record[0], "#") {
+			// unknown annotation
+			table = nil
+			continue
+		}
+
+		if table == nil {
+			table = &csvTable{
+				columns:   record,
+				datatypes: annotations.datatypes,
+				groups:    annotations.groups,
+				defaults:  annotations.defaults,
+				hasGroups: annotations.hasGroups,
+			}
+			annotations = csvTable{}
+			if len(table.columns) > 1 && table.columns[1] == csvColumnError {
+				table.columns = nil
+			}
+			continue
+		}
+		if table.columns == nil {
+			// error table: ,error,reference
+			if len(record) > 1 && record[1] != "" {
+				return fmt.Errorf("annotated CSV contains error: %s", record[1])
+			}
+			continue
+		}
+
+		if err = table.addRow(record, &points, pointsByKey); err != nil {
+			return err
+		}
+		if b.maxCSVBufferedPoints > 0 && len(points) >= b.maxCSVBufferedPoints {
+			if err = b.addCSVPoints(points); err != nil {
+				return err
+			}
+			points = points[:0]
+			clear(pointsByKey)
+		}
+	}
+
+	return b.addCSVPoints(points)
+}
+
+func (b *MetricsBatch) addCSVPoints(points []*csvPoint) error {
+	for _, point := range points {
+		if err := b.AddPoint(point.measurement, point.tags, point.fields, point.ts, common.InfluxMetricValueTypeUntyped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *csvTable) cell(record []string, i int) string {
+	if i < len(record) && record[i] != "" {
+		return record[i]
+	}
+	if i < len(t.defaults) {
+		return t.defaults[i]
+	}
+	return ""
+}
+
+func (t *csvTable) datatype(i int) string {
+	if i < len(t.datatypes) {
+		return t.datatypes[i]
+	}
+	return ""
+}
+
+func (t *csvTable) addRow(record []string, points *[]*csvPoint, pointsByKey map[string]*csvPoint) error {
+	var measurement, fieldKey, rawValue string
+	var foundField, foundValue bool
+	var ts, stop time.Time
+	tags := make(map[string]string)
+	fields := make(map[string]interface{})
+
+	for i, column := range t.columns {
+		if i == 0 {
+			// annotation column
+			continue
+		}
+		value := t.cell(record, i)
+		switch column {
+		case csvColumnResult, csvColumnTable, csvColumnStart:
+		case csvColumnMeasurement:
+			measurement = value
+		case csvColumnTime, csvColumnStop:
+			if value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return fmt.Errorf("invalid annotated CSV %s value '%s': %w", column, value, err)
+			}
+			if column == csvColumnTime {
+				ts = parsed
+			} else {
+				stop = parsed
+			}
+		case csvColumnField:
+			fieldKey, foundField = value, true
+		case csvColumnValue:
+			rawValue, foundValue = value, true
+		default:
+			if value == "" {
+				continue
+			}
+			isTag := t.datatype(i) == "" || t.datatype(i) == csvDatatypeString
+			if t.hasGroups && i < len(t.groups) {
+				isTag = t.groups[i]
+			}
+			if isTag {
+				tags[column] = value
+			} else {
+				fieldValue, err := parseCSVValue(t.datatype(i), value)
+				if err != nil {
+					return fmt.Errorf("invalid annotated CSV value for column '%s': %w", column, err)
+				}
+				fields[column] = fieldValue
+			}
+		}
+	}
+
+	if measurement == "" {
+		return fmt.Errorf("annotated CSV row has no %s value", csvColumnMeasurement)
+	}
+	if ts.IsZero() {
+		ts = stop
+	}
+	if ts.IsZero() {
+		return fmt.Errorf("annotated CSV row has no %s or %s value", csvColumnTime, csvColumnStop)
+	}
+
+	if foundField && foundValue {
+		// Unpivoted rows: every column other than the field and value is a tag.
+		for k, v := range fields {
+			tags[k] = fmt.Sprint(v)
+		}
+		fields = make(map[string]interface{}, 1)
+		if fieldKey == "" || rawValue == "" {
+			return nil
+		}
+		valueType := ""
+		for i, column := range t.columns {
+			if column == csvColumnValue {
+				valueType = t.datatype(i)
+			}
+		}
+		fieldValue, err := parseCSVValue(valueType, rawValue)
+		if err != nil {
+			return fmt.Errorf("invalid annotated CSV value for field '%s': %w", fieldKey, err)
+		}
+		fields[fieldKey] = fieldValue
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	key := csvPointKey(measurement, tags, ts)
+	if point, found := pointsByKey[key]; found {
+		for k, v := range fields {
+			point.fields[k] = v
+		}
+		return nil
+	}
+	point := &csvPoint{measurement: measurement, tags: tags, fields: fields, ts: ts}
+	pointsByKey[key] = point
+	*points = append(*points, point)
+	return nil
+}
+
+func csvPointKey(measurement string, tags map[string]string, ts time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(measurement)
+	for _, k := range sortedKeys(tags) {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(tags[k])
+	}
+	sb.WriteByte(0)
+	sb.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	return sb.String()
+}
+
+// parseCSVValue parses a value per its #datatype annotation.
+// Values without a datatype are parsed as double if possible, otherwise kept as string.
+func parseCSVValue(datatype, value string) (interface{}, error) {
+	switch {
+	case datatype == csvDatatypeLong:
+		return strconv.ParseInt(value, 10, 64)
+	case datatype == csvDatatypeUnsignedLong:
+		return strconv.ParseUint(value, 10, 64)
+	case datatype == csvDatatypeDouble:
+		return strconv.ParseFloat(value, 64)
+	case datatype == csvDatatypeBoolean:
+		return strconv.ParseBool(value)
+	case strings.HasPrefix(datatype, csvDatatypeDateTime):
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UnixNano(), nil
+	case datatype == "":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, nil
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,201 @@
+package influx2otel_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestAddAnnotatedCSV_histogram(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	// One table per field, as returned by from() |> range() without pivot().
+	csv := `#group,false,false,true,true,false,false,true,true,true,true
+#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339Nano,double,string,string,string,string
+#default,_result,,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,code,method
+,,0,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,2014-03-17T14:26:03.000000123Z,144320,count,http_request_duration_seconds,200,post
+,,1,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,2014-03-17T14:26:03.000000123Z,53423,sum,http_request_duration_seconds,200,post
+,,2,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,2014-03-17T14:26:03.000000123Z,24054,0.05,http_request_duration_seconds,200,post
+,,3,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,2014-03-17T14:26:03.000000123Z,129389,0.5,http_request_duration_seconds,200,post
+
+#group,false,false,true,true,false,false,true,true
+#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339Nano,double,string,string
+#default,_result,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement
+,,4,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,2014-03-17T14:26:03.000000123Z,23.9,gauge,cache_age_seconds
+`
+	b := c.NewBatch()
+	require.NoError(t, b.AddAnnotatedCSV(strings.NewReader(csv)))
+
+	expect := pmetric.NewMetrics()
+	isMetrics := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("cache_age_seconds")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetDoubleValue(23.9)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	hdp := m.Histogram().DataPoints().AppendEmpty()
+	hdp.Attributes().PutStr("code", "200")
+	hdp.Attributes().PutStr("method", "post")
+	hdp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	hdp.SetCount(144320)
+	hdp.SetSum(53423)
+	hdp.BucketCounts().FromRaw([]uint64{24054, 105335, 14931})
+	hdp.ExplicitBounds().FromRaw([]float64{0.05, 0.5})
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAddAnnotatedCSV_pivoted(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	csv := `#group,false,false,true,false,true,false,false
+#datatype,string,long,string,dateTime:RFC3339,string,double,long
+#default,_result,,,,,,
+,result,table,_measurement,_time,cpu,usage_user,usage_guest
+,,0,cpu,2014-03-17T14:26:03Z,cpu0,10.5,
+,,0,cpu,2014-03-17T14:26:13Z,cpu0,11.5,3
+`
+	b := c.NewBatch()
+	require.NoError(t, b.AddAnnotatedCSV(strings.NewReader(csv)))
+
+	expect := pmetric.NewMetrics()
+	isMetrics := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_guest")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu0")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(1395066373, 0)))
+	dp.SetIntValue(3)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_user")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu0")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(1395066363, 0)))
+	dp.SetDoubleValue(10.5)
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu0")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(1395066373, 0)))
+	dp.SetDoubleValue(11.5)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAddAnnotatedCSV_errors(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	for _, csv := range []string{
+		"#datatype,string,string\n,error,reference\n,query failed,\n",
+		",result,table,_time,_value,_field\n,,0,2014-03-17T14:26:03Z,1,gauge\n",
+		",result,table,_time,_value,_field,_measurement\n,,0,yesterday,1,gauge,cpu\n",
+		"#datatype,string,long,dateTime:RFC3339,long,string,string\n,result,table,_time,_value,_field,_measurement\n,,0,2014-03-17T14:26:03Z,1.5,gauge,cpu\n",
+		",result,table,_value,_field,_measurement\n,,0,1,gauge,cpu\n",
+	} {
+		assert.Error(t, c.NewBatch().AddAnnotatedCSV(strings.NewReader(csv)), csv)
+	}
+}
+
+func TestAddAnnotatedCSV_aggregate(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	// Aggregates such as mean() have no _time column.
+	csv := `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,double,string,string
+,result,table,_start,_stop,_value,_field,_measurement
+,,0,2014-03-17T00:00:00Z,2014-03-18T00:00:00Z,23.9,gauge,cache_age_seconds
+`
+	b := c.NewBatch()
+	require.NoError(t, b.AddAnnotatedCSV(strings.NewReader(csv)))
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("cache_age_seconds")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2014, 3, 18, 0, 0, 0, 0, time.UTC)))
+	dp.SetDoubleValue(23.9)
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+// With the default configuration, the fields of a point are pivoted from all field tables of a large export.
+func TestAddAnnotatedCSV_manyRows(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	const pointCount = 12000
+	var sb strings.Builder
+	start := time.Unix(1395066363, 0).UTC()
+	for table, field := range []string{"count", "sum", "0.5"} {
+		sb.WriteString("#datatype,string,long,dateTime:RFC3339Nano,double,string,string\n")
+		sb.WriteString(",result,table,_time,_value,_field,_measurement\n")
+		for i := 0; i < pointCount; i++ {
+			fmt.Fprintf(&sb, ",,%d,%s,%d,%s,http_request_duration_seconds\n",
+				table, start.Add(time.Duration(i)*time.Second).Format(time.RFC3339Nano), 10+table, field)
+		}
+		sb.WriteString("\n")
+	}
+
+	b := c.NewBatch()
+	require.NoError(t, b.AddAnnotatedCSV(strings.NewReader(sb.String())))
+	metrics := b.GetMetrics()
+	require.Equal(t, pointCount, metrics.DataPointCount())
+	m := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	require.Equal(t, pmetric.MetricTypeHistogram, m.Type())
+	for i := 0; i < m.Histogram().DataPoints().Len(); i++ {
+		dp := m.Histogram().DataPoints().At(i)
+		assert.Equal(t, uint64(10), dp.Count())
+		assert.Equal(t, float64(11), dp.Sum())
+		assert.Equal(t, []float64{0.5}, dp.ExplicitBounds().AsRaw())
+	}
+}
+
+func TestAddAnnotatedCSV_maxBufferedPoints(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.AnnotatedCSVMaxBufferedPoints = 1
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	csv := `#datatype,string,long,dateTime:RFC3339Nano,double,string,string
+,result,table,_time,_value,_field,_measurement
+,,0,2014-03-17T14:26:03.000000123Z,23.9,gauge,cache_age_seconds
+,,0,2014-03-17T14:26:04.000000123Z,24.9,gauge,cache_age_seconds
+,,0,2014-03-17T14:26:05.000000123Z,25.9,gauge,cache_age_seconds
+,,0,yesterday,26.9,gauge,cache_age_seconds
+`
+	var flushed []pmetric.Metrics
+	b, err := c.NewStreamingBatch(1, func(metrics pmetric.Metrics) error {
+		flushed = append(flushed, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Points are handed to the batch, and flushed, while the input is read.
+	assert.Error(t, b.AddAnnotatedCSV(strings.NewReader(csv)))
+	assert.Len(t, flushed, 2)
+	assert.Equal(t, 1, b.DataPointCount())
+
+	config.AnnotatedCSVMaxBufferedPoints = -1
+	_, err = influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package influx2otel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// AddRecord adds the rows of an Arrow record, such as one batch of a FlightSQL query result
+// over an InfluxDB 3 table, as untyped points of the measurement.
+//
+// Columns are classified by the InfluxDB column type schema metadata, if present.
+// Otherwise dictionary-encoded string columns are tags, the timestamp column named time
+// is the point timestamp, and all other columns are fields.
+// Null tag and field values are omitted; rows without a timestamp are an error.
+func (b *MetricsBatch) AddRecord(measurement string, record arrow.Record) error {
+	kinds, err := arrowColumnKinds(record.Schema())
+	if err != nil {
+		return err
+	}
+	columns := record.Columns()
+	schemaFields := record.Schema().Fields()
+
+	for i := 0; i < int(record.NumRows()); i++ {
+		tags := make(map[string]string)
+		fields := make(map[string]interface{})
+		var ts time.Time
+		for j, column := range columns {
+			name := schemaFields[j].Name
+			switch kinds[j] {
+			case arrowColumnTime:
+				var found bool
+				if ts, found = arrowTime(column, i); !found {
+					return fmt.Errorf("record row %d has no timestamp", i)
+				}
+			case arrowColumnTag:
+				if v, found := arrowString(column, i); found {
+					tags[name] = v
+				}
+			case arrowColumnField:
+				if v, found := arrowValue(column, i); found {
+					fields[name] = v
+				}
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if err = b.AddPoint(measurement, tags, fields, ts, common.InfluxMetricValueTypeUntyped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+var arrowTagType = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+
+// newArrowRecord builds a record with one column per field; values are appended per row, nil appends null.
+func newArrowRecord(t *testing.T, fields []arrow.Field, rows ...[]interface{}) arrow.Record {
+	t.Helper()
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), arrow.NewSchema(fields, nil))
+	defer b.Release()
+	for _, row := range rows {
+		for i, v := range row {
+			fb := b.Field(i)
+			if v == nil {
+				fb.AppendNull()
+				continue
+			}
+			switch fb := fb.(type) {
+			case *array.BinaryDictionaryBuilder:
+				require.NoError(t, fb.AppendString(v.(string)))
+			case *array.StringBuilder:
+				fb.Append(v.(string))
+			case *array.Float64Builder:
+				fb.Append(v.(float64))
+			case *array.Int64Builder:
+				fb.Append(v.(int64))
+			case *array.TimestampBuilder:
+				fb.Append(arrow.Timestamp(v.(time.Time).UnixNano()))
+			default:
+				t.Fatalf("unsupported builder %T", fb)
+			}
+		}
+	}
+	return b.NewRecord()
+}
+
+func TestMetricsBatch_AddRecord(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	record := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "cpu", Type: arrowTagType},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "usage_user", Type: arrow.PrimitiveTypes.Float64},
+			{Name: "usage_guest", Type: arrow.PrimitiveTypes.Int64},
+		},
+		[]interface{}{"cpu0", time.Unix(0, 1395066363000000123), float64(10.5), nil},
+		[]interface{}{"cpu1", time.Unix(0, 1395066363000000123), float64(11.5), int64(3)},
+	)
+	defer record.Release()
+
+	b := c.NewBatch()
+	require.NoError(t, b.AddRecord("cpu", record))
+
+	expect := pmetric.NewMetrics()
+	isMetrics := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_user")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu0")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetDoubleValue(10.5)
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu1")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetDoubleValue(11.5)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_guest")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu1")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetIntValue(3)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestMetricsBatch_AddRecordColumnMetadata(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	columnType := func(v string) arrow.Metadata {
+		return arrow.NewMetadata([]string{"iox::column::type"}, []string{v})
+	}
+	record := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "host", Type: arrow.BinaryTypes.String, Metadata: columnType("iox::column_type::tag")},
+			{Name: "ts", Type: arrow.FixedWidthTypes.Timestamp_ns, Metadata: columnType("iox::column_type::timestamp")},
+			{Name: "gauge", Type: arrow.PrimitiveTypes.Float64, Metadata: columnType("iox::column_type::field::float")},
+		},
+		[]interface{}{"a", time.Unix(0, 1395066363000000123), float64(23.9)},
+	)
+	defer record.Release()
+
+	b := c.NewBatch()
+	require.NoError(t, b.AddRecord("cache_age_seconds", record))
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("cache_age_seconds")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("host", "a")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetDoubleValue(23.9)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestMetricsBatch_AddRecordNoTime(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	record := newArrowRecord(t,
+		[]arrow.Field{{Name: "gauge", Type: arrow.PrimitiveTypes.Float64}},
+		[]interface{}{float64(1)},
+	)
+	defer record.Release()
+
+	assert.Error(t, c.NewBatch().AddRecord("cpu", record))
+}
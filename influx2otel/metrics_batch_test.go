@@ -0,0 +1,233 @@
+package influx2otel_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestMetricsBatch_GetMetricsEmptiesBatch(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cpu",
+		map[string]string{"cpu": "cpu0"},
+		map[string]interface{}{"usage_user": float64(10), "usage_system": float64(30)},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+	assert.Equal(t, 2, b.DataPointCount())
+
+	assert.Equal(t, 2, b.GetMetrics().DataPointCount())
+	assert.Equal(t, 0, b.DataPointCount())
+	assert.Equal(t, 0, b.GetMetrics().ResourceMetrics().Len())
+
+	err = b.AddPoint("cpu",
+		map[string]string{"cpu": "cpu0"},
+		map[string]interface{}{"usage_user": float64(11)},
+		time.Unix(0, 1395066373000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.GetMetrics().DataPointCount())
+}
+
+func TestMetricsBatch_Reset(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cpu",
+		map[string]string{"cpu": "cpu0"},
+		map[string]interface{}{"usage_user": float64(10)},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	b.Reset()
+	assert.Equal(t, 0, b.DataPointCount())
+	assert.Equal(t, 0, b.GetMetrics().ResourceMetrics().Len())
+}
+
+func TestMetricsBatch_streaming(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	var flushed []pmetric.Metrics
+	b, err := c.NewStreamingBatch(2, func(metrics pmetric.Metrics) error {
+		flushed = append(flushed, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		err = b.AddPoint("cpu",
+			map[string]string{"cpu": "cpu0"},
+			map[string]interface{}{"usage_user": float64(i)},
+			time.Unix(0, 1395066363000000123+int64(i)),
+			common.InfluxMetricValueTypeUntyped)
+		require.NoError(t, err)
+	}
+	require.NoError(t, b.Flush())
+
+	require.Len(t, flushed, 3)
+	assert.Equal(t, 2, flushed[0].DataPointCount())
+	assert.Equal(t, 2, flushed[1].DataPointCount())
+	assert.Equal(t, 1, flushed[2].DataPointCount())
+
+	require.NoError(t, b.Flush())
+	assert.Len(t, flushed, 3)
+}
+
+func TestMetricsBatch_streamingKeepsV2HistogramTogether(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	var flushed []pmetric.Metrics
+	b, err := c.NewStreamingBatch(1, func(metrics pmetric.Metrics) error {
+		flushed = append(flushed, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+
+	ts := time.Unix(0, 1395066363000000123)
+	err = b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{"method": "post"},
+		map[string]interface{}{"http_request_duration_seconds_count": float64(144320), "http_request_duration_seconds_sum": float64(53423)},
+		ts,
+		common.InfluxMetricValueTypeHistogram)
+	require.NoError(t, err)
+	for i, le := range []string{"0.05", "0.1", "+Inf"} {
+		err = b.AddPoint(common.MeasurementPrometheus,
+			map[string]string{"method": "post", "le": le},
+			map[string]interface{}{"http_request_duration_seconds_bucket": []float64{24054, 33444, 144320}[i]},
+			ts,
+			common.InfluxMetricValueTypeHistogram)
+		require.NoError(t, err)
+	}
+	require.NoError(t, b.Flush())
+
+	require.Len(t, flushed, 1)
+	dataPoints := flushed[0].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Histogram().DataPoints()
+	require.Equal(t, 1, dataPoints.Len())
+	assert.Equal(t, 2, dataPoints.At(0).ExplicitBounds().Len())
+}
+
+func TestMetricsBatch_streamingSplitsV2HistogramSeries(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	var flushed []pmetric.Metrics
+	b, err := c.NewStreamingBatch(1, func(metrics pmetric.Metrics) error {
+		flushed = append(flushed, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Lines of different series share the scrape timestamp.
+	ts := time.Unix(0, 1395066363000000123)
+	for _, method := range []string{"get", "post", "put"} {
+		err = b.AddPoint(common.MeasurementPrometheus,
+			map[string]string{"method": method},
+			map[string]interface{}{"http_request_duration_seconds_count": float64(2), "http_request_duration_seconds_sum": float64(1)},
+			ts,
+			common.InfluxMetricValueTypeHistogram)
+		require.NoError(t, err)
+		for _, le := range []string{"0.5", "+Inf"} {
+			err = b.AddPoint(common.MeasurementPrometheus,
+				map[string]string{"method": method, "le": le},
+				map[string]interface{}{"http_request_duration_seconds_bucket": float64(2)},
+				ts,
+				common.InfluxMetricValueTypeHistogram)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, b.Flush())
+
+	require.Len(t, flushed, 3)
+	for _, metrics := range flushed {
+		dataPoints := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Histogram().DataPoints()
+		require.Equal(t, 1, dataPoints.Len())
+		assert.Equal(t, []uint64{2, 0}, dataPoints.At(0).BucketCounts().AsRaw())
+	}
+}
+
+func TestMetricsBatch_streamingRetainsFailedFlush(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	var flushed []pmetric.Metrics
+	flushErr := errors.New("unavailable")
+	b, err := c.NewStreamingBatch(1, func(metrics pmetric.Metrics) error {
+		if flushErr != nil {
+			return flushErr
+		}
+		flushed = append(flushed, metrics)
+		return nil
+	})
+	require.NoError(t, err)
+
+	addPoint := func(i int) error {
+		return b.AddPoint("cpu",
+			map[string]string{"cpu": "cpu0"},
+			map[string]interface{}{"usage_user": float64(i)},
+			time.Unix(0, 1395066363000000123+int64(i)),
+			common.InfluxMetricValueTypeUntyped)
+	}
+	require.NoError(t, addPoint(0))
+	assert.ErrorIs(t, addPoint(1), flushErr)
+	assert.ErrorIs(t, addPoint(1), flushErr, "retained metrics are flushed before more points are added")
+	assert.ErrorIs(t, b.Flush(), flushErr)
+
+	flushErr = nil
+	require.NoError(t, addPoint(1))
+	require.NoError(t, b.Flush())
+
+	require.Len(t, flushed, 2)
+	assert.Equal(t, 0.0, flushed[0].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0).DoubleValue())
+	assert.Equal(t, 1.0, flushed[1].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0).DoubleValue())
+}
+
+func TestMetricsBatch_streamingInvalid(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	_, err = c.NewStreamingBatch(0, func(pmetric.Metrics) error { return nil })
+	assert.Error(t, err)
+	_, err = c.NewStreamingBatch(10, nil)
+	assert.Error(t, err)
+	assert.Error(t, c.NewBatch().Flush())
+}
+
+func TestMetricsBatch_deterministicOutput(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	convert := func() []byte {
+		b := c.NewBatch()
+		for _, host := range []string{"a", "b", "c", "d"} {
+			err := b.AddPoint("cpu",
+				map[string]string{"host.name": host, "cpu": "cpu0", "region": "west", "rack": "1"},
+				map[string]interface{}{"usage_user": float64(1), "usage_system": float64(2), "usage_idle": float64(3), "usage_iowait": float64(4)},
+				time.Unix(0, 1395066363000000123),
+				common.InfluxMetricValueTypeUntyped)
+			require.NoError(t, err)
+		}
+		buf, err := new(pmetric.ProtoMarshaler).MarshalMetrics(b.GetMetrics())
+		require.NoError(t, err)
+		return buf
+	}
+
+	expect := convert()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expect, convert())
+	}
+}
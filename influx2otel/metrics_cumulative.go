@@ -0,0 +1,276 @@
+package influx2otel
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// CumulativeConversion selects stateful handling of cumulative sums and histograms.
+type CumulativeConversion uint8
+
+const (
+	// CumulativeAsIs converts cumulative sums and histograms without tracking series across batches.
+	// Start timestamps are set only from the start_time_unix_nano and statsd start_time fields.
+	CumulativeAsIs CumulativeConversion = iota
+	// CumulativeInferStartTime tracks each series across batches.
+	// The start timestamp of a series is its first observed timestamp,
+	// and is moved to the timestamp of the previous observation when a counter reset is detected.
+	CumulativeInferStartTime
+	// CumulativeToDelta tracks each series like CumulativeInferStartTime,
+	// and converts data points to delta temporality.
+	// The first observation of each series is dropped, since it has no previous value.
+	CumulativeToDelta
+)
+
+func (c CumulativeConversion) String() string {
+	switch c {
+	case CumulativeAsIs:
+		return "as-is"
+	case CumulativeInferStartTime:
+		return "infer-start-time"
+	case CumulativeToDelta:
+		return "delta"
+	default:
+		panic("invalid CumulativeConversion")
+	}
+}
+
+// cumulativeTracker holds the state of cumulative series across batches.
+// It is shared by all batches of a LineProtocolToOtelMetrics.
+type cumulativeTracker struct {
+	conversion CumulativeConversion
+	ttl        time.Duration
+
+	mu          sync.Mutex
+	seriesByKey map[string]*cumulativeSeries
+	lastSweep   time.Time
+}
+
+type cumulativeSeries struct {
+	start   pcommon.Timestamp
+	last    pcommon.Timestamp
+	updated time.Time
+
+	valueType   pmetric.NumberDataPointValueType
+	intValue    int64
+	doubleValue float64
+
+	count          uint64
+	sum            float64
+	bucketCounts   []uint64
+	explicitBounds []float64
+}
+
+func newCumulativeTracker(conversion CumulativeConversion, ttl time.Duration) *cumulativeTracker {
+	return &cumulativeTracker{
+		conversion:  conversion,
+		ttl:         ttl,
+		seriesByKey: make(map[string]*cumulativeSeries),
+		lastSweep:   time.Now(),
+	}
+}
+
+// adjustCumulative sets start timestamps of, or converts to delta, the cumulative data points of the batch.
+func (b *MetricsBatch) adjustCumulative() {
+	t := b.cumulativeTracker
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.sweep(now)
+
+	resourceMetricsSlice := b.metrics.ResourceMetrics()
+	for i := 0; i < resourceMetricsSlice.Len(); i++ {
+		resourceMetrics := resourceMetricsSlice.At(i)
+		rKey := pdatautil.MapHash(resourceMetrics.Resource().Attributes())
+		for j := 0; j < resourceMetrics.ScopeMetrics().Len(); j++ {
+			isMetrics := resourceMetrics.ScopeMetrics().At(j)
+			metricKeyPrefix := fmt.Sprintf("%x:%s:%s:", rKey, isMetrics.Scope().Name(), isMetrics.Scope().Version())
+			isMetrics.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				metricKey := metricKeyPrefix + metric.Name() + ":"
+				switch metric.Type() {
+				case pmetric.MetricTypeSum:
+					sum := metric.Sum()
+					if sum.AggregationTemporality() != pmetric.AggregationTemporalityCumulative {
+						return false
+					}
+					sum.DataPoints().RemoveIf(func(dataPoint pmetric.NumberDataPoint) bool {
+						return !t.adjustNumberDataPoint(metricKey, dataPoint, sum.IsMonotonic(), now)
+					})
+					if t.conversion == CumulativeToDelta {
+						sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+					}
+					return sum.DataPoints().Len() == 0
+				case pmetric.MetricTypeHistogram:
+					histogram := metric.Histogram()
+					if histogram.AggregationTemporality() != pmetric.AggregationTemporalityCumulative {
+						return false
+					}
+					histogram.DataPoints().RemoveIf(func(dataPoint pmetric.HistogramDataPoint) bool {
+						return !t.adjustHistogramDataPoint(metricKey, dataPoint, now)
+					})
+					if t.conversion == CumulativeToDelta {
+						histogram.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+					}
+					return histogram.DataPoints().Len() == 0
+				default:
+					return false
+				}
+			})
+		}
+	}
+}
+
+// sweep forgets series that have not been observed for the configured TTL.
+func (t *cumulativeTracker) sweep(now time.Time) {
+	if t.ttl == 0 || now.Sub(t.lastSweep) < t.ttl {
+		return
+	}
+	for key, series := range t.seriesByKey {
+		if now.Sub(series.updated) >= t.ttl {
+			delete(t.seriesByKey, key)
+		}
+	}
+	t.lastSweep = now
+}
+
+// lookupSeries returns the state of a series, creating it if the data point is the first observation.
+func (t *cumulativeTracker) lookupSeries(key string, timestamp, startTimestamp pcommon.Timestamp, now time.Time) (*cumulativeSeries, bool) {
+	series, found := t.seriesByKey[key]
+	if !found {
+		series = &cumulativeSeries{start: startTimestamp, last: timestamp}
+		if series.start == 0 {
+			series.start = timestamp
+		}
+		t.seriesByKey[key] = series
+	}
+	series.updated = now
+	return series, !found
+}
+
+// adjustNumberDataPoint returns false if the data point should be dropped.
+func (t *cumulativeTracker) adjustNumberDataPoint(metricKey string, dataPoint pmetric.NumberDataPoint, isMonotonic bool, now time.Time) bool {
+	key := metricKey + fmt.Sprintf("%x", pdatautil.MapHash(dataPoint.Attributes()))
+	series, isNew := t.lookupSeries(key, dataPoint.Timestamp(), dataPoint.StartTimestamp(), now)
+	if isNew {
+		series.valueType = dataPoint.ValueType()
+		series.intValue, series.doubleValue = dataPoint.IntValue(), dataPoint.DoubleValue()
+	}
+	if isNew || dataPoint.Timestamp() <= series.last {
+		// first observation, or out of order
+		if dataPoint.StartTimestamp() == 0 {
+			dataPoint.SetStartTimestamp(series.start)
+		}
+		return t.conversion != CumulativeToDelta
+	}
+
+	reset := dataPoint.ValueType() != series.valueType ||
+		(dataPoint.StartTimestamp() != 0 && dataPoint.StartTimestamp() != series.start)
+	if !reset && isMonotonic {
+		switch dataPoint.ValueType() {
+		case pmetric.NumberDataPointValueTypeInt:
+			reset = dataPoint.IntValue() < series.intValue
+		case pmetric.NumberDataPointValueTypeDouble:
+			reset = dataPoint.DoubleValue() < series.doubleValue
+		}
+	}
+	previous := series.last
+	if reset {
+		series.start = dataPoint.StartTimestamp()
+		if series.start == 0 {
+			series.start = previous
+		}
+	}
+	intValue, doubleValue := dataPoint.IntValue(), dataPoint.DoubleValue()
+
+	if t.conversion == CumulativeToDelta {
+		if reset {
+			dataPoint.SetStartTimestamp(series.start)
+		} else {
+			dataPoint.SetStartTimestamp(previous)
+			switch dataPoint.ValueType() {
+			case pmetric.NumberDataPointValueTypeInt:
+				dataPoint.SetIntValue(intValue - series.intValue)
+			case pmetric.NumberDataPointValueTypeDouble:
+				dataPoint.SetDoubleValue(doubleValue - series.doubleValue)
+			}
+		}
+	} else if dataPoint.StartTimestamp() == 0 {
+		dataPoint.SetStartTimestamp(series.start)
+	}
+
+	series.last = dataPoint.Timestamp()
+	series.valueType = dataPoint.ValueType()
+	series.intValue, series.doubleValue = intValue, doubleValue
+	return true
+}
+
+// adjustHistogramDataPoint returns false if the data point should be dropped.
+func (t *cumulativeTracker) adjustHistogramDataPoint(metricKey string, dataPoint pmetric.HistogramDataPoint, now time.Time) bool {
+	key := metricKey + fmt.Sprintf("%x", pdatautil.MapHash(dataPoint.Attributes()))
+	series, isNew := t.lookupSeries(key, dataPoint.Timestamp(), dataPoint.StartTimestamp(), now)
+	if isNew {
+		series.count, series.sum = dataPoint.Count(), dataPoint.Sum()
+		series.bucketCounts = dataPoint.BucketCounts().AsRaw()
+		series.explicitBounds = dataPoint.ExplicitBounds().AsRaw()
+	}
+	if isNew || dataPoint.Timestamp() <= series.last {
+		// first observation, or out of order
+		if dataPoint.StartTimestamp() == 0 {
+			dataPoint.SetStartTimestamp(series.start)
+		}
+		return t.conversion != CumulativeToDelta
+	}
+
+	bucketCounts := dataPoint.BucketCounts().AsRaw()
+	explicitBounds := dataPoint.ExplicitBounds().AsRaw()
+	reset := dataPoint.Count() < series.count ||
+		(dataPoint.StartTimestamp() != 0 && dataPoint.StartTimestamp() != series.start) ||
+		!slices.Equal(explicitBounds, series.explicitBounds) ||
+		len(bucketCounts) != len(series.bucketCounts)
+	for i := 0; !reset && i < len(bucketCounts); i++ {
+		reset = bucketCounts[i] < series.bucketCounts[i]
+	}
+	previous := series.last
+	if reset {
+		series.start = dataPoint.StartTimestamp()
+		if series.start == 0 {
+			series.start = previous
+		}
+	}
+	count, sum := dataPoint.Count(), dataPoint.Sum()
+
+	if t.conversion == CumulativeToDelta {
+		if reset {
+			dataPoint.SetStartTimestamp(series.start)
+		} else {
+			dataPoint.SetStartTimestamp(previous)
+			dataPoint.SetCount(count - series.count)
+			if dataPoint.HasSum() {
+				dataPoint.SetSum(sum - series.sum)
+			}
+			for i := range bucketCounts {
+				dataPoint.BucketCounts().SetAt(i, bucketCounts[i]-series.bucketCounts[i])
+			}
+			// min and max of the interval are unknown
+			dataPoint.RemoveMin()
+			dataPoint.RemoveMax()
+		}
+	} else if dataPoint.StartTimestamp() == 0 {
+		dataPoint.SetStartTimestamp(series.start)
+	}
+
+	series.last = dataPoint.Timestamp()
+	series.count, series.sum = count, sum
+	series.bucketCounts, series.explicitBounds = bucketCounts, explicitBounds
+	return true
+}
@@ -0,0 +1,149 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func addCounterPoint(t *testing.T, c *influx2otel.LineProtocolToOtelMetrics, value float64, ts int64) pmetric.NumberDataPoint {
+	t.Helper()
+	b := c.NewBatch()
+	err := b.AddPoint("http_requests_total",
+		map[string]string{"method": "post"},
+		map[string]interface{}{"counter": value},
+		time.Unix(0, ts),
+		common.InfluxMetricValueTypeSum)
+	require.NoError(t, err)
+	metrics := b.GetMetrics()
+	if metrics.DataPointCount() == 0 {
+		return pmetric.NewNumberDataPoint()
+	}
+	metric := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	require.Equal(t, pmetric.MetricTypeSum, metric.Type())
+	require.Equal(t, 1, metric.Sum().DataPoints().Len())
+	return metric.Sum().DataPoints().At(0)
+}
+
+func TestCumulative_inferStartTime(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.Cumulative = influx2otel.CumulativeInferStartTime
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	dp := addCounterPoint(t, c, 10, 1000)
+	assert.Equal(t, pcommon.Timestamp(1000), dp.StartTimestamp())
+	assert.Equal(t, float64(10), dp.DoubleValue())
+
+	dp = addCounterPoint(t, c, 15, 2000)
+	assert.Equal(t, pcommon.Timestamp(1000), dp.StartTimestamp())
+	assert.Equal(t, float64(15), dp.DoubleValue())
+
+	// counter reset
+	dp = addCounterPoint(t, c, 3, 3000)
+	assert.Equal(t, pcommon.Timestamp(2000), dp.StartTimestamp())
+	assert.Equal(t, float64(3), dp.DoubleValue())
+
+	dp = addCounterPoint(t, c, 4, 4000)
+	assert.Equal(t, pcommon.Timestamp(2000), dp.StartTimestamp())
+}
+
+func TestCumulative_toDelta(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.Cumulative = influx2otel.CumulativeToDelta
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("http_requests_total",
+		map[string]string{"method": "post"},
+		map[string]interface{}{"counter": float64(10)},
+		time.Unix(0, 1000),
+		common.InfluxMetricValueTypeSum)
+	require.NoError(t, err)
+	assert.Equal(t, 0, b.GetMetrics().DataPointCount())
+
+	b = c.NewBatch()
+	err = b.AddPoint("http_requests_total",
+		map[string]string{"method": "post"},
+		map[string]interface{}{"counter": float64(15)},
+		time.Unix(0, 2000),
+		common.InfluxMetricValueTypeSum)
+	require.NoError(t, err)
+	err = b.AddPoint("http_requests_total",
+		map[string]string{"method": "post"},
+		map[string]interface{}{"counter": float64(3)},
+		time.Unix(0, 3000),
+		common.InfluxMetricValueTypeSum)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http_requests_total")
+	m.SetEmptySum()
+	m.Sum().SetIsMonotonic(true)
+	m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("method", "post")
+	dp.SetStartTimestamp(pcommon.Timestamp(1000))
+	dp.SetTimestamp(pcommon.Timestamp(2000))
+	dp.SetDoubleValue(5)
+	dp = m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("method", "post")
+	dp.SetStartTimestamp(pcommon.Timestamp(2000))
+	dp.SetTimestamp(pcommon.Timestamp(3000))
+	dp.SetDoubleValue(3)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestCumulative_histogramToDelta(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.Cumulative = influx2otel.CumulativeToDelta
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	addHistogram := func(count, sum, bucket float64, ts int64) pmetric.Metrics {
+		b := c.NewBatch()
+		err := b.AddPoint("http_request_duration_seconds",
+			map[string]string{},
+			map[string]interface{}{"count": count, "sum": sum, "0.5": bucket},
+			time.Unix(0, ts),
+			common.InfluxMetricValueTypeHistogram)
+		require.NoError(t, err)
+		return b.GetMetrics()
+	}
+
+	assert.Equal(t, 0, addHistogram(10, 4, 8, 1000).DataPointCount())
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(pcommon.Timestamp(1000))
+	dp.SetTimestamp(pcommon.Timestamp(2000))
+	dp.SetCount(5)
+	dp.SetSum(2)
+	dp.BucketCounts().FromRaw([]uint64{3, 2})
+	dp.ExplicitBounds().FromRaw([]float64{0.5})
+
+	assertMetricsEqual(t, expect, addHistogram(15, 6, 11, 2000))
+}
+
+func TestCumulative_invalid(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.Cumulative = influx2otel.CumulativeInferStartTime
+	config.CumulativeSeriesTTL = -time.Second
+	_, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package influx2otel
+
+import (
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// DistributionConversion selects the OTLP metric type of untyped Telegraf Prometheus points
+// that could be either histograms or summaries.
+type DistributionConversion uint8
+
+const (
+	// DistributionsAsHistogram converts ambiguous points to histograms.
+	// Summary quantiles become explicit bounds, and quantile values become bucket counts.
+	DistributionsAsHistogram DistributionConversion = iota
+	// DistributionsAsSummary converts ambiguous points to summaries.
+	// Prometheus v2 lines tagged "le" are always converted to histograms.
+	DistributionsAsSummary
+)
+
+func (c DistributionConversion) String() string {
+	switch c {
+	case DistributionsAsHistogram:
+		return "histogram"
+	case DistributionsAsSummary:
+		return "summary"
+	default:
+		panic("invalid DistributionConversion")
+	}
+}
+
+// convertSummaryToHistogram converts a summary metric that has no quantiles to a histogram metric,
+// keeping the count and sum of each data point.
+// This happens when a Prometheus v2 count and sum line, converted to a summary, is followed by bucket lines.
+// Returns false if any data point has quantiles.
+func (b *MetricsBatch) convertSummaryToHistogram(metric pmetric.Metric, temporality pmetric.AggregationTemporality) bool {
+	summaryDataPoints := metric.Summary().DataPoints()
+	for i := 0; i < summaryDataPoints.Len(); i++ {
+		if summaryDataPoints.At(i).QuantileValues().Len() > 0 {
+			return false
+		}
+	}
+
+	histogramDataPoints := pmetric.NewHistogramDataPointSlice()
+	for i := 0; i < summaryDataPoints.Len(); i++ {
+		summaryDataPoint := summaryDataPoints.At(i)
+		h := &histogramDataPointV2{
+			metric:    metric,
+			dataPoint: histogramDataPoints.AppendEmpty(),
+			hasCount:  true,
+		}
+		summaryDataPoint.Attributes().CopyTo(h.dataPoint.Attributes())
+		h.dataPoint.SetStartTimestamp(summaryDataPoint.StartTimestamp())
+		h.dataPoint.SetTimestamp(summaryDataPoint.Timestamp())
+		h.dataPoint.SetCount(summaryDataPoint.Count())
+		h.dataPoint.SetSum(summaryDataPoint.Sum())
+		b.histogramDataPointsByMDPK[metric][newDataPointKey(h.dataPoint.Timestamp().AsTime(), h.dataPoint.Attributes())] = h
+		b.histogramDataPointsV2 = append(b.histogramDataPointsV2, h)
+	}
+
+	metric.SetEmptyHistogram().SetAggregationTemporality(temporality)
+	histogramDataPoints.MoveAndAppendTo(metric.Histogram().DataPoints())
+	b.summaryDataPointsByMDPK[metric] = make(map[dataPointKey]pmetric.SummaryDataPoint)
+	return true
+}
@@ -0,0 +1,118 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func newDistributionsAsSummaryBatch(t *testing.T) *influx2otel.MetricsBatch {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.AmbiguousDistributions = influx2otel.DistributionsAsSummary
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+	return c.NewBatch()
+}
+
+func TestAmbiguousDistributions_v1Summary(t *testing.T) {
+	b := newDistributionsAsSummaryBatch(t)
+	err := b.AddPoint("rpc_duration_seconds",
+		map[string]string{},
+		map[string]interface{}{
+			"count": float64(2693),
+			"sum":   float64(17560473),
+			"0.5":   float64(4773),
+			"0.99":  float64(76656),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("rpc_duration_seconds")
+	m.SetEmptySummary()
+	dp := m.Summary().DataPoints().AppendEmpty()
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetCount(2693)
+	dp.SetSum(17560473)
+	qv := dp.QuantileValues().AppendEmpty()
+	qv.SetQuantile(0.5)
+	qv.SetValue(4773)
+	qv = dp.QuantileValues().AppendEmpty()
+	qv.SetQuantile(0.99)
+	qv.SetValue(76656)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAmbiguousDistributions_v2HistogramAfterCountSum(t *testing.T) {
+	b := newDistributionsAsSummaryBatch(t)
+	ts := time.Unix(0, 1395066363000000123)
+	err := b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{},
+		map[string]interface{}{
+			"http_request_duration_seconds_count": float64(144320),
+			"http_request_duration_seconds_sum":   float64(53423),
+		},
+		ts,
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+	for le, count := range map[string]float64{"0.05": 24054, "+Inf": 144320} {
+		err = b.AddPoint(common.MeasurementPrometheus,
+			map[string]string{"le": le},
+			map[string]interface{}{"http_request_duration_seconds_bucket": count},
+			ts,
+			common.InfluxMetricValueTypeUntyped)
+		require.NoError(t, err)
+	}
+
+	metrics := b.GetMetrics()
+	require.Equal(t, 1, metrics.DataPointCount())
+	m := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	require.Equal(t, pmetric.MetricTypeHistogram, m.Type())
+	dp := m.Histogram().DataPoints().At(0)
+	assert.Equal(t, uint64(144320), dp.Count())
+	assert.Equal(t, float64(53423), dp.Sum())
+	assert.Equal(t, []uint64{24054, 120266}, dp.BucketCounts().AsRaw())
+	assert.Equal(t, []float64{0.05}, dp.ExplicitBounds().AsRaw())
+}
+
+func TestAmbiguousDistributions_v2HistogramBeforeCountSum(t *testing.T) {
+	b := newDistributionsAsSummaryBatch(t)
+	ts := time.Unix(0, 1395066363000000123)
+	for _, le := range []string{"0.05", "+Inf"} {
+		err := b.AddPoint(common.MeasurementPrometheus,
+			map[string]string{"le": le},
+			map[string]interface{}{"http_request_duration_seconds_bucket": map[string]float64{"0.05": 24054, "+Inf": 144320}[le]},
+			ts,
+			common.InfluxMetricValueTypeUntyped)
+		require.NoError(t, err)
+	}
+	err := b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{},
+		map[string]interface{}{
+			"http_request_duration_seconds_count": float64(144320),
+			"http_request_duration_seconds_sum":   float64(53423),
+		},
+		ts,
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err, "the count and sum line belongs to the histogram")
+
+	metrics := b.GetMetrics()
+	require.Equal(t, 1, metrics.DataPointCount())
+	m := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	require.Equal(t, pmetric.MetricTypeHistogram, m.Type())
+	dp := m.Histogram().DataPoints().At(0)
+	assert.Equal(t, uint64(144320), dp.Count())
+	assert.Equal(t, float64(53423), dp.Sum())
+	assert.Equal(t, []uint64{24054, 120266}, dp.BucketCounts().AsRaw())
+}
@@ -0,0 +1,238 @@
+package influx2otel
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// exemplar is an exemplar point, as written by otel2influx, that has not yet been attached to a data point.
+// Exemplar points carry neither resource tags nor data point attributes,
+// so they can only be matched to data points once the batch is complete.
+type exemplar struct {
+	metricName string
+	tags       map[string]string
+	ts         time.Time
+	traceID    pcommon.TraceID
+	spanID     pcommon.SpanID
+	// isInt selects intValue over floatValue, so that an exemplar always has a value.
+	isInt      bool
+	floatValue float64
+	intValue   int64
+}
+
+// isExemplarPoint reports whether a point matches the exemplar layout written by otel2influx:
+// measurement "<metric>_exemplar", with tags trace_id and span_id.
+func isExemplarPoint(measurement string, tags map[string]string) bool {
+	if !strings.HasSuffix(measurement, common.MetricExemplarSuffix) || measurement == common.MetricExemplarSuffix {
+		return false
+	}
+	_, foundTraceID := tags[common.AttributeTraceID]
+	_, foundSpanID := tags[common.AttributeSpanID]
+	return foundTraceID && foundSpanID
+}
+
+func (b *MetricsBatch) addExemplar(measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	e := exemplar{
+		metricName: strings.TrimSuffix(measurement, common.MetricExemplarSuffix),
+		tags:       make(map[string]string, len(tags)),
+		ts:         ts,
+	}
+	if e.ts.IsZero() {
+		e.ts = time.Now()
+	}
+
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
+		switch k {
+		case common.AttributeTraceID:
+			traceID, err := hex.DecodeString(v)
+			if err != nil || len(traceID) != len(e.traceID) {
+				return fmt.Errorf("invalid exemplar trace ID '%s'", v)
+			}
+			copy(e.traceID[:], traceID)
+		case common.AttributeSpanID:
+			spanID, err := hex.DecodeString(v)
+			if err != nil || len(spanID) != len(e.spanID) {
+				return fmt.Errorf("invalid exemplar span ID '%s'", v)
+			}
+			copy(e.spanID[:], spanID)
+		default:
+			e.tags[k] = v
+		}
+	}
+
+	fieldValue, found := fields[common.MetricGaugeFieldKey]
+	if !found {
+		return fmt.Errorf("exemplar value field '%s' not found", common.MetricGaugeFieldKey)
+	}
+	switch typedValue := fieldValue.(type) {
+	case float64:
+		e.floatValue = typedValue
+	case int64:
+		e.isInt, e.intValue = true, typedValue
+	case uint64:
+		e.isInt, e.intValue = true, int64(typedValue)
+	default:
+		return fmt.Errorf("unsupported exemplar value type %T", fieldValue)
+	}
+
+	b.exemplars = append(b.exemplars, e)
+	return nil
+}
+
+// exemplarSeries identifies the time series that a data point belongs to.
+type exemplarSeries struct {
+	resource   [16]byte
+	scope      string
+	attributes [16]byte
+}
+
+// exemplarCandidate is a data point that an exemplar may be attached to.
+type exemplarCandidate struct {
+	series     exemplarSeries
+	timestamp  pcommon.Timestamp
+	attributes pcommon.Map
+	exemplars  pmetric.ExemplarSlice
+}
+
+// exemplarMetric is a metric, and the resource and scope that it belongs to.
+type exemplarMetric struct {
+	resource [16]byte
+	scope    string
+	metric   pmetric.Metric
+}
+
+// attachExemplars moves pending exemplars to the data points of the matching gauge, sum, or histogram.
+// Exemplars that cannot be matched to exactly one time series in this batch are dropped.
+func (b *MetricsBatch) attachExemplars() {
+	if len(b.exemplars) == 0 {
+		return
+	}
+
+	metricsByName := make(map[string][]exemplarMetric)
+	for i := 0; i < b.metrics.ResourceMetrics().Len(); i++ {
+		resourceMetrics := b.metrics.ResourceMetrics().At(i)
+		rKey := pdatautil.MapHash(resourceMetrics.Resource().Attributes())
+		for j := 0; j < resourceMetrics.ScopeMetrics().Len(); j++ {
+			isMetrics := resourceMetrics.ScopeMetrics().At(j)
+			ilmKey := isMetrics.Scope().Name() + ":" + isMetrics.Scope().Version()
+			for k := 0; k < isMetrics.Metrics().Len(); k++ {
+				metric := isMetrics.Metrics().At(k)
+				metricsByName[metric.Name()] = append(metricsByName[metric.Name()], exemplarMetric{rKey, ilmKey, metric})
+			}
+		}
+	}
+
+	for _, e := range b.exemplars {
+		var candidates []exemplarCandidate
+		for _, metric := range metricsByName[e.metricName] {
+			candidates = appendExemplarCandidates(candidates, metric)
+		}
+		candidate, found := selectExemplarCandidate(candidates, e)
+		if !found {
+			b.logger.Debug("dropping exemplar without exactly one matching time series", "metric", e.metricName)
+			continue
+		}
+
+		ex := candidate.exemplars.AppendEmpty()
+		ex.SetTimestamp(pcommon.NewTimestampFromTime(e.ts))
+		ex.SetTraceID(e.traceID)
+		ex.SetSpanID(e.spanID)
+		for _, k := range sortedKeys(e.tags) {
+			v := e.tags[k]
+			if _, found := candidate.attributes.Get(k); !found {
+				ex.FilteredAttributes().PutStr(k, v)
+			}
+		}
+		if e.isInt {
+			ex.SetIntValue(e.intValue)
+		} else {
+			ex.SetDoubleValue(e.floatValue)
+		}
+	}
+
+	b.exemplars = b.exemplars[:0]
+}
+
+func appendExemplarCandidates(candidates []exemplarCandidate, m exemplarMetric) []exemplarCandidate {
+	newCandidate := func(timestamp pcommon.Timestamp, attributes pcommon.Map, exemplars pmetric.ExemplarSlice) exemplarCandidate {
+		series := exemplarSeries{m.resource, m.scope, pdatautil.MapHash(attributes)}
+		return exemplarCandidate{series, timestamp, attributes, exemplars}
+	}
+	switch m.metric.Type() {
+	case pmetric.MetricTypeGauge:
+		for i := 0; i < m.metric.Gauge().DataPoints().Len(); i++ {
+			dataPoint := m.metric.Gauge().DataPoints().At(i)
+			candidates = append(candidates, newCandidate(dataPoint.Timestamp(), dataPoint.Attributes(), dataPoint.Exemplars()))
+		}
+	case pmetric.MetricTypeSum:
+		for i := 0; i < m.metric.Sum().DataPoints().Len(); i++ {
+			dataPoint := m.metric.Sum().DataPoints().At(i)
+			candidates = append(candidates, newCandidate(dataPoint.Timestamp(), dataPoint.Attributes(), dataPoint.Exemplars()))
+		}
+	case pmetric.MetricTypeHistogram:
+		for i := 0; i < m.metric.Histogram().DataPoints().Len(); i++ {
+			dataPoint := m.metric.Histogram().DataPoints().At(i)
+			candidates = append(candidates, newCandidate(dataPoint.Timestamp(), dataPoint.Attributes(), dataPoint.Exemplars()))
+		}
+	}
+	return candidates
+}
+
+// selectExemplarCandidate chooses the data point for an exemplar.
+// Data points whose attributes all appear in the exemplar tags are preferred.
+// Exemplar points carry no resource tags, so if the chosen data points belong to more than one time series,
+// the exemplar is ambiguous and no data point is selected.
+// Among the chosen data points, an exemplar belongs to the earliest data point at or after the exemplar timestamp,
+// because exemplars are recorded during the interval that the data point closes;
+// if no such data point exists, the latest data point is chosen.
+func selectExemplarCandidate(candidates []exemplarCandidate, e exemplar) (exemplarCandidate, bool) {
+	var matching []exemplarCandidate
+	for _, candidate := range candidates {
+		isMatch := true
+		candidate.attributes.Range(func(k string, v pcommon.Value) bool {
+			if tagValue, found := e.tags[k]; !found || tagValue != v.AsString() {
+				isMatch = false
+			}
+			return isMatch
+		})
+		if isMatch {
+			matching = append(matching, candidate)
+		}
+	}
+	if len(matching) == 0 {
+		matching = candidates
+	}
+	if len(matching) == 0 {
+		return exemplarCandidate{}, false
+	}
+	for _, candidate := range matching[1:] {
+		if candidate.series != matching[0].series {
+			return exemplarCandidate{}, false
+		}
+	}
+
+	ts := pcommon.NewTimestampFromTime(e.ts)
+	var after, latest *exemplarCandidate
+	for i := range matching {
+		candidate := &matching[i]
+		if candidate.timestamp >= ts && (after == nil || candidate.timestamp < after.timestamp) {
+			after = candidate
+		}
+		if latest == nil || candidate.timestamp > latest.timestamp {
+			latest = candidate
+		}
+	}
+	if after != nil {
+		return *after, true
+	}
+	return *latest, true
+}
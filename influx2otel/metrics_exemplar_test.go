@@ -0,0 +1,200 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestAddPoint_v1_gaugeExemplar(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cache_age_seconds",
+		map[string]string{
+			"container.name": "42",
+			"engine_id":      "0",
+		},
+		map[string]interface{}{
+			"gauge": float64(23.9),
+		},
+		time.Unix(0, 1395066363000000123).UTC(),
+		common.InfluxMetricValueTypeGauge)
+	require.NoError(t, err)
+
+	err = b.AddPoint("cache_age_seconds_exemplar",
+		map[string]string{
+			"trace_id": "000102030405060708090a0b0c0d0e0f",
+			"span_id":  "0001020304050607",
+			"user_id":  "alice",
+		},
+		map[string]interface{}{
+			"gauge": float64(23.7),
+		},
+		time.Unix(0, 1395066362000000123).UTC(),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("container.name", "42")
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("cache_age_seconds")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("engine_id", "0")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetDoubleValue(23.9)
+	exemplar := dp.Exemplars().AppendEmpty()
+	exemplar.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066362000000123)))
+	exemplar.SetTraceID([16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	exemplar.SetSpanID([8]byte{0, 1, 2, 3, 4, 5, 6, 7})
+	exemplar.FilteredAttributes().PutStr("user_id", "alice")
+	exemplar.SetDoubleValue(23.7)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAddPoint_v2_histogramExemplar(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	// The exemplar point may precede the data point it belongs to.
+	err = b.AddPoint("http_request_duration_seconds_exemplar",
+		map[string]string{
+			"trace_id": "000102030405060708090a0b0c0d0e0f",
+			"span_id":  "0001020304050607",
+		},
+		map[string]interface{}{
+			"gauge": int64(3),
+		},
+		time.Unix(0, 1395066362000000123).UTC(),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	err = b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{
+			"container.name": "42",
+			"method":         "post",
+		},
+		map[string]interface{}{
+			"http_request_duration_seconds_count": float64(144320),
+			"http_request_duration_seconds_sum":   float64(53423),
+		},
+		time.Unix(0, 1395066363000000123).UTC(),
+		common.InfluxMetricValueTypeHistogram)
+	require.NoError(t, err)
+
+	err = b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{
+			"container.name": "42",
+			"method":         "post",
+			"le":             "1",
+		},
+		map[string]interface{}{
+			"http_request_duration_seconds_bucket": float64(133988),
+		},
+		time.Unix(0, 1395066363000000123).UTC(),
+		common.InfluxMetricValueTypeHistogram)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("container.name", "42")
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("method", "post")
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+	dp.SetCount(144320)
+	dp.SetSum(53423)
+	dp.BucketCounts().FromRaw([]uint64{133988, 10332})
+	dp.ExplicitBounds().FromRaw([]float64{1})
+	exemplar := dp.Exemplars().AppendEmpty()
+	exemplar.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066362000000123)))
+	exemplar.SetTraceID([16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	exemplar.SetSpanID([8]byte{0, 1, 2, 3, 4, 5, 6, 7})
+	exemplar.SetIntValue(3)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAddPoint_exemplarAmbiguousSeries(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	for _, containerName := range []string{"42", "43"} {
+		err = b.AddPoint("cache_age_seconds",
+			map[string]string{
+				"container.name": containerName,
+				"engine_id":      "0",
+			},
+			map[string]interface{}{
+				"gauge": float64(23.9),
+			},
+			time.Unix(0, 1395066363000000123).UTC(),
+			common.InfluxMetricValueTypeGauge)
+		require.NoError(t, err)
+	}
+
+	err = b.AddPoint("cache_age_seconds_exemplar",
+		map[string]string{
+			"trace_id": "000102030405060708090a0b0c0d0e0f",
+			"span_id":  "0001020304050607",
+		},
+		map[string]interface{}{
+			"gauge": float64(23.7),
+		},
+		time.Unix(0, 1395066362000000123).UTC(),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	for _, containerName := range []string{"42", "43"} {
+		rm := expect.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("container.name", containerName)
+		m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("cache_age_seconds")
+		m.SetEmptyGauge()
+		dp := m.Gauge().DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("engine_id", "0")
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(time.Unix(0, 1395066363000000123)))
+		dp.SetDoubleValue(23.9)
+	}
+
+	// The exemplar could belong to either resource, so it is dropped.
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestAddPoint_exemplarInvalidTraceID(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cache_age_seconds_exemplar",
+		map[string]string{
+			"trace_id": "not-a-trace-id",
+			"span_id":  "0001020304050607",
+		},
+		map[string]interface{}{
+			"gauge": float64(23.7),
+		},
+		time.Unix(0, 1395066362000000123).UTC(),
+		common.InfluxMetricValueTypeUntyped)
+	assert.Error(t, err)
+}
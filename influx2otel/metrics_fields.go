@@ -0,0 +1,247 @@
+package influx2otel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// BoolFieldConversion selects how boolean field values are converted.
+type BoolFieldConversion uint8
+
+const (
+	// BoolFieldsDrop drops boolean fields.
+	BoolFieldsDrop BoolFieldConversion = iota
+	// BoolFieldsAsGauge converts boolean fields to integer values 0 (false) and 1 (true).
+	BoolFieldsAsGauge
+)
+
+func (c BoolFieldConversion) String() string {
+	switch c {
+	case BoolFieldsDrop:
+		return "drop"
+	case BoolFieldsAsGauge:
+		return "gauge"
+	default:
+		panic("invalid BoolFieldConversion")
+	}
+}
+
+// StringFieldConversion selects how string field values are converted.
+type StringFieldConversion uint8
+
+const (
+	// StringFieldsDrop drops string fields.
+	StringFieldsDrop StringFieldConversion = iota
+	// StringFieldsAsAttributes adds string fields as attributes to the data points
+	// converted from the numeric fields of the same point.
+	StringFieldsAsAttributes
+	// StringFieldsAsInfoGauge converts the string fields of a point to one gauge
+	// named <measurement>_info, with the string fields as attributes and value 1.
+	StringFieldsAsInfoGauge
+)
+
+func (c StringFieldConversion) String() string {
+	switch c {
+	case StringFieldsDrop:
+		return "drop"
+	case StringFieldsAsAttributes:
+		return "attributes"
+	case StringFieldsAsInfoGauge:
+		return "info-gauge"
+	default:
+		panic("invalid StringFieldConversion")
+	}
+}
+
+const (
+	infoMetricSuffix = "_info"
+	logBodyFieldKey  = "message"
+)
+
+// convertNonNumericFields applies the configured bool and string field conversions to a point.
+// The returned tags and fields are copies when modified.
+// If handled is true, the point was fully converted and needs no further processing.
+func (b *MetricsBatch) convertNonNumericFields(measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) (map[string]string, map[string]interface{}, bool, error) {
+	if b.boolFields == BoolFieldsDrop && b.stringFields == StringFieldsDrop && !b.stringOnlyPointsAsLogs {
+		return tags, fields, false, nil
+	}
+
+	var stringFields map[string]string
+	var hasNumericFields bool
+	var copied bool
+	for k, v := range fields {
+		switch vv := v.(type) {
+		case bool:
+			if b.boolFields != BoolFieldsAsGauge {
+				continue
+			}
+			if !copied {
+				fields = copyFields(fields)
+				copied = true
+			}
+			if vv {
+				fields[k] = int64(1)
+			} else {
+				fields[k] = int64(0)
+			}
+			hasNumericFields = true
+		case string:
+			if k == common.AttributeStartTimeStatsd {
+				continue
+			}
+			if stringFields == nil {
+				stringFields = make(map[string]string)
+			}
+			stringFields[k] = vv
+		default:
+			hasNumericFields = true
+		}
+	}
+	if len(stringFields) == 0 {
+		return tags, fields, false, nil
+	}
+
+	if !hasNumericFields && b.stringOnlyPointsAsLogs {
+		return tags, fields, true, b.addLogRecord(measurement, tags, stringFields, ts)
+	}
+
+	switch b.stringFields {
+	case StringFieldsDrop:
+		return tags, fields, false, nil
+	case StringFieldsAsAttributes:
+		if !hasNumericFields {
+			b.logger.Debug("point has no numeric fields to carry string fields", "measurement", measurement)
+			return tags, fields, true, nil
+		}
+	case StringFieldsAsInfoGauge:
+		if err := b.addInfoGauge(measurement, tags, stringFields, ts); err != nil {
+			return nil, nil, false, err
+		}
+	default:
+		return nil, nil, false, fmt.Errorf("impossible StringFieldConversion %d", b.stringFields)
+	}
+
+	if !copied {
+		fields = copyFields(fields)
+	}
+	for k := range stringFields {
+		delete(fields, k)
+	}
+	if b.stringFields == StringFieldsAsAttributes {
+		newTags := make(map[string]string, len(tags)+len(stringFields))
+		for k, v := range tags {
+			newTags[k] = v
+		}
+		for k, v := range stringFields {
+			if _, found := newTags[k]; !found {
+				newTags[k] = v
+			}
+		}
+		tags = newTags
+	}
+	if !hasNumericFields {
+		return tags, fields, true, nil
+	}
+	return tags, fields, false, nil
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	newFields := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		newFields[k] = v
+	}
+	return newFields
+}
+
+func (b *MetricsBatch) addInfoGauge(measurement string, tags map[string]string, stringFields map[string]string, ts time.Time) error {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	metric, attributes, err := b.lookupMetric(measurement+infoMetricSuffix, tags, common.InfluxMetricValueTypeGauge)
+	if err != nil {
+		return err
+	}
+	dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
+	attributes.CopyTo(dataPoint.Attributes())
+	for _, k := range sortedKeys(stringFields) {
+		v := stringFields[k]
+		if _, found := dataPoint.Attributes().Get(k); !found {
+			dataPoint.Attributes().PutStr(k, v)
+		}
+	}
+	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	dataPoint.SetIntValue(1)
+	return nil
+}
+
+// addLogRecord converts a point having only string fields to a log record.
+// The measurement becomes attribute event.name, the "message" field (if any) becomes the body,
+// and the other string fields become attributes.
+func (b *MetricsBatch) addLogRecord(measurement string, tags map[string]string, stringFields map[string]string, ts time.Time) error {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var ilName, ilVersion string
+	rAttributes := pcommon.NewMap()
+	lAttributes := pcommon.NewMap()
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
+		switch {
+		case k == semconv.OtelLibraryName:
+			ilName = v
+		case k == semconv.OtelLibraryVersion:
+			ilVersion = v
+		case b.resourceAttributes.IsResourceAttribute(k):
+			rAttributes.PutStr(k, v)
+		default:
+			lAttributes.PutStr(k, v)
+		}
+	}
+
+	rKey := pdatautil.MapHash(rAttributes)
+	resourceLogs, found := b.rlByAttributes[rKey]
+	if !found {
+		resourceLogs = b.logs.ResourceLogs().AppendEmpty()
+		rAttributes.CopyTo(resourceLogs.Resource().Attributes())
+		b.rlByAttributes[rKey] = resourceLogs
+		b.slByRLAttributesAndIL[rKey] = make(map[string]plog.ScopeLogs)
+	}
+	ilKey := ilName + ":" + ilVersion
+	scopeLogs, found := b.slByRLAttributesAndIL[rKey][ilKey]
+	if !found {
+		scopeLogs = resourceLogs.ScopeLogs().AppendEmpty()
+		scopeLogs.Scope().SetName(ilName)
+		scopeLogs.Scope().SetVersion(ilVersion)
+		b.slByRLAttributesAndIL[rKey][ilKey] = scopeLogs
+	}
+
+	logRecord := scopeLogs.LogRecords().AppendEmpty()
+	logRecord.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	lAttributes.CopyTo(logRecord.Attributes())
+	logRecord.Attributes().PutStr(semconv.AttributeEventName, measurement)
+	for _, k := range sortedKeys(stringFields) {
+		v := stringFields[k]
+		if k == logBodyFieldKey {
+			logRecord.Body().SetStr(v)
+		} else if _, found := logRecord.Attributes().Get(k); !found {
+			logRecord.Attributes().PutStr(k, v)
+		}
+	}
+	return nil
+}
+
+// GetLogs returns the log records converted from string-only points and empties the batch of log records.
+// Points are converted to log records only when configured with StringOnlyPointsAsLogs.
+func (b *MetricsBatch) GetLogs() plog.Logs {
+	logs := b.logs
+	b.resetLogs()
+	return logs
+}
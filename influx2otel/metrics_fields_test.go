@@ -0,0 +1,178 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatatest/plogtest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestNonNumericFields_default(t *testing.T) {
+	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("net_response",
+		map[string]string{
+			"server": "localhost",
+		},
+		map[string]interface{}{
+			"response_time": float64(0.001),
+			"result":        "success",
+			"ok":            true,
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("net_response_response_time")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("server", "localhost")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0.001)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestNonNumericFields_boolAsGaugeStringAsAttributes(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.BoolFields = influx2otel.BoolFieldsAsGauge
+	config.StringFields = influx2otel.StringFieldsAsAttributes
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("net_response",
+		map[string]string{
+			"server": "localhost",
+		},
+		map[string]interface{}{
+			"response_time": float64(0.001),
+			"result":        "success",
+			"ok":            true,
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("net_response_response_time")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("server", "localhost")
+	dp.Attributes().PutStr("result", "success")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0.001)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("net_response_ok")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("server", "localhost")
+	dp.Attributes().PutStr("result", "success")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(1)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestNonNumericFields_stringAsInfoGauge(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.StringFields = influx2otel.StringFieldsAsInfoGauge
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("systemd_units",
+		map[string]string{
+			"name": "dbus.service",
+		},
+		map[string]interface{}{
+			"load":        "loaded",
+			"active":      "active",
+			"load_code":   int64(0),
+			"active_code": int64(0),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("systemd_units_info")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("name", "dbus.service")
+	dp.Attributes().PutStr("load", "loaded")
+	dp.Attributes().PutStr("active", "active")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(1)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("systemd_units_load_code")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("name", "dbus.service")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(0)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("systemd_units_active_code")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("name", "dbus.service")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(0)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestNonNumericFields_stringOnlyPointsAsLogs(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.StringOnlyPointsAsLogs = true
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("deployment",
+		map[string]string{
+			"service.name": "checkout",
+			"env":          "prod",
+		},
+		map[string]interface{}{
+			"message": "deployed v1.2.3",
+			"version": "v1.2.3",
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expectLogs := plog.NewLogs()
+	rl := expectLogs.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "checkout")
+	lr := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	lr.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	lr.Body().SetStr("deployed v1.2.3")
+	lr.Attributes().PutStr("env", "prod")
+	lr.Attributes().PutStr("event.name", "deployment")
+	lr.Attributes().PutStr("version", "v1.2.3")
+
+	assert.NoError(t, plogtest.CompareLogs(expectLogs, b.GetLogs()))
+	assert.Equal(t, 0, b.GetMetrics().DataPointCount())
+}
@@ -0,0 +1,315 @@
+package influx2otel
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// StatsdTimingConversion selects the OTLP representation of Telegraf statsd timing points.
+type StatsdTimingConversion uint8
+
+const (
+	// StatsdTimingAsSummary converts each timing to a summary data point.
+	// Quantiles are taken from the <p>_percentile, median, lower (0) and upper (1) fields.
+	StatsdTimingAsSummary StatsdTimingConversion = iota
+	// StatsdTimingAsHistogram converts each timing to an approximate histogram data point.
+	// Bucket bounds are the values of the <p>_percentile fields, so the buckets are
+	// configured with the Telegraf statsd input plugin "percentiles" option.
+	// Telegraf does not report bucket counts; they are estimated as p% of count, rounded,
+	// so they are not observed counts and may not add up across intervals.
+	// Use StatsdTimingAsSummary to keep the percentiles exactly as reported.
+	StatsdTimingAsHistogram
+	// StatsdTimingAsGauges converts each timing field to a separate gauge, as with unknown schemas.
+	StatsdTimingAsGauges
+)
+
+func (c StatsdTimingConversion) String() string {
+	switch c {
+	case StatsdTimingAsSummary:
+		return "summary"
+	case StatsdTimingAsHistogram:
+		return "histogram"
+	case StatsdTimingAsGauges:
+		return "gauges"
+	default:
+		panic("invalid StatsdTimingConversion")
+	}
+}
+
+const (
+	statsdMetricTypeTiming = "timing"
+
+	statsdTimingFieldCount       = "count"
+	statsdTimingFieldSum         = "sum"
+	statsdTimingFieldLower       = "lower"
+	statsdTimingFieldUpper       = "upper"
+	statsdTimingFieldMean        = "mean"
+	statsdTimingFieldMedian      = "median"
+	statsdTimingFieldStddev      = "stddev"
+	statsdTimingPercentileSuffix = "_percentile"
+)
+
+var statsdTimingFieldNames = []string{
+	statsdTimingFieldCount,
+	statsdTimingFieldSum,
+	statsdTimingFieldLower,
+	statsdTimingFieldUpper,
+	statsdTimingFieldMean,
+	statsdTimingFieldMedian,
+	statsdTimingFieldStddev,
+}
+
+// statsdTiming holds the statistics of one statsd timing field.
+// The Telegraf statsd input plugin prefixes statistics with the field name
+// when a template assigns more than one field to a measurement.
+type statsdTiming struct {
+	values      map[string]float64
+	percentiles map[float64]float64
+}
+
+func (b *MetricsBatch) addPointStatsdTiming(measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	if b.statsdTiming == StatsdTimingAsGauges {
+		return b.addPointWithUnknownSchema(measurement, tags, fields, ts)
+	}
+
+	timingsByPrefix := make(map[string]*statsdTiming)
+	for k, v := range fields {
+		if k == common.AttributeStartTimeStatsd {
+			continue
+		}
+		floatValue, ok := fieldValueAsFloat64(v)
+		if !ok {
+			b.logger.Debug("statsd timing field has unsupported type", "measurement", measurement, "field", k, "type", fmt.Sprintf("%T", v))
+			continue
+		}
+		prefix, name, percentile, ok := parseStatsdTimingFieldKey(k)
+		if !ok {
+			b.logger.Debug("skipping unrecognized statsd timing field", "measurement", measurement, "field", k)
+			continue
+		}
+		timing, found := timingsByPrefix[prefix]
+		if !found {
+			timing = &statsdTiming{
+				values:      make(map[string]float64),
+				percentiles: make(map[float64]float64),
+			}
+			timingsByPrefix[prefix] = timing
+		}
+		if name == statsdTimingPercentileSuffix {
+			timing.percentiles[percentile] = floatValue
+		} else {
+			timing.values[name] = floatValue
+		}
+	}
+
+	for prefix, timing := range timingsByPrefix {
+		_, foundCount := timing.values[statsdTimingFieldCount]
+		_, foundSum := timing.values[statsdTimingFieldSum]
+		if !foundCount || !foundSum {
+			b.logger.Debug("statsd timing lacks count or sum; converting as unknown schema", "measurement", measurement, "prefix", prefix)
+			return b.addPointWithUnknownSchema(measurement, tags, fields, ts)
+		}
+	}
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var startTime time.Time
+	if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
+		if startTimeStr, ok := startTimeObj.(string); ok {
+			if t, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
+				startTime = t
+			}
+		}
+	}
+
+	for _, prefix := range sortedKeys(timingsByPrefix) {
+		timing := timingsByPrefix[prefix]
+		metricName := measurement
+		if prefix != "" {
+			metricName = measurement + "_" + prefix
+		}
+
+		var err error
+		switch b.statsdTiming {
+		case StatsdTimingAsSummary:
+			err = b.convertStatsdTimingSummary(metricName, tags, timing, ts, startTime)
+		case StatsdTimingAsHistogram:
+			err = b.convertStatsdTimingHistogram(metricName, tags, timing, ts, startTime)
+		default:
+			err = fmt.Errorf("impossible StatsdTimingConversion %d", b.statsdTiming)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseStatsdTimingFieldKey splits a statsd timing field key into field prefix and statistic name.
+// For percentile fields, name is statsdTimingPercentileSuffix and percentile is set.
+func parseStatsdTimingFieldKey(k string) (prefix, name string, percentile float64, ok bool) {
+	if strings.HasSuffix(k, statsdTimingPercentileSuffix) {
+		s := strings.TrimSuffix(k, statsdTimingPercentileSuffix)
+		if i := strings.LastIndexByte(s, '_'); i >= 0 {
+			prefix, s = s[:i], s[i+1:]
+		}
+		p, err := strconv.ParseFloat(s, 64)
+		if err != nil || p < 0 || p > 100 {
+			return "", "", 0, false
+		}
+		return prefix, statsdTimingPercentileSuffix, p, true
+	}
+	for _, name := range statsdTimingFieldNames {
+		if k == name {
+			return "", name, 0, true
+		}
+		if strings.HasSuffix(k, "_"+name) {
+			return strings.TrimSuffix(k, "_"+name), name, 0, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func (b *MetricsBatch) convertStatsdTimingSummary(metricName string, tags map[string]string, timing *statsdTiming, ts, startTime time.Time) error {
+	metric, attributes, err := b.lookupMetric(metricName, tags, common.InfluxMetricValueTypeSummary)
+	if err != nil {
+		return err
+	}
+	dataPoint := b.appendSummaryDataPoint(metric.Summary().DataPoints())
+	attributes.CopyTo(dataPoint.Attributes())
+	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	if !startTime.IsZero() {
+		dataPoint.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+	}
+	dataPoint.SetCount(uint64(timing.values[statsdTimingFieldCount]))
+	dataPoint.SetSum(timing.values[statsdTimingFieldSum])
+
+	valuesByQuantile := make(map[float64]float64, len(timing.percentiles)+3)
+	if lower, found := timing.values[statsdTimingFieldLower]; found {
+		valuesByQuantile[0] = lower
+	}
+	if median, found := timing.values[statsdTimingFieldMedian]; found {
+		valuesByQuantile[0.5] = median
+	}
+	if upper, found := timing.values[statsdTimingFieldUpper]; found {
+		valuesByQuantile[1] = upper
+	}
+	for percentile, value := range timing.percentiles {
+		valuesByQuantile[percentile/100] = value
+	}
+	quantiles := make([]float64, 0, len(valuesByQuantile))
+	for quantile := range valuesByQuantile {
+		quantiles = append(quantiles, quantile)
+	}
+	sort.Float64s(quantiles)
+	for _, quantile := range quantiles {
+		valueAtQuantile := dataPoint.QuantileValues().AppendEmpty()
+		valueAtQuantile.SetQuantile(quantile)
+		valueAtQuantile.SetValue(valuesByQuantile[quantile])
+	}
+
+	return b.convertStatsdTimingStddev(metricName, tags, timing, ts, startTime)
+}
+
+func (b *MetricsBatch) convertStatsdTimingHistogram(metricName string, tags map[string]string, timing *statsdTiming, ts, startTime time.Time) error {
+	count := uint64(timing.values[statsdTimingFieldCount])
+
+	percentiles := make([]float64, 0, len(timing.percentiles))
+	for percentile := range timing.percentiles {
+		percentiles = append(percentiles, percentile)
+	}
+	sort.Float64s(percentiles)
+
+	// Percentile p at value v means that about p% of observations are <= v,
+	// which approximates a cumulative bucket count with explicit bound v.
+	// The statsd percentile algorithm interpolates and rounds, so these counts are estimates.
+	var explicitBounds []float64
+	var bucketCounts []uint64
+	for _, percentile := range percentiles {
+		bound := timing.percentiles[percentile]
+		cumulativeCount := uint64(math.Round(percentile / 100 * float64(count)))
+		if n := len(explicitBounds); n > 0 && bound <= explicitBounds[n-1] {
+			// Percentile values are not strictly increasing; merge into the previous bucket.
+			if cumulativeCount > bucketCounts[n-1] {
+				bucketCounts[n-1] = cumulativeCount
+			}
+			continue
+		}
+		explicitBounds = append(explicitBounds, bound)
+		bucketCounts = append(bucketCounts, cumulativeCount)
+	}
+	bucketCounts = append(bucketCounts, count)
+	for i := len(bucketCounts) - 1; i > 0; i-- {
+		if bucketCounts[i] < bucketCounts[i-1] {
+			return fmt.Errorf("statsd timing percentile counts are not monotonic for metric '%s'", metricName)
+		}
+		bucketCounts[i] -= bucketCounts[i-1]
+	}
+
+	metric, attributes, err := b.lookupMetric(metricName, tags, common.InfluxMetricValueTypeHistogram)
+	if err != nil {
+		return err
+	}
+	dataPoint := b.appendHistogramDataPoint(metric.Histogram().DataPoints())
+	attributes.CopyTo(dataPoint.Attributes())
+	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	if !startTime.IsZero() {
+		dataPoint.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+	}
+	dataPoint.SetCount(count)
+	dataPoint.SetSum(timing.values[statsdTimingFieldSum])
+	if lower, found := timing.values[statsdTimingFieldLower]; found {
+		dataPoint.SetMin(lower)
+	}
+	if upper, found := timing.values[statsdTimingFieldUpper]; found {
+		dataPoint.SetMax(upper)
+	}
+	dataPoint.ExplicitBounds().FromRaw(explicitBounds)
+	dataPoint.BucketCounts().FromRaw(bucketCounts)
+
+	return b.convertStatsdTimingStddev(metricName, tags, timing, ts, startTime)
+}
+
+// convertStatsdTimingStddev emits the standard deviation, which neither summary nor histogram can carry, as a gauge.
+// The mean is not emitted because it is derived from sum and count.
+func (b *MetricsBatch) convertStatsdTimingStddev(metricName string, tags map[string]string, timing *statsdTiming, ts, startTime time.Time) error {
+	stddev, found := timing.values[statsdTimingFieldStddev]
+	if !found {
+		return nil
+	}
+	metric, attributes, err := b.lookupMetric(metricName+"_"+statsdTimingFieldStddev, tags, common.InfluxMetricValueTypeGauge)
+	if err != nil {
+		return err
+	}
+	dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
+	attributes.CopyTo(dataPoint.Attributes())
+	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	if !startTime.IsZero() {
+		dataPoint.SetStartTimestamp(pcommon.NewTimestampFromTime(startTime))
+	}
+	dataPoint.SetDoubleValue(stddev)
+	return nil
+}
+
+func fieldValueAsFloat64(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, true
+	case int64:
+		return float64(vv), true
+	case uint64:
+		return float64(vv), true
+	default:
+		return 0, false
+	}
+}
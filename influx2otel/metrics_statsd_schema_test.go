@@ -17,6 +17,109 @@ func TestStatsdTimingSchema(t *testing.T) {
 	c, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
 	require.NoError(t, err)
 
+	b := c.NewBatch()
+	err = b.AddPoint("test_service_stage_metrics_biz_success_v4",
+		map[string]string{
+			"metric_type": "timing",
+			"type":        "app",
+		},
+		map[string]interface{}{
+			"90_percentile": float64(18),
+			"99_percentile": float64(20),
+			"count":         int64(10),
+			"lower":         float64(10),
+			"mean":          float64(10),
+			"median":        float64(10),
+			"stddev":        float64(10),
+			"sum":           float64(100),
+			"upper":         float64(20),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("test_service_stage_metrics_biz_success_v4")
+	m.SetEmptySummary()
+	dp := m.Summary().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("metric_type", "timing")
+	dp.Attributes().PutStr("type", "app")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetCount(10)
+	dp.SetSum(100)
+	for _, qv := range [][2]float64{{0, 10}, {0.5, 10}, {0.9, 18}, {0.99, 20}, {1, 20}} {
+		valueAtQuantile := dp.QuantileValues().AppendEmpty()
+		valueAtQuantile.SetQuantile(qv[0])
+		valueAtQuantile.SetValue(qv[1])
+	}
+
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("test_service_stage_metrics_biz_success_v4_stddev")
+	m.SetEmptyGauge()
+	gdp := m.Gauge().DataPoints().AppendEmpty()
+	gdp.Attributes().PutStr("metric_type", "timing")
+	gdp.Attributes().PutStr("type", "app")
+	gdp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	gdp.SetDoubleValue(10)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestStatsdTimingSchema_histogram(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.StatsdTiming = influx2otel.StatsdTimingAsHistogram
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("test_service_stage_metrics_biz_success_v4",
+		map[string]string{
+			"metric_type": "timing",
+			"type":        "app",
+		},
+		map[string]interface{}{
+			"50_percentile": float64(10),
+			"90_percentile": float64(18),
+			"count":         int64(10),
+			"lower":         float64(5),
+			"mean":          float64(10),
+			"sum":           float64(100),
+			"upper":         float64(20),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("test_service_stage_metrics_biz_success_v4")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("metric_type", "timing")
+	dp.Attributes().PutStr("type", "app")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetCount(10)
+	dp.SetSum(100)
+	dp.SetMin(5)
+	dp.SetMax(20)
+	dp.ExplicitBounds().FromRaw([]float64{10, 18})
+	dp.BucketCounts().FromRaw([]uint64{5, 4, 1})
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestStatsdTimingSchema_gauges(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.StatsdTiming = influx2otel.StatsdTimingAsGauges
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
 	b := c.NewBatch()
 	err = b.AddPoint("test_service_stage_metrics_biz_success_v4",
 		map[string]string{
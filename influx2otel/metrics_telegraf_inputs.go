@@ -0,0 +1,330 @@
+package influx2otel
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// TelegrafFieldMapping maps one field of a Telegraf input plugin measurement to an OpenTelemetry metric.
+type TelegrafFieldMapping struct {
+	// MetricName is the OpenTelemetry metric name, for example "system.cpu.utilization".
+	MetricName string
+	// Unit is the UCUM unit of the metric, after Scale is applied.
+	Unit string
+	// ValueType is common.InfluxMetricValueTypeGauge or common.InfluxMetricValueTypeSum.
+	ValueType common.InfluxMetricValueType
+	// IsMonotonic applies to sums only; non-monotonic sums correspond to OpenTelemetry UpDownCounters.
+	IsMonotonic bool
+	// Attributes are added to every data point, for example {"state": "user"}.
+	Attributes map[string]string
+	// Scale multiplies the field value, for example 0.01 to convert percent to ratio.
+	// Zero means no scaling.
+	Scale float64
+}
+
+// TelegrafMeasurementMapping maps a Telegraf input plugin measurement to OpenTelemetry metrics.
+// Fields without a mapping are converted as if no mapping existed.
+type TelegrafMeasurementMapping struct {
+	// Fields maps field keys to metrics.
+	Fields map[string]TelegrafFieldMapping
+	// TagRenames maps tag keys to attribute keys, for example {"interface": "device"}.
+	// Tags not listed are kept as-is.
+	TagRenames map[string]string
+}
+
+// TelegrafMappings maps Telegraf measurement names to OpenTelemetry metrics.
+type TelegrafMappings map[string]*TelegrafMeasurementMapping
+
+// DefaultTelegrafMappings returns mappings for common Telegraf input plugins
+// (cpu, mem, disk, diskio, net, system, processes, docker) to OpenTelemetry system and container metrics,
+// following the semantic conventions and the attribute names used by the collector hostmetrics receiver.
+//
+// The returned value is a new copy, so it can be modified and extended with custom mappings.
+func DefaultTelegrafMappings() TelegrafMappings {
+	gauge := func(metricName, unit string, scale float64, attributes ...string) TelegrafFieldMapping {
+		return TelegrafFieldMapping{MetricName: metricName, Unit: unit, ValueType: common.InfluxMetricValueTypeGauge, Scale: scale, Attributes: pairsToMap(attributes)}
+	}
+	counter := func(metricName, unit string, scale float64, attributes ...string) TelegrafFieldMapping {
+		return TelegrafFieldMapping{MetricName: metricName, Unit: unit, ValueType: common.InfluxMetricValueTypeSum, IsMonotonic: true, Scale: scale, Attributes: pairsToMap(attributes)}
+	}
+	upDownCounter := func(metricName, unit string, scale float64, attributes ...string) TelegrafFieldMapping {
+		return TelegrafFieldMapping{MetricName: metricName, Unit: unit, ValueType: common.InfluxMetricValueTypeSum, Scale: scale, Attributes: pairsToMap(attributes)}
+	}
+
+	const (
+		percent      = 0.01
+		milliseconds = 0.001
+		nanoseconds  = 1e-9
+	)
+	containerTags := map[string]string{
+		"container_name":    "container.name",
+		"container_image":   "container.image.name",
+		"container_version": "container.image.tag",
+	}
+
+	return TelegrafMappings{
+		"cpu": {
+			Fields: map[string]TelegrafFieldMapping{
+				"usage_user":    gauge("system.cpu.utilization", "1", percent, "state", "user"),
+				"usage_system":  gauge("system.cpu.utilization", "1", percent, "state", "system"),
+				"usage_idle":    gauge("system.cpu.utilization", "1", percent, "state", "idle"),
+				"usage_nice":    gauge("system.cpu.utilization", "1", percent, "state", "nice"),
+				"usage_iowait":  gauge("system.cpu.utilization", "1", percent, "state", "wait"),
+				"usage_irq":     gauge("system.cpu.utilization", "1", percent, "state", "interrupt"),
+				"usage_softirq": gauge("system.cpu.utilization", "1", percent, "state", "softirq"),
+				"usage_steal":   gauge("system.cpu.utilization", "1", percent, "state", "steal"),
+				"time_user":     counter("system.cpu.time", "s", 0, "state", "user"),
+				"time_system":   counter("system.cpu.time", "s", 0, "state", "system"),
+				"time_idle":     counter("system.cpu.time", "s", 0, "state", "idle"),
+				"time_nice":     counter("system.cpu.time", "s", 0, "state", "nice"),
+				"time_iowait":   counter("system.cpu.time", "s", 0, "state", "wait"),
+				"time_irq":      counter("system.cpu.time", "s", 0, "state", "interrupt"),
+				"time_softirq":  counter("system.cpu.time", "s", 0, "state", "softirq"),
+				"time_steal":    counter("system.cpu.time", "s", 0, "state", "steal"),
+			},
+		},
+		"mem": {
+			Fields: map[string]TelegrafFieldMapping{
+				"used":         upDownCounter("system.memory.usage", "By", 0, "state", "used"),
+				"free":         upDownCounter("system.memory.usage", "By", 0, "state", "free"),
+				"cached":       upDownCounter("system.memory.usage", "By", 0, "state", "cached"),
+				"buffered":     upDownCounter("system.memory.usage", "By", 0, "state", "buffers"),
+				"total":        upDownCounter("system.memory.limit", "By", 0),
+				"used_percent": gauge("system.memory.utilization", "1", percent, "state", "used"),
+			},
+		},
+		"disk": {
+			Fields: map[string]TelegrafFieldMapping{
+				"used":         upDownCounter("system.filesystem.usage", "By", 0, "state", "used"),
+				"free":         upDownCounter("system.filesystem.usage", "By", 0, "state", "free"),
+				"used_percent": gauge("system.filesystem.utilization", "1", percent),
+				"inodes_used":  upDownCounter("system.filesystem.inodes.usage", "{inodes}", 0, "state", "used"),
+				"inodes_free":  upDownCounter("system.filesystem.inodes.usage", "{inodes}", 0, "state", "free"),
+			},
+			TagRenames: map[string]string{
+				"path":   "mountpoint",
+				"fstype": "type",
+			},
+		},
+		"diskio": {
+			Fields: map[string]TelegrafFieldMapping{
+				"read_bytes":       counter("system.disk.io", "By", 0, "direction", "read"),
+				"write_bytes":      counter("system.disk.io", "By", 0, "direction", "write"),
+				"reads":            counter("system.disk.operations", "{operations}", 0, "direction", "read"),
+				"writes":           counter("system.disk.operations", "{operations}", 0, "direction", "write"),
+				"read_time":        counter("system.disk.operation_time", "s", milliseconds, "direction", "read"),
+				"write_time":       counter("system.disk.operation_time", "s", milliseconds, "direction", "write"),
+				"merged_reads":     counter("system.disk.merged", "{operations}", 0, "direction", "read"),
+				"merged_writes":    counter("system.disk.merged", "{operations}", 0, "direction", "write"),
+				"io_time":          counter("system.disk.io_time", "s", milliseconds),
+				"weighted_io_time": counter("system.disk.weighted_io_time", "s", milliseconds),
+				"iops_in_progress": upDownCounter("system.disk.pending_operations", "{operations}", 0),
+			},
+			TagRenames: map[string]string{
+				"name": "device",
+			},
+		},
+		"net": {
+			Fields: map[string]TelegrafFieldMapping{
+				"bytes_sent":   counter("system.network.io", "By", 0, "direction", "transmit"),
+				"bytes_recv":   counter("system.network.io", "By", 0, "direction", "receive"),
+				"packets_sent": counter("system.network.packets", "{packets}", 0, "direction", "transmit"),
+				"packets_recv": counter("system.network.packets", "{packets}", 0, "direction", "receive"),
+				"err_out":      counter("system.network.errors", "{errors}", 0, "direction", "transmit"),
+				"err_in":       counter("system.network.errors", "{errors}", 0, "direction", "receive"),
+				"drop_out":     counter("system.network.dropped", "{packets}", 0, "direction", "transmit"),
+				"drop_in":      counter("system.network.dropped", "{packets}", 0, "direction", "receive"),
+			},
+			TagRenames: map[string]string{
+				"interface": "device",
+			},
+		},
+		"system": {
+			Fields: map[string]TelegrafFieldMapping{
+				"load1":  gauge("system.cpu.load_average.1m", "1", 0),
+				"load5":  gauge("system.cpu.load_average.5m", "1", 0),
+				"load15": gauge("system.cpu.load_average.15m", "1", 0),
+				"n_cpus": upDownCounter("system.cpu.logical.count", "{cpu}", 0),
+				"uptime": gauge("system.uptime", "s", 0),
+			},
+		},
+		"processes": {
+			Fields: map[string]TelegrafFieldMapping{
+				"running":  upDownCounter("system.processes.count", "{processes}", 0, "status", "running"),
+				"sleeping": upDownCounter("system.processes.count", "{processes}", 0, "status", "sleeping"),
+				"blocked":  upDownCounter("system.processes.count", "{processes}", 0, "status", "blocked"),
+				"zombies":  upDownCounter("system.processes.count", "{processes}", 0, "status", "zombies"),
+				"stopped":  upDownCounter("system.processes.count", "{processes}", 0, "status", "stopped"),
+				"idle":     upDownCounter("system.processes.count", "{processes}", 0, "status", "idle"),
+				"paging":   upDownCounter("system.processes.count", "{processes}", 0, "status", "paging"),
+			},
+		},
+		"docker_container_cpu": {
+			Fields: map[string]TelegrafFieldMapping{
+				"usage_total":   counter("container.cpu.time", "s", nanoseconds),
+				"usage_percent": gauge("container.cpu.utilization", "1", percent),
+			},
+			TagRenames: containerTags,
+		},
+		"docker_container_mem": {
+			Fields: map[string]TelegrafFieldMapping{
+				"usage":         upDownCounter("container.memory.usage", "By", 0),
+				"limit":         upDownCounter("container.memory.usage.limit", "By", 0),
+				"usage_percent": gauge("container.memory.utilization", "1", percent),
+			},
+			TagRenames: containerTags,
+		},
+		"docker_container_net": {
+			Fields: map[string]TelegrafFieldMapping{
+				"tx_bytes":   counter("container.network.io", "By", 0, "direction", "transmit"),
+				"rx_bytes":   counter("container.network.io", "By", 0, "direction", "receive"),
+				"tx_packets": counter("container.network.packets", "{packets}", 0, "direction", "transmit"),
+				"rx_packets": counter("container.network.packets", "{packets}", 0, "direction", "receive"),
+				"tx_errors":  counter("container.network.errors", "{errors}", 0, "direction", "transmit"),
+				"rx_errors":  counter("container.network.errors", "{errors}", 0, "direction", "receive"),
+				"tx_dropped": counter("container.network.dropped", "{packets}", 0, "direction", "transmit"),
+				"rx_dropped": counter("container.network.dropped", "{packets}", 0, "direction", "receive"),
+			},
+			TagRenames: mergeStringMaps(containerTags, map[string]string{"network": "device"}),
+		},
+		"docker_container_blkio": {
+			Fields: map[string]TelegrafFieldMapping{
+				"io_service_bytes_recursive_read":  counter("container.disk.io", "By", 0, "direction", "read"),
+				"io_service_bytes_recursive_write": counter("container.disk.io", "By", 0, "direction", "write"),
+			},
+			TagRenames: containerTags,
+		},
+	}
+}
+
+func pairsToMap(kv []string) map[string]string {
+	if len(kv) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+	return m
+}
+
+func mergeStringMaps(ms ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range ms {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func validateTelegrafMappings(mappings TelegrafMappings) error {
+	for measurement, mm := range mappings {
+		if mm == nil {
+			return fmt.Errorf("telegraf mapping for measurement '%s' is nil", measurement)
+		}
+		for field, fm := range mm.Fields {
+			if fm.MetricName == "" {
+				return fmt.Errorf("telegraf mapping for measurement '%s' field '%s' has no metric name", measurement, field)
+			}
+			switch fm.ValueType {
+			case common.InfluxMetricValueTypeGauge, common.InfluxMetricValueTypeSum:
+			default:
+				return fmt.Errorf("telegraf mapping for measurement '%s' field '%s' has unsupported value type '%s'", measurement, field, fm.ValueType)
+			}
+		}
+	}
+	return nil
+}
+
+// addPointWithTelegrafMapping converts the mapped fields of a point,
+// then converts any remaining fields with addPointWithUnknownSchema.
+func (b *MetricsBatch) addPointWithTelegrafMapping(mapping *TelegrafMeasurementMapping, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time) error {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	if len(mapping.TagRenames) > 0 {
+		renamedTags := make(map[string]string, len(tags))
+		for k, v := range tags {
+			if newK, found := mapping.TagRenames[k]; found {
+				k = newK
+			}
+			renamedTags[k] = v
+		}
+		tags = renamedTags
+	}
+
+	var unmappedFields map[string]interface{}
+	for _, k := range sortedKeys(fields) {
+		v := fields[k]
+		fm, found := mapping.Fields[k]
+		if !found {
+			if unmappedFields == nil {
+				unmappedFields = make(map[string]interface{})
+			}
+			unmappedFields[k] = v
+			continue
+		}
+
+		var floatValue *float64
+		var intValue *int64
+		switch typedValue := v.(type) {
+		case float64:
+			floatValue = &typedValue
+		case int64:
+			intValue = &typedValue
+		case uint64:
+			convertedTypedValue := int64(typedValue)
+			intValue = &convertedTypedValue
+		default:
+			b.logger.Debug("field has unsupported type", "measurement", measurement, "field", k, "type", fmt.Sprintf("%T", v))
+			continue
+		}
+		if fm.Scale != 0 && fm.Scale != 1 {
+			var scaled float64
+			if floatValue != nil {
+				scaled = *floatValue * fm.Scale
+			} else {
+				scaled = float64(*intValue) * fm.Scale
+			}
+			floatValue, intValue = &scaled, nil
+		}
+
+		metric, attributes, err := b.lookupMetric(fm.MetricName, tags, fm.ValueType)
+		if err != nil {
+			return err
+		}
+		metric.SetUnit(fm.Unit)
+		var dataPoint pmetric.NumberDataPoint
+		if fm.ValueType == common.InfluxMetricValueTypeSum {
+			metric.Sum().SetIsMonotonic(fm.IsMonotonic)
+			dataPoint = b.appendNumberDataPoint(metric.Sum().DataPoints())
+		} else {
+			dataPoint = b.appendNumberDataPoint(metric.Gauge().DataPoints())
+		}
+		attributes.CopyTo(dataPoint.Attributes())
+		for _, ak := range sortedKeys(fm.Attributes) {
+			av := fm.Attributes[ak]
+			dataPoint.Attributes().PutStr(ak, av)
+		}
+		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+		if floatValue != nil {
+			dataPoint.SetDoubleValue(*floatValue)
+		} else if intValue != nil {
+			dataPoint.SetIntValue(*intValue)
+		} else {
+			panic("unreachable")
+		}
+	}
+
+	if len(unmappedFields) > 0 {
+		return b.addPointWithUnknownSchema(measurement, tags, unmappedFields, ts)
+	}
+	return nil
+}
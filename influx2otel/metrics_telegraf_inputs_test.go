@@ -0,0 +1,164 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestTelegrafMappings_cpu(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.TelegrafMappings = influx2otel.DefaultTelegrafMappings()
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cpu",
+		map[string]string{
+			"host.name": "777348dc6343",
+			"cpu":       "cpu4",
+		},
+		map[string]interface{}{
+			"usage_user":   float64(10),
+			"usage_system": float64(30),
+			"usage_guest":  float64(0),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("host.name", "777348dc6343")
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("system.cpu.utilization")
+	m.SetUnit("1")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu4")
+	dp.Attributes().PutStr("state", "user")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0.1)
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu4")
+	dp.Attributes().PutStr("state", "system")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0.3)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_guest")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("cpu", "cpu4")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestTelegrafMappings_net(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.TelegrafMappings = influx2otel.DefaultTelegrafMappings()
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("net",
+		map[string]string{
+			"interface": "eth0",
+		},
+		map[string]interface{}{
+			"bytes_sent": uint64(1024),
+			"bytes_recv": uint64(2048),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("system.network.io")
+	m.SetUnit("By")
+	m.SetEmptySum()
+	m.Sum().SetIsMonotonic(true)
+	m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("device", "eth0")
+	dp.Attributes().PutStr("direction", "transmit")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(1024)
+	dp = m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("device", "eth0")
+	dp.Attributes().PutStr("direction", "receive")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(2048)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestTelegrafMappings_custom(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.TelegrafMappings = influx2otel.TelegrafMappings{
+		"mem": {
+			Fields: map[string]influx2otel.TelegrafFieldMapping{
+				"used": {
+					MetricName: "system.memory.usage",
+					Unit:       "By",
+					ValueType:  common.InfluxMetricValueTypeSum,
+					Attributes: map[string]string{"state": "used"},
+				},
+			},
+		},
+	}
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("mem",
+		map[string]string{},
+		map[string]interface{}{
+			"used": int64(4096),
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("system.memory.usage")
+	m.SetUnit("By")
+	m.SetEmptySum()
+	m.Sum().SetIsMonotonic(false)
+	m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("state", "used")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetIntValue(4096)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
+
+func TestTelegrafMappings_invalid(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.TelegrafMappings = influx2otel.TelegrafMappings{
+		"mem": {
+			Fields: map[string]influx2otel.TelegrafFieldMapping{
+				"used": {MetricName: "system.memory.usage", ValueType: common.InfluxMetricValueTypeHistogram},
+			},
+		},
+	}
+	_, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	assert.Error(t, err)
+}
@@ -51,14 +51,18 @@ func (b *MetricsBatch) inferMetricValueTypeV1(vType common.InfluxMetricValueType
 	}
 	isHistogram := true
 	for k := range fields {
-		if k != common.MetricHistogramCountFieldKey && k != common.MetricHistogramSumFieldKey && k != common.AttributeStartTimeStatsd && !isStringNumeric(k) {
+		if k != common.MetricHistogramCountFieldKey && k != common.MetricHistogramSumFieldKey && k != common.AttributeStartTimeStatsd &&
+			!isStringNumeric(k) && !common.IsHistogramQuantileFieldKey(k) {
 			isHistogram = false
 			break
 		}
 	}
 	if isHistogram {
 		// We cannot reliably distinguish between histogram and summary
-		// without knowing we have all points, so here we assume histogram.
+		// without knowing we have all points, so the configured policy decides.
+		if b.ambiguousDistributions == DistributionsAsSummary {
+			return common.InfluxMetricValueTypeSummary
+		}
 		return common.InfluxMetricValueTypeHistogram
 	}
 	return common.InfluxMetricValueTypeUntyped
@@ -89,7 +93,7 @@ func (b *MetricsBatch) convertGaugeV1(measurement string, tags map[string]string
 		if err != nil {
 			return err
 		}
-		dataPoint := metric.Gauge().DataPoints().AppendEmpty()
+		dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
@@ -110,7 +114,8 @@ func (b *MetricsBatch) convertGaugeV1(measurement string, tags map[string]string
 		return nil
 	}
 
-	for k, fieldValue := range fields {
+	for _, k := range sortedKeys(fields) {
+		fieldValue := fields[k]
 		var floatValue *float64
 		var intValue *int64
 
@@ -135,7 +140,7 @@ func (b *MetricsBatch) convertGaugeV1(measurement string, tags map[string]string
 		if err != nil {
 			return err
 		}
-		dataPoint := metric.Gauge().DataPoints().AppendEmpty()
+		dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
@@ -178,7 +183,7 @@ func (b *MetricsBatch) convertSumV1(measurement string, tags map[string]string,
 		if err != nil {
 			return err
 		}
-		dataPoint := metric.Sum().DataPoints().AppendEmpty()
+		dataPoint := b.appendNumberDataPoint(metric.Sum().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
@@ -200,7 +205,8 @@ func (b *MetricsBatch) convertSumV1(measurement string, tags map[string]string,
 		return nil
 	}
 
-	for k, fieldValue := range fields {
+	for _, k := range sortedKeys(fields) {
+		fieldValue := fields[k]
 		if k == common.AttributeStartTimeStatsd {
 			continue
 		}
@@ -225,7 +231,7 @@ func (b *MetricsBatch) convertSumV1(measurement string, tags map[string]string,
 		if err != nil {
 			return err
 		}
-		dataPoint := metric.Sum().DataPoints().AppendEmpty()
+		dataPoint := b.appendNumberDataPoint(metric.Sum().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
@@ -256,7 +262,8 @@ func (b *MetricsBatch) convertHistogramV1(measurement string, tags map[string]st
 	var bucketCounts []uint64
 	var explicitBounds []float64
 
-	for k, vi := range fields {
+	for _, k := range sortedKeys(fields) {
+		vi := fields[k]
 		if k == common.MetricHistogramCountFieldKey {
 			foundCount = true
 			if vCount, ok := vi.(float64); !ok {
@@ -279,7 +286,8 @@ func (b *MetricsBatch) convertHistogramV1(measurement string, tags map[string]st
 				explicitBounds = append(explicitBounds, explicitBound)
 				bucketCounts = append(bucketCounts, uint64(vBucketCount))
 			}
-		} else if k == common.AttributeStartTimeStatsd {
+		} else if k == common.AttributeStartTimeStatsd || common.IsHistogramQuantileFieldKey(k) {
+			// quantiles estimated from the buckets by otel2influx
 		} else {
 			b.logger.Debug("skipping unrecognized histogram field", "field", k, "value", vi)
 		}
@@ -311,7 +319,7 @@ func (b *MetricsBatch) convertHistogramV1(measurement string, tags map[string]st
 	if err != nil {
 		return err
 	}
-	dataPoint := metric.Histogram().DataPoints().AppendEmpty()
+	dataPoint := b.appendHistogramDataPoint(metric.Histogram().DataPoints())
 	attributes.CopyTo(dataPoint.Attributes())
 	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 	if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
@@ -336,7 +344,8 @@ func (b *MetricsBatch) convertSummaryV1(measurement string, tags map[string]stri
 	foundSum := false
 	quantileValues := pmetric.NewSummaryDataPointValueAtQuantileSlice()
 
-	for k, vi := range fields {
+	for _, k := range sortedKeys(fields) {
+		vi := fields[k]
 		if k == common.MetricSummaryCountFieldKey {
 			foundCount = true
 			if vCount, ok := vi.(float64); !ok {
@@ -376,7 +385,7 @@ func (b *MetricsBatch) convertSummaryV1(measurement string, tags map[string]stri
 	if err != nil {
 		return err
 	}
-	dataPoint := metric.Summary().DataPoints().AppendEmpty()
+	dataPoint := b.appendSummaryDataPoint(metric.Summary().DataPoints())
 	attributes.CopyTo(dataPoint.Attributes())
 	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 	if startTimeObj, ok := fields[common.AttributeStartTimeStatsd]; ok {
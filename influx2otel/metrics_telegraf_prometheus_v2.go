@@ -2,13 +2,14 @@ package influx2otel
 
 import (
 	"fmt"
-	"go.opentelemetry.io/collector/pdata/pmetric"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
 	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 
 	"github.com/influxdata/influxdb-observability/common"
 )
@@ -18,6 +19,7 @@ func (b *MetricsBatch) addPointTelegrafPrometheusV2(measurement string, tags map
 		return fmt.Errorf("unexpected measurement name '%s'", measurement)
 	}
 
+	fields = withoutHistogramQuantileFieldsV2(tags, fields)
 	vType = b.inferMetricValueTypeV2(vType, tags, fields)
 	if vType == common.InfluxMetricValueTypeUntyped {
 		return errValueTypeUnknown
@@ -45,15 +47,26 @@ func (b *MetricsBatch) inferMetricValueTypeV2(vType common.InfluxMetricValueType
 	if vType != common.InfluxMetricValueTypeUntyped {
 		return vType
 	}
-	for k := range tags {
-		if k == common.MetricHistogramBoundKeyV2 || k == common.MetricSummaryQuantileKeyV2 {
-			return common.InfluxMetricValueTypeHistogram
-		}
+	metricName := distributionMetricNameV2(tags, fields)
+	if _, found := tags[common.MetricHistogramBoundKeyV2]; found {
+		b.distributionTypeByNameV2[metricName] = common.InfluxMetricValueTypeHistogram
+		return common.InfluxMetricValueTypeHistogram
 	}
-	for k := range fields {
-		if strings.HasSuffix(k, common.MetricHistogramCountSuffix) || strings.HasSuffix(k, common.MetricHistogramSumSuffix) {
-			return common.InfluxMetricValueTypeHistogram
+	if metricName != "" {
+		// Quantile lines belong to summaries, but count and sum lines can belong to either.
+		// The type is resolved once per metric, so that the count and sum line of a histogram
+		// is not taken for a summary when it follows the bucket lines.
+		// With DistributionsAsSummary, a summary that has no quantiles is converted to a histogram
+		// when its first bucket line is added.
+		if resolvedType, found := b.distributionTypeByNameV2[metricName]; found {
+			return resolvedType
+		}
+		ambiguousType := common.InfluxMetricValueTypeHistogram
+		if b.ambiguousDistributions == DistributionsAsSummary {
+			ambiguousType = common.InfluxMetricValueTypeSummary
 		}
+		b.distributionTypeByNameV2[metricName] = ambiguousType
+		return ambiguousType
 	}
 	if len(fields) == 1 {
 		return common.InfluxMetricValueTypeGauge
@@ -61,12 +74,204 @@ func (b *MetricsBatch) inferMetricValueTypeV2(vType common.InfluxMetricValueType
 	return common.InfluxMetricValueTypeUntyped
 }
 
+// distributionMetricNameV2 returns the name of the histogram or summary metric that a line belongs to,
+// or "" if the line is not a bucket, quantile, or count and sum line.
+func distributionMetricNameV2(tags map[string]string, fields map[string]interface{}) string {
+	_, foundBound := tags[common.MetricHistogramBoundKeyV2]
+	_, foundQuantile := tags[common.MetricSummaryQuantileKeyV2]
+	for _, k := range sortedKeys(fields) {
+		switch {
+		case foundBound:
+			return strings.TrimSuffix(k, common.MetricHistogramBucketSuffix)
+		case foundQuantile:
+			return k
+		case strings.HasSuffix(k, common.MetricHistogramCountSuffix):
+			return strings.TrimSuffix(k, common.MetricHistogramCountSuffix)
+		case strings.HasSuffix(k, common.MetricHistogramSumSuffix):
+			return strings.TrimSuffix(k, common.MetricHistogramSumSuffix)
+		}
+	}
+	return ""
+}
+
+// withoutHistogramQuantileFieldsV2 returns the fields of a count and sum line without the
+// "<metric>_p<percentile>" fields that otel2influx writes when configured with HistogramQuantiles.
+// Those quantiles are estimated from the buckets, so they are not needed to restore the histogram.
+func withoutHistogramQuantileFieldsV2(tags map[string]string, fields map[string]interface{}) map[string]interface{} {
+	if _, found := tags[common.MetricHistogramBoundKeyV2]; found {
+		return fields
+	}
+	if _, found := tags[common.MetricSummaryQuantileKeyV2]; found {
+		return fields
+	}
+	var metricName string
+	for k := range fields {
+		if strings.HasSuffix(k, common.MetricHistogramCountSuffix) {
+			metricName = strings.TrimSuffix(k, common.MetricHistogramCountSuffix)
+			break
+		}
+	}
+	if metricName == "" {
+		return fields
+	}
+
+	isQuantileField := func(k string) bool {
+		suffix, found := strings.CutPrefix(k, metricName+"_")
+		return found && common.IsHistogramQuantileFieldKey(suffix)
+	}
+	var hasQuantileFields bool
+	for k := range fields {
+		if isQuantileField(k) {
+			hasQuantileFields = true
+			break
+		}
+	}
+	if !hasQuantileFields {
+		return fields
+	}
+	filtered := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if !isQuantileField(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// multiLinePointKeyV2 identifies the histogram or summary data point that a line belongs to,
+// when the line is one of several lines that make up that data point.
+// The key is the metric name and the tags other than "le" and "quantile"; it ignores the timestamp.
+func multiLinePointKeyV2(tags map[string]string, fields map[string]interface{}) (string, bool) {
+	metricName := distributionMetricNameV2(tags, fields)
+	if metricName == "" {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(metricName)
+	for _, k := range sortedKeys(tags) {
+		if k == common.MetricHistogramBoundKeyV2 || k == common.MetricSummaryQuantileKeyV2 {
+			continue
+		}
+		key.WriteByte(0)
+		key.WriteString(k)
+		key.WriteByte(0)
+		key.WriteString(tags[k])
+	}
+	return key.String(), true
+}
+
 type dataPointKey string
 
 func newDataPointKey(ts time.Time, attributes pcommon.Map) dataPointKey {
 	return dataPointKey(fmt.Sprintf("%d:%s", ts.UnixNano(), pdatautil.MapHash(attributes)))
 }
 
+// snapDataPointTimeV2 returns the timestamp of the data point that a histogram or summary line belongs to.
+// Within the merge window, lines are merged into the most recent data point having the same attributes.
+func (b *MetricsBatch) snapDataPointTimeV2(metric pmetric.Metric, attributes pcommon.Map, ts time.Time) time.Time {
+	if b.mergeWindowV2 == 0 {
+		return ts
+	}
+	aKey := pdatautil.MapHash(attributes)
+	timeByAttributes, found := b.dataPointTimeByMA[metric]
+	if !found {
+		timeByAttributes = make(map[[16]byte]time.Time)
+		b.dataPointTimeByMA[metric] = timeByAttributes
+	}
+	if dataPointTime, found := timeByAttributes[aKey]; found {
+		if d := ts.Sub(dataPointTime); d <= b.mergeWindowV2 && d >= -b.mergeWindowV2 {
+			return dataPointTime
+		}
+	}
+	timeByAttributes[aKey] = ts
+	return ts
+}
+
+type histogramDataPointV2 struct {
+	metric       pmetric.Metric
+	dataPoint    pmetric.HistogramDataPoint
+	hasCount     bool
+	hasQuantiles bool
+}
+
+// validateHistogramsV2 drops histogram data points that lack the count and sum line,
+// or whose cumulative bucket counts are inconsistent, and counts and logs each one.
+// Histogram metrics left without data points are removed, as are scopes and resources left without metrics.
+// Summaries interpreted as histograms are not validated.
+func (b *MetricsBatch) validateHistogramsV2() {
+	droppedByMetric := make(map[pmetric.Metric]map[dataPointKey]struct{})
+	for _, h := range b.histogramDataPointsV2 {
+		if h.hasQuantiles {
+			continue
+		}
+		if reason := incompleteHistogramReasonV2(h); reason != "" {
+			b.logger.Debug("dropping incomplete histogram",
+				"metric", h.metric.Name(),
+				"timestamp", h.dataPoint.Timestamp().AsTime(),
+				"attributes", h.dataPoint.Attributes().AsRaw(),
+				"reason", reason)
+			b.incompleteHistogramCount++
+			if _, found := droppedByMetric[h.metric]; !found {
+				droppedByMetric[h.metric] = make(map[dataPointKey]struct{})
+			}
+			droppedByMetric[h.metric][newDataPointKey(h.dataPoint.Timestamp().AsTime(), h.dataPoint.Attributes())] = struct{}{}
+		}
+	}
+	if len(droppedByMetric) == 0 {
+		return
+	}
+
+	for metric, dropped := range droppedByMetric {
+		metric.Histogram().DataPoints().RemoveIf(func(dataPoint pmetric.HistogramDataPoint) bool {
+			_, found := dropped[newDataPointKey(dataPoint.Timestamp().AsTime(), dataPoint.Attributes())]
+			if found {
+				b.dataPointCount--
+			}
+			return found
+		})
+	}
+	b.metrics.ResourceMetrics().RemoveIf(func(resourceMetrics pmetric.ResourceMetrics) bool {
+		resourceMetrics.ScopeMetrics().RemoveIf(func(scopeMetrics pmetric.ScopeMetrics) bool {
+			scopeMetrics.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				_, found := droppedByMetric[metric]
+				return found && metric.Histogram().DataPoints().Len() == 0
+			})
+			return scopeMetrics.Metrics().Len() == 0
+		})
+		return resourceMetrics.ScopeMetrics().Len() == 0
+	})
+}
+
+func incompleteHistogramReasonV2(h *histogramDataPointV2) string {
+	dataPoint := h.dataPoint
+	if !h.hasCount {
+		return "no count and sum line"
+	}
+	// Bucket counts were converted from cumulative to per-bucket counts as lines arrived;
+	// the running sum restores the cumulative counts, wrapping around where a count decreased.
+	var cumulative, previous uint64
+	for i := 0; i < dataPoint.BucketCounts().Len(); i++ {
+		cumulative += dataPoint.BucketCounts().At(i)
+		if cumulative < previous {
+			return "cumulative bucket counts decrease"
+		}
+		previous = cumulative
+	}
+	bounds := dataPoint.ExplicitBounds()
+	if bounds.Len() == 0 || !math.IsInf(bounds.At(bounds.Len()-1), +1) {
+		// GetMetrics adds the +Inf bucket from the count
+		if cumulative > dataPoint.Count() {
+			return fmt.Sprintf("no +Inf bucket, and bucket count %d exceeds count %d", cumulative, dataPoint.Count())
+		}
+		return ""
+	}
+	if cumulative != dataPoint.Count() {
+		return fmt.Sprintf("+Inf bucket count %d does not match count %d", cumulative, dataPoint.Count())
+	}
+	return ""
+}
+
 func (b *MetricsBatch) convertGaugeV2(tags map[string]string, fields map[string]interface{}, ts time.Time) error {
 	if len(fields) != 1 {
 		return fmt.Errorf("gauge metric should have 1 field, found %d", len(fields))
@@ -75,7 +280,8 @@ func (b *MetricsBatch) convertGaugeV2(tags map[string]string, fields map[string]
 	var metricName string
 	var floatValue *float64
 	var intValue *int64
-	for k, fieldValue := range fields {
+	for _, k := range sortedKeys(fields) {
+		fieldValue := fields[k]
 		metricName = k
 		switch typedValue := fieldValue.(type) {
 		case float64:
@@ -94,7 +300,7 @@ func (b *MetricsBatch) convertGaugeV2(tags map[string]string, fields map[string]
 	if err != nil {
 		return err
 	}
-	dataPoint := metric.Gauge().DataPoints().AppendEmpty()
+	dataPoint := b.appendNumberDataPoint(metric.Gauge().DataPoints())
 	attributes.CopyTo(dataPoint.Attributes())
 	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 	if floatValue != nil {
@@ -115,7 +321,8 @@ func (b *MetricsBatch) convertSumV2(tags map[string]string, fields map[string]in
 	var metricName string
 	var floatValue *float64
 	var intValue *int64
-	for k, fieldValue := range fields {
+	for _, k := range sortedKeys(fields) {
+		fieldValue := fields[k]
 		metricName = k
 		switch typedValue := fieldValue.(type) {
 		case float64:
@@ -134,7 +341,7 @@ func (b *MetricsBatch) convertSumV2(tags map[string]string, fields map[string]in
 	if err != nil {
 		return err
 	}
-	dataPoint := metric.Sum().DataPoints().AppendEmpty()
+	dataPoint := b.appendNumberDataPoint(metric.Sum().DataPoints())
 	attributes.CopyTo(dataPoint.Attributes())
 	dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 	if floatValue != nil {
@@ -183,14 +390,20 @@ func (b *MetricsBatch) convertHistogramV2(tags map[string]string, fields map[str
 		return err
 	}
 
+	ts = b.snapDataPointTimeV2(metric, attributes, ts)
 	dpk := newDataPointKey(ts, attributes)
-	dataPoint, found := b.histogramDataPointsByMDPK[metric][dpk]
+	h, found := b.histogramDataPointsByMDPK[metric][dpk]
 	if !found {
-		dataPoint = metric.Histogram().DataPoints().AppendEmpty()
-		attributes.CopyTo(dataPoint.Attributes())
-		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
-		b.histogramDataPointsByMDPK[metric][dpk] = dataPoint
+		h = &histogramDataPointV2{
+			metric:    metric,
+			dataPoint: b.appendHistogramDataPoint(metric.Histogram().DataPoints()),
+		}
+		attributes.CopyTo(h.dataPoint.Attributes())
+		h.dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+		b.histogramDataPointsByMDPK[metric][dpk] = h
+		b.histogramDataPointsV2 = append(b.histogramDataPointsV2, h)
 	}
+	dataPoint := h.dataPoint
 
 	if sExplicitBound, found := tags[common.MetricHistogramBoundKeyV2]; found {
 		if iBucketCount, found := fields[metric.Name()+common.MetricHistogramBucketSuffix]; found {
@@ -222,6 +435,7 @@ func (b *MetricsBatch) convertHistogramV2(tags map[string]string, fields map[str
 			}
 			dataPoint.ExplicitBounds().Append(quantile)
 			dataPoint.BucketCounts().Append(uint64(value))
+			h.hasQuantiles = true
 		} else {
 			return fmt.Errorf("summary (interpreted as histogram) quantile has no matching value")
 		}
@@ -242,6 +456,7 @@ func (b *MetricsBatch) convertHistogramV2(tags map[string]string, fields map[str
 
 			dataPoint.SetCount(uint64(count))
 			dataPoint.SetSum(sum)
+			h.hasCount = true
 		} else {
 			return fmt.Errorf("histogram count has no matching sum")
 		}
@@ -310,10 +525,11 @@ func (b *MetricsBatch) convertSummaryV2(tags map[string]string, fields map[strin
 		return err
 	}
 
+	ts = b.snapDataPointTimeV2(metric, attributes, ts)
 	dpk := newDataPointKey(ts, attributes)
 	dataPoint, found := b.summaryDataPointsByMDPK[metric][dpk]
 	if !found {
-		dataPoint = metric.Summary().DataPoints().AppendEmpty()
+		dataPoint = b.appendSummaryDataPoint(metric.Summary().DataPoints())
 		attributes.CopyTo(dataPoint.Attributes())
 		dataPoint.SetTimestamp(pcommon.NewTimestampFromTime(ts))
 		b.summaryDataPointsByMDPK[metric][dpk] = dataPoint
@@ -7,6 +7,7 @@ import (
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/influxdata/influxdb-observability/common"
@@ -886,3 +887,122 @@ func TestAddPoint_v2_untypedSummary(t *testing.T) {
 
 	assertMetricsEqual(t, expect, b.GetMetrics())
 }
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...interface{}) {
+	l.messages = append(l.messages, msg)
+}
+
+func addHistogramLinesV2(t *testing.T, b *influx2otel.MetricsBatch, count float64, buckets map[string]float64, ts time.Time, jitter time.Duration) {
+	t.Helper()
+	err := b.AddPoint(common.MeasurementPrometheus,
+		map[string]string{"method": "post"},
+		map[string]interface{}{
+			"http_request_duration_seconds_count": count,
+			"http_request_duration_seconds_sum":   float64(53423),
+		},
+		ts,
+		common.InfluxMetricValueTypeHistogram)
+	require.NoError(t, err)
+	for _, le := range []string{"0.05", "0.1", "+Inf"} {
+		bucketCount, found := buckets[le]
+		if !found {
+			continue
+		}
+		ts = ts.Add(jitter)
+		err = b.AddPoint(common.MeasurementPrometheus,
+			map[string]string{"method": "post", "le": le},
+			map[string]interface{}{"http_request_duration_seconds_bucket": bucketCount},
+			ts,
+			common.InfluxMetricValueTypeHistogram)
+		require.NoError(t, err)
+	}
+}
+
+func TestAddPoint_v2_histogram_mergeWindow(t *testing.T) {
+	logger := new(recordingLogger)
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.Logger = logger
+	config.PrometheusV2MergeWindow = time.Millisecond
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	addHistogramLinesV2(t, b, 144320, map[string]float64{"0.05": 24054, "0.1": 33444, "+Inf": 144320},
+		time.Unix(0, 1395066363000000123), 100*time.Microsecond)
+
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("method", "post")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetCount(144320)
+	dp.SetSum(53423)
+	dp.BucketCounts().FromRaw([]uint64{24054, 9390, 110876})
+	dp.ExplicitBounds().FromRaw([]float64{0.05, 0.1})
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+	assert.Empty(t, logger.messages)
+}
+
+func TestAddPoint_v2_histogram_incomplete(t *testing.T) {
+	for name, buckets := range map[string]map[string]float64{
+		"bucketExceedsCount": {"0.05": 24054, "0.1": 144321},
+		"notMonotonic":       {"0.05": 33444, "0.1": 24054, "+Inf": 144320},
+		"infinityNotCount":   {"0.05": 24054, "0.1": 33444, "+Inf": 144000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			logger := new(recordingLogger)
+			config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+			config.Logger = logger
+			config.PrometheusV2MergeWindow = time.Millisecond
+			c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+			require.NoError(t, err)
+
+			b := c.NewBatch()
+			addHistogramLinesV2(t, b, 144320, buckets, time.Unix(0, 1395066363000000123), 0)
+			assert.Equal(t, 0, b.GetMetrics().ResourceMetrics().Len())
+			assert.Equal(t, 1, b.IncompleteHistogramCount())
+			assert.Equal(t, []string{"dropping incomplete histogram"}, logger.messages)
+
+			b.Reset()
+			assert.Equal(t, 0, b.IncompleteHistogramCount())
+		})
+	}
+}
+
+// Without a merge window, the lines of one histogram may be split across batches,
+// so a histogram without its count and sum line is emitted as it is.
+func TestAddPoint_v2_histogram_split(t *testing.T) {
+	for name, mergeWindow := range map[string]time.Duration{"noMergeWindow": 0, "mergeWindow": time.Millisecond} {
+		t.Run(name, func(t *testing.T) {
+			config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+			config.PrometheusV2MergeWindow = mergeWindow
+			c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+			require.NoError(t, err)
+
+			b := c.NewBatch()
+			for _, le := range []string{"0.05", "0.1"} {
+				err = b.AddPoint(common.MeasurementPrometheus,
+					map[string]string{"method": "post", "le": le},
+					map[string]interface{}{"http_request_duration_seconds_bucket": float64(24054)},
+					time.Unix(0, 1395066363000000123),
+					common.InfluxMetricValueTypeHistogram)
+				require.NoError(t, err)
+			}
+			if mergeWindow == 0 {
+				assert.Equal(t, 1, b.GetMetrics().DataPointCount())
+				assert.Equal(t, 0, b.IncompleteHistogramCount())
+			} else {
+				assert.Equal(t, 0, b.GetMetrics().DataPointCount())
+				assert.Equal(t, 1, b.IncompleteHistogramCount())
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package influx2otel
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// applyNameSuffixes infers units, and optionally trims suffixes, from Prometheus metric names.
+// Metrics that already have a unit are not changed.
+// A name is not trimmed if the trimmed name is already used by another metric in the same scope,
+// such as "http_requests_total" beside "http_requests".
+func (b *MetricsBatch) applyNameSuffixes() {
+	if !b.inferUnitFromName {
+		return
+	}
+	for i := 0; i < b.metrics.ResourceMetrics().Len(); i++ {
+		resourceMetrics := b.metrics.ResourceMetrics().At(i)
+		for j := 0; j < resourceMetrics.ScopeMetrics().Len(); j++ {
+			isMetrics := resourceMetrics.ScopeMetrics().At(j)
+			names := make(map[string]struct{}, isMetrics.Metrics().Len())
+			for k := 0; k < isMetrics.Metrics().Len(); k++ {
+				names[isMetrics.Metrics().At(k).Name()] = struct{}{}
+			}
+			for k := 0; k < isMetrics.Metrics().Len(); k++ {
+				metric := isMetrics.Metrics().At(k)
+				if metric.Unit() != "" {
+					continue
+				}
+
+				name := metric.Name()
+				if metric.Type() == pmetric.MetricTypeSum && strings.HasSuffix(name, common.MetricCounterSuffix) && len(name) > len(common.MetricCounterSuffix) {
+					metric.Sum().SetIsMonotonic(true)
+					name = strings.TrimSuffix(name, common.MetricCounterSuffix)
+				}
+				unit, trimmedName := common.UnitFromPrometheusName(name)
+				metric.SetUnit(unit)
+				if !b.trimNameSuffixes || trimmedName == metric.Name() {
+					continue
+				}
+				if _, found := names[trimmedName]; found {
+					b.logger.Debug("not trimming metric name suffixes; trimmed name collides with another metric",
+						"metric", metric.Name(), "trimmed", trimmedName)
+					continue
+				}
+				delete(names, metric.Name())
+				names[trimmedName] = struct{}{}
+				metric.SetName(trimmedName)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestInferUnitFromName(t *testing.T) {
+	for _, trim := range []bool{false, true} {
+		config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+		config.InferUnitFromName = true
+		config.TrimNameSuffixes = trim
+		c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+		require.NoError(t, err)
+
+		b := c.NewBatch()
+		err = b.AddPoint("process_cpu_seconds_total",
+			map[string]string{},
+			map[string]interface{}{"counter": float64(12.5)},
+			time.Unix(0, 1395066363000000123),
+			common.InfluxMetricValueTypeSum)
+		require.NoError(t, err)
+		err = b.AddPoint("process_resident_memory_bytes",
+			map[string]string{},
+			map[string]interface{}{"gauge": float64(4096)},
+			time.Unix(0, 1395066363000000123),
+			common.InfluxMetricValueTypeGauge)
+		require.NoError(t, err)
+		err = b.AddPoint("http_requests",
+			map[string]string{},
+			map[string]interface{}{"gauge": float64(3)},
+			time.Unix(0, 1395066363000000123),
+			common.InfluxMetricValueTypeGauge)
+		require.NoError(t, err)
+
+		expect := pmetric.NewMetrics()
+		isMetrics := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		m := isMetrics.Metrics().AppendEmpty()
+		if trim {
+			m.SetName("process_cpu")
+		} else {
+			m.SetName("process_cpu_seconds_total")
+		}
+		m.SetUnit("s")
+		m.SetEmptySum()
+		m.Sum().SetIsMonotonic(true)
+		m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		dp := m.Sum().DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+		dp.SetDoubleValue(12.5)
+		m = isMetrics.Metrics().AppendEmpty()
+		if trim {
+			m.SetName("process_resident_memory")
+		} else {
+			m.SetName("process_resident_memory_bytes")
+		}
+		m.SetUnit("By")
+		m.SetEmptyGauge()
+		dp = m.Gauge().DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+		dp.SetDoubleValue(4096)
+		m = isMetrics.Metrics().AppendEmpty()
+		m.SetName("http_requests")
+		m.SetEmptyGauge()
+		dp = m.Gauge().DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+		dp.SetDoubleValue(3)
+
+		assertMetricsEqual(t, expect, b.GetMetrics())
+	}
+}
+
+func TestInferUnitFromName_trimCollision(t *testing.T) {
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.InferUnitFromName = true
+	config.TrimNameSuffixes = true
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	for _, point := range []struct {
+		measurement string
+		field       string
+		vType       common.InfluxMetricValueType
+	}{
+		{"http_requests_total", "counter", common.InfluxMetricValueTypeSum},
+		{"http_requests", "gauge", common.InfluxMetricValueTypeGauge},
+		{"queue_latency_seconds", "gauge", common.InfluxMetricValueTypeGauge},
+		{"queue_latency_milliseconds", "gauge", common.InfluxMetricValueTypeGauge},
+	} {
+		err = b.AddPoint(point.measurement,
+			map[string]string{},
+			map[string]interface{}{point.field: float64(1)},
+			time.Unix(0, 1395066363000000123),
+			point.vType)
+		require.NoError(t, err)
+	}
+
+	metrics := b.GetMetrics().ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 4, metrics.Len())
+	var names, units []string
+	for i := 0; i < metrics.Len(); i++ {
+		names = append(names, metrics.At(i).Name())
+		units = append(units, metrics.At(i).Unit())
+	}
+	assert.Equal(t, []string{"http_requests_total", "http_requests", "queue_latency", "queue_latency_milliseconds"}, names)
+	assert.Equal(t, []string{"", "", "s", "ms"}, units)
+}
@@ -68,3 +68,48 @@ func TestUnknownSchema(t *testing.T) {
 
 	assertMetricsEqual(t, expect, b.GetMetrics())
 }
+
+func TestUnknownSchema_resourceAttributeClassifier(t *testing.T) {
+	classifier, err := common.NewResourceAttributeClassifier(&common.ResourceAttributeClassifierConfig{
+		IncludePatterns: []string{`^team$`, `^deployment\.region$`},
+		ExcludePatterns: []string{`^container\.name$`},
+	})
+	require.NoError(t, err)
+	config := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+	config.ResourceAttributes = classifier
+	c, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(config)
+	require.NoError(t, err)
+
+	b := c.NewBatch()
+	err = b.AddPoint("cpu",
+		map[string]string{
+			"container.name":    "42",
+			"deployment.region": "eu-west-1",
+			"host.name":         "777348dc6343",
+			"team":              "storage",
+			"cpu":               "cpu4",
+		},
+		map[string]interface{}{
+			"usage_user": 0.10090817356207936,
+		},
+		time.Unix(0, 1395066363000000123),
+		common.InfluxMetricValueTypeUntyped)
+	require.NoError(t, err)
+
+	expect := pmetric.NewMetrics()
+	rm := expect.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("deployment.region", "eu-west-1")
+	rm.Resource().Attributes().PutStr("host.name", "777348dc6343")
+	rm.Resource().Attributes().PutStr("team", "storage")
+	isMetrics := rm.ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("cpu_usage_user")
+	m.SetEmptyGauge()
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("container.name", "42")
+	dp.Attributes().PutStr("cpu", "cpu4")
+	dp.SetTimestamp(pcommon.Timestamp(1395066363000000123))
+	dp.SetDoubleValue(0.10090817356207936)
+
+	assertMetricsEqual(t, expect, b.GetMetrics())
+}
@@ -0,0 +1,440 @@
+package influx2otel
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+type ArrowToOtelTracesConfig struct {
+	Logger common.Logger
+	// ResourceAttributes decides which span tags and attributes are resource attributes;
+	// all others become span attributes.
+	ResourceAttributes *common.ResourceAttributeClassifier
+}
+
+func DefaultArrowToOtelTracesConfig() *ArrowToOtelTracesConfig {
+	return &ArrowToOtelTracesConfig{
+		Logger:             new(common.NoopLogger),
+		ResourceAttributes: common.DefaultResourceAttributeClassifier,
+	}
+}
+
+// ArrowToOtelTraces converts Arrow records queried from the spans, logs and span-links tables,
+// as written by otel2influx, to OpenTelemetry traces.
+type ArrowToOtelTraces struct {
+	logger             common.Logger
+	resourceAttributes *common.ResourceAttributeClassifier
+}
+
+func NewArrowToOtelTraces(logger common.Logger) (*ArrowToOtelTraces, error) {
+	config := DefaultArrowToOtelTracesConfig()
+	config.Logger = logger
+	return NewArrowToOtelTracesWithConfig(config)
+}
+
+func NewArrowToOtelTracesWithConfig(config *ArrowToOtelTracesConfig) (*ArrowToOtelTraces, error) {
+	resourceAttributes := config.ResourceAttributes
+	if resourceAttributes == nil {
+		resourceAttributes = common.DefaultResourceAttributeClassifier
+	}
+	return &ArrowToOtelTraces{
+		logger:             config.Logger,
+		resourceAttributes: resourceAttributes,
+	}, nil
+}
+
+func (c *ArrowToOtelTraces) NewBatch() *TracesBatch {
+	return &TracesBatch{
+		traces:             ptrace.NewTraces(),
+		rsByAttributes:     make(map[[16]byte]ptrace.ResourceSpans),
+		spanByID:           make(map[spanKey]ptrace.Span),
+		logger:             c.logger,
+		resourceAttributes: c.resourceAttributes,
+	}
+}
+
+type spanKey struct {
+	traceID pcommon.TraceID
+	spanID  pcommon.SpanID
+}
+
+type TracesBatch struct {
+	traces         ptrace.Traces
+	rsByAttributes map[[16]byte]ptrace.ResourceSpans
+	spanByID       map[spanKey]ptrace.Span
+
+	logger             common.Logger
+	resourceAttributes *common.ResourceAttributeClassifier
+}
+
+// GetTraces returns the spans added to the batch.
+func (b *TracesBatch) GetTraces() ptrace.Traces {
+	return b.traces
+}
+
+// AddSpansRecord adds the rows of a record queried from the spans table.
+// Tag columns, and the keys of the JSON-encoded attributes field, become resource attributes
+// or span attributes per the ResourceAttributes classifier.
+func (b *TracesBatch) AddSpansRecord(record arrow.Record) error {
+	kinds, err := arrowColumnKinds(record.Schema())
+	if err != nil {
+		return err
+	}
+	columns := record.Columns()
+	schemaFields := record.Schema().Fields()
+
+	for i := 0; i < int(record.NumRows()); i++ {
+		span := ptrace.NewSpan()
+		resourceAttributes := pcommon.NewMap()
+		var endTime, duration int64
+		var attributes map[string]interface{}
+
+		for j, column := range columns {
+			name := schemaFields[j].Name
+			if kinds[j] == arrowColumnTime {
+				ts, found := arrowTime(column, i)
+				if !found {
+					return fmt.Errorf("spans record row %d has no timestamp", i)
+				}
+				span.SetStartTimestamp(pcommon.NewTimestampFromTime(ts))
+				continue
+			}
+			v, found := arrowValue(column, i)
+			if !found {
+				continue
+			}
+			switch name {
+			case common.AttributeTraceID:
+				err = setArrowTraceID(span.SetTraceID, v)
+			case common.AttributeSpanID:
+				err = setArrowSpanID(span.SetSpanID, v)
+			case common.AttributeParentSpanID:
+				err = setArrowSpanID(span.SetParentSpanID, v)
+			case common.AttributeTraceState:
+				span.TraceState().FromRaw(fmt.Sprint(v))
+			case common.AttributeSpanName:
+				span.SetName(fmt.Sprint(v))
+			case common.AttributeSpanKind:
+				span.SetKind(spanKindFromString(fmt.Sprint(v)))
+			case common.AttributeEndTimeUnixNano:
+				endTime, err = arrowInt(name, v)
+			case common.AttributeDurationNano:
+				duration, err = arrowInt(name, v)
+			case common.AttributeDroppedAttributesCount:
+				err = setArrowCount(span.SetDroppedAttributesCount, name, v)
+			case common.AttributeDroppedEventsCount:
+				err = setArrowCount(span.SetDroppedEventsCount, name, v)
+			case common.AttributeDroppedLinksCount:
+				err = setArrowCount(span.SetDroppedLinksCount, name, v)
+			case semconv.OtelStatusCode:
+				span.Status().SetCode(statusCodeFromString(fmt.Sprint(v)))
+			case semconv.OtelStatusDescription:
+				span.Status().SetMessage(fmt.Sprint(v))
+			case common.AttributeAttributes:
+				attributes, err = decodeAttributesJSON(v)
+			default:
+				if b.resourceAttributes.IsResourceAttribute(name) {
+					err = resourceAttributes.PutEmpty(name).FromRaw(v)
+				} else {
+					err = span.Attributes().PutEmpty(name).FromRaw(v)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("spans record row %d: %w", i, err)
+			}
+		}
+
+		for k, v := range attributes {
+			if b.resourceAttributes.IsResourceAttribute(k) {
+				err = resourceAttributes.PutEmpty(k).FromRaw(v)
+			} else {
+				err = span.Attributes().PutEmpty(k).FromRaw(v)
+			}
+			if err != nil {
+				b.logger.Debug("invalid span attribute", "key", k, err)
+				span.SetDroppedAttributesCount(span.DroppedAttributesCount() + 1)
+			}
+		}
+
+		if span.TraceID().IsEmpty() || span.SpanID().IsEmpty() {
+			return fmt.Errorf("spans record row %d: %w", i, errors.New("incomplete span"))
+		}
+		if endTime != 0 {
+			span.SetEndTimestamp(pcommon.Timestamp(endTime))
+		} else if duration != 0 {
+			span.SetEndTimestamp(pcommon.NewTimestampFromTime(span.StartTimestamp().AsTime().Add(time.Duration(duration))))
+		}
+
+		newSpan := b.lookupScopeSpans(resourceAttributes).Spans().AppendEmpty()
+		span.MoveTo(newSpan)
+		b.spanByID[spanKey{newSpan.TraceID(), newSpan.SpanID()}] = newSpan
+	}
+	return nil
+}
+
+// AddSpanEventsRecord adds the rows of a record queried from the logs table as events
+// of the spans already added to the batch.
+// Rows of spans not in the batch, and log records that are not span events, are ignored.
+func (b *TracesBatch) AddSpanEventsRecord(record arrow.Record) error {
+	kinds, err := arrowColumnKinds(record.Schema())
+	if err != nil {
+		return err
+	}
+	columns := record.Columns()
+	schemaFields := record.Schema().Fields()
+
+	for i := 0; i < int(record.NumRows()); i++ {
+		event := ptrace.NewSpanEvent()
+		var key spanKey
+		isLogRecord := false
+
+		for j, column := range columns {
+			name := schemaFields[j].Name
+			if kinds[j] == arrowColumnTime {
+				ts, found := arrowTime(column, i)
+				if !found {
+					return fmt.Errorf("logs record row %d has no timestamp", i)
+				}
+				event.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+				continue
+			}
+			v, found := arrowValue(column, i)
+			if !found {
+				continue
+			}
+			switch name {
+			case common.AttributeTraceID:
+				err = setArrowTraceID(func(traceID pcommon.TraceID) { key.traceID = traceID }, v)
+			case common.AttributeSpanID:
+				err = setArrowSpanID(func(spanID pcommon.SpanID) { key.spanID = spanID }, v)
+			case semconv.AttributeEventName:
+				event.SetName(fmt.Sprint(v))
+			case common.AttributeDroppedAttributesCount:
+				err = setArrowCount(event.SetDroppedAttributesCount, name, v)
+			case common.AttributeAttributes:
+				var attributes map[string]interface{}
+				if attributes, err = decodeAttributesJSON(v); err == nil {
+					err = event.Attributes().FromRaw(attributes)
+				}
+			case common.AttributeBody, common.AttributeSeverityNumber, common.AttributeSeverityText:
+				isLogRecord = true
+			default:
+				err = event.Attributes().PutEmpty(name).FromRaw(v)
+			}
+			if err != nil {
+				return fmt.Errorf("logs record row %d: %w", i, err)
+			}
+		}
+
+		if isLogRecord {
+			continue
+		}
+		span, found := b.spanByID[key]
+		if !found {
+			b.logger.Debug("span event has no span in batch", "trace_id", key.traceID, "span_id", key.spanID)
+			continue
+		}
+		event.MoveTo(span.Events().AppendEmpty())
+	}
+	return nil
+}
+
+// AddSpanLinksRecord adds the rows of a record queried from the span-links table as links
+// of the spans already added to the batch.
+// Rows of spans not in the batch are ignored.
+func (b *TracesBatch) AddSpanLinksRecord(record arrow.Record) error {
+	kinds, err := arrowColumnKinds(record.Schema())
+	if err != nil {
+		return err
+	}
+	columns := record.Columns()
+	schemaFields := record.Schema().Fields()
+
+	for i := 0; i < int(record.NumRows()); i++ {
+		link := ptrace.NewSpanLink()
+		var key spanKey
+
+		for j, column := range columns {
+			if kinds[j] == arrowColumnTime {
+				continue
+			}
+			name := schemaFields[j].Name
+			v, found := arrowValue(column, i)
+			if !found {
+				continue
+			}
+			switch name {
+			case common.AttributeTraceID:
+				err = setArrowTraceID(func(traceID pcommon.TraceID) { key.traceID = traceID }, v)
+			case common.AttributeSpanID:
+				err = setArrowSpanID(func(spanID pcommon.SpanID) { key.spanID = spanID }, v)
+			case common.AttributeLinkedTraceID:
+				err = setArrowTraceID(link.SetTraceID, v)
+			case common.AttributeLinkedSpanID:
+				err = setArrowSpanID(link.SetSpanID, v)
+			case common.AttributeTraceState:
+				link.TraceState().FromRaw(fmt.Sprint(v))
+			case common.AttributeDroppedAttributesCount:
+				err = setArrowCount(link.SetDroppedAttributesCount, name, v)
+			case common.AttributeAttributes:
+				var attributes map[string]interface{}
+				if attributes, err = decodeAttributesJSON(v); err == nil {
+					err = link.Attributes().FromRaw(attributes)
+				}
+			default:
+				err = link.Attributes().PutEmpty(name).FromRaw(v)
+			}
+			if err != nil {
+				return fmt.Errorf("span-links record row %d: %w", i, err)
+			}
+		}
+
+		span, found := b.spanByID[key]
+		if !found {
+			b.logger.Debug("span link has no span in batch", "trace_id", key.traceID, "span_id", key.spanID)
+			continue
+		}
+		link.MoveTo(span.Links().AppendEmpty())
+	}
+	return nil
+}
+
+func (b *TracesBatch) lookupScopeSpans(resourceAttributes pcommon.Map) ptrace.ScopeSpans {
+	rKey := pdatautil.MapHash(resourceAttributes)
+	if resourceSpans, found := b.rsByAttributes[rKey]; found {
+		return resourceSpans.ScopeSpans().At(0)
+	}
+	resourceSpans := b.traces.ResourceSpans().AppendEmpty()
+	resourceAttributes.CopyTo(resourceSpans.Resource().Attributes())
+	b.rsByAttributes[rKey] = resourceSpans
+	return resourceSpans.ScopeSpans().AppendEmpty()
+}
+
+func setArrowTraceID(set func(pcommon.TraceID), v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("trace ID is type %T", v)
+	}
+	var traceID pcommon.TraceID
+	if b, err := hex.DecodeString(s); err != nil || len(b) != len(traceID) {
+		return fmt.Errorf("invalid trace ID '%s'", s)
+	} else {
+		copy(traceID[:], b)
+	}
+	set(traceID)
+	return nil
+}
+
+func setArrowSpanID(set func(pcommon.SpanID), v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("span ID is type %T", v)
+	}
+	var spanID pcommon.SpanID
+	if b, err := hex.DecodeString(s); err != nil || len(b) != len(spanID) {
+		return fmt.Errorf("invalid span ID '%s'", s)
+	} else {
+		copy(spanID[:], b)
+	}
+	set(spanID)
+	return nil
+}
+
+func arrowInt(name string, v interface{}) (int64, error) {
+	switch vv := v.(type) {
+	case int64:
+		return vv, nil
+	case uint64:
+		return int64(vv), nil
+	case float64:
+		return int64(vv), nil
+	default:
+		return 0, fmt.Errorf("%s is type %T", name, v)
+	}
+}
+
+func setArrowCount(set func(uint32), name string, v interface{}) error {
+	count, err := arrowInt(name, v)
+	if err != nil {
+		return err
+	}
+	set(uint32(count))
+	return nil
+}
+
+func spanKindFromString(s string) ptrace.SpanKind {
+	for _, kind := range []ptrace.SpanKind{
+		ptrace.SpanKindInternal,
+		ptrace.SpanKindServer,
+		ptrace.SpanKindClient,
+		ptrace.SpanKindProducer,
+		ptrace.SpanKindConsumer,
+	} {
+		if kind.String() == s {
+			return kind
+		}
+	}
+	return ptrace.SpanKindUnspecified
+}
+
+func statusCodeFromString(s string) ptrace.StatusCode {
+	switch s {
+	case ptrace.StatusCodeOk.String():
+		return ptrace.StatusCodeOk
+	case ptrace.StatusCodeError.String():
+		return ptrace.StatusCodeError
+	default:
+		return ptrace.StatusCodeUnset
+	}
+}
+
+// decodeAttributesJSON decodes the JSON-encoded attributes field written by otel2influx.
+// Integer numbers are decoded as int64, so that they round-trip as int attribute values.
+func decodeAttributesJSON(v interface{}) (map[string]interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("attributes is type %T", v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(s)))
+	decoder.UseNumber()
+	var attributes map[string]interface{}
+	if err := decoder.Decode(&attributes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON-encoded attributes: %w", err)
+	}
+	for k, v := range attributes {
+		attributes[k] = convertJSONNumbers(v)
+	}
+	return attributes, nil
+}
+
+func convertJSONNumbers(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case json.Number:
+		if i, err := vv.Int64(); err == nil {
+			return i
+		}
+		f, _ := vv.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range vv {
+			vv[k] = convertJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range vv {
+			vv[i] = convertJSONNumbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,131 @@
+package influx2otel_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatatest/ptracetest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+func TestTracesBatch_AddSpansRecord(t *testing.T) {
+	c, err := influx2otel.NewArrowToOtelTraces(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	spans := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "trace_id", Type: arrowTagType},
+			{Name: "span_id", Type: arrowTagType},
+			{Name: "service.name", Type: arrowTagType},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "parent_span_id", Type: arrow.BinaryTypes.String},
+			{Name: "span.name", Type: arrow.BinaryTypes.String},
+			{Name: "span.kind", Type: arrow.BinaryTypes.String},
+			{Name: "end_time_unix_nano", Type: arrow.PrimitiveTypes.Int64},
+			{Name: "duration_nano", Type: arrow.PrimitiveTypes.Int64},
+			{Name: "otel.status_code", Type: arrow.BinaryTypes.String},
+			{Name: "attributes", Type: arrow.BinaryTypes.String},
+		},
+		[]interface{}{
+			"00000000000000020000000000000001", "0000000000000003", "test-service",
+			time.Unix(0, 1000), nil, "cpu_temp", "Server", int64(3000), int64(2000), "Error",
+			`{"host.name":"h1","http.status_code":500,"ratio":0.5}`,
+		},
+		[]interface{}{
+			"00000000000000020000000000000001", "0000000000000004", "test-service",
+			time.Unix(0, 1500), "0000000000000003", "child", nil, int64(2500), int64(1000), nil, nil,
+		},
+	)
+	defer spans.Release()
+
+	events := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "trace_id", Type: arrowTagType},
+			{Name: "span_id", Type: arrowTagType},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "event.name", Type: arrow.BinaryTypes.String},
+			{Name: "body", Type: arrow.BinaryTypes.String},
+		},
+		[]interface{}{"00000000000000020000000000000001", "0000000000000003", time.Unix(0, 2000), "exception", nil},
+		[]interface{}{"00000000000000020000000000000001", "0000000000000003", time.Unix(0, 2100), nil, "a log record"},
+		[]interface{}{"00000000000000020000000000000001", "00000000000000ff", time.Unix(0, 2200), "orphan", nil},
+	)
+	defer events.Release()
+
+	links := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "trace_id", Type: arrowTagType},
+			{Name: "span_id", Type: arrowTagType},
+			{Name: "linked_trace_id", Type: arrowTagType},
+			{Name: "linked_span_id", Type: arrowTagType},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+			{Name: "attributes", Type: arrow.BinaryTypes.String},
+		},
+		[]interface{}{"00000000000000020000000000000001", "0000000000000004", "00000000000000050000000000000001", "0000000000000006", time.Unix(0, 1500), `{"k":"v"}`},
+	)
+	defer links.Release()
+
+	b := c.NewBatch()
+	require.NoError(t, b.AddSpansRecord(spans))
+	require.NoError(t, b.AddSpanEventsRecord(events))
+	require.NoError(t, b.AddSpanLinksRecord(links))
+
+	expect := ptrace.NewTraces()
+	rs := expect.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "test-service")
+	rs.Resource().Attributes().PutStr("host.name", "h1")
+	ss := rs.ScopeSpans().AppendEmpty()
+	span := ss.Spans().AppendEmpty()
+	span.SetTraceID([16]byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1})
+	span.SetSpanID([8]byte{0, 0, 0, 0, 0, 0, 0, 3})
+	span.SetName("cpu_temp")
+	span.SetKind(ptrace.SpanKindServer)
+	span.SetStartTimestamp(pcommon.Timestamp(1000))
+	span.SetEndTimestamp(pcommon.Timestamp(3000))
+	span.Status().SetCode(ptrace.StatusCodeError)
+	span.Attributes().PutInt("http.status_code", 500)
+	span.Attributes().PutDouble("ratio", 0.5)
+	event := span.Events().AppendEmpty()
+	event.SetName("exception")
+	event.SetTimestamp(pcommon.Timestamp(2000))
+
+	rs = expect.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "test-service")
+	span = rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1})
+	span.SetSpanID([8]byte{0, 0, 0, 0, 0, 0, 0, 4})
+	span.SetParentSpanID([8]byte{0, 0, 0, 0, 0, 0, 0, 3})
+	span.SetName("child")
+	span.SetStartTimestamp(pcommon.Timestamp(1500))
+	span.SetEndTimestamp(pcommon.Timestamp(2500))
+	link := span.Links().AppendEmpty()
+	link.SetTraceID([16]byte{0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 1})
+	link.SetSpanID([8]byte{0, 0, 0, 0, 0, 0, 0, 6})
+	link.Attributes().PutStr("k", "v")
+
+	assert.NoError(t, ptracetest.CompareTraces(expect, b.GetTraces(), ptracetest.IgnoreResourceSpansOrder()))
+}
+
+func TestTracesBatch_AddSpansRecordIncomplete(t *testing.T) {
+	c, err := influx2otel.NewArrowToOtelTraces(new(common.NoopLogger))
+	require.NoError(t, err)
+
+	spans := newArrowRecord(t,
+		[]arrow.Field{
+			{Name: "trace_id", Type: arrowTagType},
+			{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ns},
+		},
+		[]interface{}{"00000000000000020000000000000001", time.Unix(0, 1000)},
+	)
+	defer spans.Release()
+
+	assert.Error(t, c.NewBatch().AddSpansRecord(spans))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal"
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal/proxy"
+)
+
+const serviceName = "influxdb-otlp"
+
+func main() {
+	config := new(proxy.Config)
+	command := &cobra.Command{
+		Use:   serviceName,
+		Args:  cobra.NoArgs,
+		Short: serviceName + " receives line protocol with the InfluxDB write APIs, and exports it as OTLP metrics",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd.Context(), config)
+		},
+	}
+
+	if err := config.Init(command); err != nil {
+		fmt.Printf("failed to get config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	logger, err := initLogger(config)
+	if err != nil {
+		fmt.Printf("failed to start logger: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	ctx := contextWithStandardSignals(context.Background())
+	ctx = internal.LoggerWithContext(ctx, logger)
+	if err := command.ExecuteContext(ctx); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			fmt.Printf("%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func initLogger(config *proxy.Config) (*zap.Logger, error) {
+	var loggerConfig zap.Config
+	if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		loggerConfig = zap.NewDevelopmentConfig()
+	} else {
+		loggerConfig = zap.NewProductionConfig()
+	}
+	var err error
+	loggerConfig.Level, err = zap.ParseAtomicLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	return loggerConfig.Build(zap.AddStacktrace(zap.ErrorLevel))
+}
+
+func contextWithStandardSignals(ctx context.Context) context.Context {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			return
+		}
+	}()
+	return ctx
+}
+
+func run(ctx context.Context, config *proxy.Config) error {
+	logger := internal.LoggerFromContext(ctx)
+	p, err := proxy.NewProxy(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", config.ListenAddr)
+	if err != nil {
+		return multierr.Combine(err, p.Shutdown(ctx))
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- p.Serve(listener)
+	}()
+
+	logger.Info("ready")
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+		logger.Error("server failed", zap.Error(err))
+	}
+	logger.Info("exiting")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	return multierr.Combine(err, p.Shutdown(shutdownCtx))
+}
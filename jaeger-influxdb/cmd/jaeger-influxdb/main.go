@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -141,20 +142,46 @@ func run(ctx context.Context, config *internal.Config) error {
 		errCh <- grpcServer.Serve(grpcListener)
 	}()
 
+	var prometheusServer *http.Server
+	if config.PrometheusListenAddr != "" {
+		prometheusListener, err := net.Listen("tcp", config.PrometheusListenAddr)
+		if err != nil {
+			grpcServer.Stop()
+			return err
+		}
+		prometheusServer = &http.Server{
+			Handler:           internal.NewPrometheusQueryHandler(logger.With(zap.String("prometheus", "query")), backend.MetricsReader()),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := prometheusServer.Serve(prometheusListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Prometheus query API server failed", zap.Error(err))
+			}
+		}()
+	}
+
 	internal.LoggerFromContext(ctx).Info("ready")
 	<-ctx.Done()
 	internal.LoggerFromContext(ctx).Info("exiting")
 
+	if prometheusServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = prometheusServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+
 	grpcServer.GracefulStop()
 	select {
-	case err = <-errCh:
+	case serveErr := <-errCh:
+		err = multierr.Append(err, serveErr)
 	case <-time.After(5 * time.Second):
 		internal.LoggerFromContext(ctx).Warn("the gRPC server is being stubborn, so forcing it to stop")
 		grpcServer.Stop()
 		select {
-		case err = <-errCh:
+		case serveErr := <-errCh:
+			err = multierr.Append(err, serveErr)
 		case <-time.After(3 * time.Second):
-			err = errors.New("the gRPC server never stopped")
+			err = multierr.Append(err, errors.New("the gRPC server never stopped"))
 		}
 	}
 
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal"
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal/gateway"
+)
+
+const serviceName = "otlp-influxdb"
+
+func main() {
+	config := new(gateway.Config)
+	command := &cobra.Command{
+		Use:   serviceName,
+		Args:  cobra.NoArgs,
+		Short: serviceName + " receives OTLP traces, metrics and logs, and writes them to InfluxDB",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd.Context(), config)
+		},
+	}
+
+	if err := config.Init(command); err != nil {
+		fmt.Printf("failed to get config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	logger, err := initLogger(config)
+	if err != nil {
+		fmt.Printf("failed to start logger: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	ctx := contextWithStandardSignals(context.Background())
+	ctx = internal.LoggerWithContext(ctx, logger)
+	if err := command.ExecuteContext(ctx); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			fmt.Printf("%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func initLogger(config *gateway.Config) (*zap.Logger, error) {
+	var loggerConfig zap.Config
+	if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		loggerConfig = zap.NewDevelopmentConfig()
+	} else {
+		loggerConfig = zap.NewProductionConfig()
+	}
+	var err error
+	loggerConfig.Level, err = zap.ParseAtomicLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	return loggerConfig.Build(zap.AddStacktrace(zap.ErrorLevel))
+}
+
+func contextWithStandardSignals(ctx context.Context) context.Context {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			return
+		}
+	}()
+	return ctx
+}
+
+func listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+func run(ctx context.Context, config *gateway.Config) error {
+	logger := internal.LoggerFromContext(ctx)
+	g, err := gateway.NewGateway(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	var listeners []net.Listener
+	for _, addr := range []string{config.GRPCListenAddr, config.HTTPListenAddr, config.HealthListenAddr} {
+		listener, err := listen(addr)
+		if err != nil {
+			for _, l := range listeners {
+				if l != nil {
+					_ = l.Close()
+				}
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+			defer cancel()
+			return multierr.Combine(err, g.Shutdown(shutdownCtx))
+		}
+		listeners = append(listeners, listener)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.Serve(listeners[0], listeners[1], listeners[2])
+	}()
+
+	logger.Info("ready")
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+		logger.Error("server failed", zap.Error(err))
+	}
+	logger.Info("exiting")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	return multierr.Combine(err, g.Shutdown(shutdownCtx))
+}
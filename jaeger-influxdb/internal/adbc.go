@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow-adbc/go/adbc/driver/flightsql"
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"go.uber.org/multierr"
+)
+
+// adbcMaxIdleConns is the number of idle connections kept open per database.
+const adbcMaxIdleConns = 8
+
+// adbcDB queries an InfluxDB database (bucket) with the ADBC Flight SQL driver.
+// ADBC connections are not safe for concurrent use, so adbcDB keeps a pool of them.
+type adbcDB struct {
+	db   adbc.Database
+	idle chan adbc.Connection
+}
+
+func newADBCDB(options map[string]string) (*adbcDB, error) {
+	db, err := flightsql.NewDriver(memory.DefaultAllocator).NewDatabase(options)
+	if err != nil {
+		return nil, err
+	}
+	return &adbcDB{
+		db:   db,
+		idle: make(chan adbc.Connection, adbcMaxIdleConns),
+	}, nil
+}
+
+// query executes query and calls f with each record batch of the result.
+// Record batches are released after f returns.
+func (d *adbcDB) query(ctx context.Context, query string, f func(batch arrow.Record) error) error {
+	var conn adbc.Connection
+	select {
+	case conn = <-d.idle:
+	default:
+		var err error
+		if conn, err = d.db.Open(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := queryConn(ctx, conn, query, f); err != nil {
+		// The connection state is unknown
+		return multierr.Append(err, conn.Close())
+	}
+
+	select {
+	case d.idle <- conn:
+		return nil
+	default:
+		return conn.Close()
+	}
+}
+
+func queryConn(ctx context.Context, conn adbc.Connection, query string, f func(batch arrow.Record) error) error {
+	stmt, err := conn.NewStatement()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stmt.Close() }()
+	if err = stmt.SetSqlQuery(query); err != nil {
+		return err
+	}
+
+	reader, _, err := stmt.ExecuteQuery(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	for reader.Next() {
+		if err = f(reader.Record()); err != nil {
+			return err
+		}
+	}
+	return reader.Err()
+}
+
+func (d *adbcDB) Close() error {
+	var err error
+	for {
+		select {
+		case conn := <-d.idle:
+			err = multierr.Append(err, conn.Close())
+		default:
+			return multierr.Append(err, d.db.Close())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,124 +11,244 @@ import (
 	"time"
 
 	"github.com/apache/arrow-adbc/go/adbc"
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/opentracing/opentracing-go/ext"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
 
 	"github.com/influxdata/influxdb-observability/common"
 )
 
-func recordToSpan(record map[string]interface{}) (*model.Span, error) {
-	span := model.Span{
-		Process: &model.Process{
-			ServiceName: "<unknown>",
-		},
-	}
-	parentSpanRef := model.SpanRef{
-		RefType: model.SpanRefType_CHILD_OF,
-	}
-	// TODO add more process attributes
-	var err error
-	for k, v := range record {
-		if vv, ok := v.(string); (ok && vv == "NULL") || (!ok && v == nil) {
-			continue
-		}
-		switch k {
+// unknownServiceName is the service name of spans without a service.name resource attribute.
+const unknownServiceName = "<unknown>"
+
+// spanDecoder converts the rows of a spans table record batch to spans.
+// Columns are resolved once per batch, then values are read by column index.
+type spanDecoder struct {
+	columns []arrow.Array
+	setters []func(span *model.Span, parentSpanRef *model.SpanRef, row int) error
+	// warnings describe columns of unexpected types, which are decoded as span tags
+	warnings []string
+}
+
+func newSpanDecoder(batch arrow.Record, resourceAttributes *common.ResourceAttributeClassifier) (*spanDecoder, error) {
+	d := new(spanDecoder)
+	for i, column := range batch.Columns() {
+		var setter func(span *model.Span, parentSpanRef *model.SpanRef, row int) error
+		switch k := batch.ColumnName(i); k {
 		case common.AttributeTime:
-			if vv, ok := v.(time.Time); !ok {
-				return nil, fmt.Errorf("time is type %T", v)
-			} else {
-				span.StartTime = vv
+			values, ok := arrowTimeValues(column)
+			if !ok {
+				return nil, fmt.Errorf("time is type %s", column.DataType())
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.StartTime = values(row)
+				return nil
 			}
 		case common.AttributeTraceID:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("trace ID is type %T", v)
-			} else if span.TraceID, err = model.TraceIDFromString(vv); err != nil {
-				return nil, err
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("trace ID is type %s", column.DataType())
+			}
+			setter = func(span *model.Span, parentSpanRef *model.SpanRef, row int) (err error) {
+				span.TraceID, err = model.TraceIDFromString(values(row))
+				parentSpanRef.TraceID = span.TraceID
+				return err
 			}
-			parentSpanRef.TraceID = span.TraceID
 		case common.AttributeSpanID:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("span ID is type %T", v)
-			} else if span.SpanID, err = model.SpanIDFromString(vv); err != nil {
-				return nil, err
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("span ID is type %s", column.DataType())
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) (err error) {
+				span.SpanID, err = model.SpanIDFromString(values(row))
+				return err
 			}
 		case semconv.AttributeServiceName:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("service name is type %T", v)
-			} else {
-				span.Process.ServiceName = vv
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "service name", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.Process.ServiceName = values(row)
+				return nil
 			}
 		case common.AttributeSpanName:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("operation name is type %T", v)
-			} else {
-				span.OperationName = vv
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "operation name", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.OperationName = values(row)
+				return nil
 			}
 		case common.AttributeSpanKind:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("span kind is type %T", v)
-			} else {
-				switch vv {
-				case ptrace.SpanKindServer.String():
-					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), string(ext.SpanKindRPCServerEnum)))
-				case ptrace.SpanKindClient.String():
-					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), string(ext.SpanKindRPCClientEnum)))
-				case ptrace.SpanKindProducer.String():
-					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), string(ext.SpanKindProducerEnum)))
-				case ptrace.SpanKindConsumer.String():
-					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), string(ext.SpanKindConsumerEnum)))
-				case ptrace.SpanKindInternal.String():
-					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), "internal"))
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "span kind", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				if spanKind := spanKindToJaeger(values(row)); spanKind != "" {
+					span.Tags = append(span.Tags, model.String(string(ext.SpanKind), spanKind))
 				}
+				return nil
 			}
 		case common.AttributeDurationNano:
-			if vv, ok := v.(int64); !ok {
-				return nil, fmt.Errorf("duration nanoseconds is type %T", v)
-			} else {
-				span.Duration = time.Duration(vv)
+			values, ok := column.(*array.Int64)
+			if !ok {
+				setter = d.stringifyColumn(k, "duration nanoseconds", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.Duration = time.Duration(values.Value(row))
+				return nil
 			}
 		case common.AttributeEndTimeUnixNano:
 			// Jaeger likes duration ^^
 			continue
+		case columnSpanRank:
+			continue
 		case common.AttributeParentSpanID:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("parent span ID is type %T", v)
-			} else {
-				parentSpanRef.SpanID, err = model.SpanIDFromString(vv)
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "parent span ID", column)
+				break
 			}
-			if err != nil {
-				return nil, err
+			setter = func(span *model.Span, parentSpanRef *model.SpanRef, row int) (err error) {
+				if parentSpanRef.SpanID, err = model.SpanIDFromString(values(row)); err != nil {
+					span.Warnings = append(span.Warnings, fmt.Sprintf("failed to decode parent span ID: %s", err))
+				}
+				return nil
 			}
 		case semconv.OtelStatusCode:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("status code is type %T", v)
-			} else {
-				span.Tags = append(span.Tags, model.String(k, vv))
-				if v == ptrace.StatusCodeError {
-					span.Tags = append(span.Tags, model.Bool("error", true))
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "status code", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				v := values(row)
+				span.Tags = append(span.Tags, model.String(k, v))
+				if v == ptrace.StatusCodeError.String() {
+					span.Tags = append(span.Tags, model.Bool(string(ext.Error), true))
 				}
+				return nil
 			}
 		case common.AttributeAttributes:
-			if vv, ok := v.(string); !ok {
-				return nil, fmt.Errorf("attribute is type %T", v)
-			} else {
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "attribute", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
 				m := make(map[string]interface{})
-				if err = json.Unmarshal([]byte(vv), &m); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal JSON-encoded attributes: %w", err)
+				if err := json.Unmarshal([]byte(values(row)), &m); err != nil {
+					span.Warnings = append(span.Warnings, fmt.Sprintf("failed to unmarshal JSON-encoded attributes: %s", err))
+					return nil
 				}
+				// Resource attributes that are not dimension columns are in the JSON-encoded attributes
 				for attributeKey, attributeValue := range m {
-					span.Tags = append(span.Tags, kvToKeyValue(attributeKey, attributeValue))
+					if attributeKey == semconv.AttributeServiceName {
+						// The service name column, before or after this column, takes precedence
+						if serviceName, ok := attributeValue.(string); ok && span.Process.ServiceName == unknownServiceName {
+							span.Process.ServiceName = serviceName
+						}
+						continue
+					}
+					if resourceAttributes.IsResourceAttribute(attributeKey) {
+						span.Process.Tags = append(span.Process.Tags, kvToKeyValue(attributeKey, attributeValue))
+					} else {
+						span.Tags = append(span.Tags, kvToKeyValue(attributeKey, attributeValue))
+					}
+				}
+				return nil
+			}
+		case common.AttributeTraceState:
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "trace state", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.Tags = append(span.Tags, model.String(tagW3CTraceState, values(row)))
+				return nil
+			}
+		case semconv.OtelStatusDescription:
+			values, ok := arrowStringValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, "status description", column)
+				break
+			}
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				span.Tags = append(span.Tags, model.String(k, values(row)))
+				return nil
+			}
+		case common.AttributeDroppedAttributesCount, common.AttributeDroppedEventsCount, common.AttributeDroppedLinksCount:
+			values, ok := arrowCountValues(column)
+			if !ok {
+				setter = d.stringifyColumn(k, k, column)
+				break
+			}
+			what := strings.TrimSuffix(strings.TrimPrefix(k, "dropped_"), "_count")
+			setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+				if count := values(row); count > 0 {
+					span.Warnings = append(span.Warnings, fmt.Sprintf("%d %s dropped", count, what))
 				}
+				return nil
 			}
 		default:
-			if common.ResourceNamespace.MatchString(k) {
-				span.Process.Tags = append(span.Process.Tags, kvToKeyValue(k, v))
+			keyValue := arrowKeyValues(k, column)
+			if resourceAttributes.IsResourceAttribute(k) {
+				setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+					span.Process.Tags = append(span.Process.Tags, keyValue(row))
+					return nil
+				}
 			} else {
-				span.Tags = append(span.Tags, kvToKeyValue(k, v))
+				setter = func(span *model.Span, _ *model.SpanRef, row int) error {
+					span.Tags = append(span.Tags, keyValue(row))
+					return nil
+				}
 			}
 		}
+		d.columns = append(d.columns, column)
+		d.setters = append(d.setters, setter)
+	}
+	return d, nil
+}
+
+// stringifyColumn decodes a column of an unexpected type as a span tag, rather than failing the record batch.
+// Only the time, trace ID and span ID columns are required to be of the expected types.
+func (d *spanDecoder) stringifyColumn(k, what string, column arrow.Array) func(span *model.Span, _ *model.SpanRef, row int) error {
+	d.warnings = append(d.warnings, fmt.Sprintf("%s is type %s", what, column.DataType()))
+	keyValue := arrowKeyValues(k, column)
+	return func(span *model.Span, _ *model.SpanRef, row int) error {
+		span.Tags = append(span.Tags, keyValue(row))
+		return nil
+	}
+}
+
+func (d *spanDecoder) span(row int) (*model.Span, error) {
+	span := model.Span{
+		Process: &model.Process{
+			ServiceName: unknownServiceName,
+		},
+	}
+	parentSpanRef := model.SpanRef{
+		RefType: model.SpanRefType_CHILD_OF,
+	}
+	for i, column := range d.columns {
+		if column.IsNull(row) {
+			continue
+		}
+		if err := d.setters[i](&span, &parentSpanRef, row); err != nil {
+			return nil, err
+		}
 	}
 
 	if span.StartTime.IsZero() || (span.TraceID.High == 0 && span.TraceID.Low == 0) || span.SpanID == 0 {
@@ -155,87 +276,128 @@ func kvToKeyValue(k string, v interface{}) model.KeyValue {
 	}
 }
 
-func recordToLog(record map[string]interface{}) (model.TraceID, model.SpanID, *model.Log, error) {
-	log := new(model.Log)
-	var traceID model.TraceID
-	var spanID model.SpanID
-	var err error
-	for k, v := range record {
-		if vv, ok := v.(string); ok && vv == "NULL" {
-			continue
-		}
-		switch k {
+// logDecoder converts the rows of a logs (span events) table record batch to logs.
+type logDecoder struct {
+	columns []arrow.Array
+	setters []func(traceID *model.TraceID, spanID *model.SpanID, log *model.Log, row int) error
+}
+
+func newLogDecoder(batch arrow.Record) (*logDecoder, error) {
+	d := new(logDecoder)
+	for i, column := range batch.Columns() {
+		var setter func(traceID *model.TraceID, spanID *model.SpanID, log *model.Log, row int) error
+		switch k := batch.ColumnName(i); k {
 		case common.AttributeTime:
-			if vv, ok := v.(time.Time); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("time is type %T", v)
-			} else {
-				log.Timestamp = vv
+			values, ok := arrowTimeValues(column)
+			if !ok {
+				return nil, fmt.Errorf("time is type %s", column.DataType())
+			}
+			setter = func(_ *model.TraceID, _ *model.SpanID, log *model.Log, row int) error {
+				log.Timestamp = values(row)
+				return nil
 			}
 		case common.AttributeTraceID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("trace ID is type %T", v)
-			} else if traceID, err = model.TraceIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("trace ID is type %s", column.DataType())
+			}
+			setter = func(traceID *model.TraceID, _ *model.SpanID, _ *model.Log, row int) (err error) {
+				*traceID, err = model.TraceIDFromString(values(row))
+				return err
 			}
 		case common.AttributeSpanID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("span ID is type %T", v)
-			} else if spanID, err = model.SpanIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("span ID is type %s", column.DataType())
+			}
+			setter = func(_ *model.TraceID, spanID *model.SpanID, _ *model.Log, row int) (err error) {
+				*spanID, err = model.SpanIDFromString(values(row))
+				return err
 			}
 		case semconv.AttributeEventName:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("log name is type %T", v)
-			} else {
-				log.Fields = append(log.Fields, model.String("event", vv))
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("log name is type %s", column.DataType())
+			}
+			setter = func(_ *model.TraceID, _ *model.SpanID, log *model.Log, row int) error {
+				log.Fields = append(log.Fields, model.String("event", values(row)))
+				return nil
 			}
 		case common.AttributeBody:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("log body is type %T", v)
-			} else {
-				log.Fields = append(log.Fields, model.String("message", vv))
+			values, ok := arrowStringValues(column)
+			if !ok {
+				return nil, fmt.Errorf("log body is type %s", column.DataType())
+			}
+			setter = func(_ *model.TraceID, _ *model.SpanID, log *model.Log, row int) error {
+				log.Fields = append(log.Fields, model.String("message", values(row)))
+				return nil
 			}
 		case common.AttributeAttributes:
-			vv, ok := v.(string)
+			values, ok := arrowStringValues(column)
 			if !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("log attributes attribute is type %T", v)
-			}
-			var m map[string]interface{}
-			if err = json.Unmarshal([]byte(vv), &m); err != nil {
-				return model.TraceID{}, 0, nil, fmt.Errorf("failed to unmarshal attributes from JSON: %w", err)
-			}
-			for mk, mv := range m {
-				switch mvv := mv.(type) {
-				case nil:
-					log.Fields = append(log.Fields, model.String(mk, ""))
-				case bool:
-					log.Fields = append(log.Fields, model.Bool(mk, mvv))
-				case float64:
-					if intPart, fracPart := math.Modf(mvv); fracPart == 0 {
-						log.Fields = append(log.Fields, model.Int64(mk, int64(intPart)))
-					} else {
-						log.Fields = append(log.Fields, model.Float64(mk, mvv))
-					}
-				case string:
-					log.Fields = append(log.Fields, model.String(mk, mvv))
-				case []interface{}:
-					s := make([]string, len(mvv))
-					for i := range mvv {
-						if mvv[i] == nil {
-							s[i] = ""
+				return nil, fmt.Errorf("log attributes attribute is type %s", column.DataType())
+			}
+			setter = func(_ *model.TraceID, _ *model.SpanID, log *model.Log, row int) error {
+				var m map[string]interface{}
+				if err := json.Unmarshal([]byte(values(row)), &m); err != nil {
+					return fmt.Errorf("failed to unmarshal attributes from JSON: %w", err)
+				}
+				for mk, mv := range m {
+					switch mvv := mv.(type) {
+					case nil:
+						log.Fields = append(log.Fields, model.String(mk, ""))
+					case bool:
+						log.Fields = append(log.Fields, model.Bool(mk, mvv))
+					case float64:
+						if intPart, fracPart := math.Modf(mvv); fracPart == 0 {
+							log.Fields = append(log.Fields, model.Int64(mk, int64(intPart)))
 						} else {
-							s[i] = fmt.Sprint(mvv[i])
+							log.Fields = append(log.Fields, model.Float64(mk, mvv))
+						}
+					case string:
+						log.Fields = append(log.Fields, model.String(mk, mvv))
+					case []interface{}:
+						s := make([]string, len(mvv))
+						for i := range mvv {
+							if mvv[i] == nil {
+								s[i] = ""
+							} else {
+								s[i] = fmt.Sprint(mvv[i])
+							}
 						}
+						log.Fields = append(log.Fields, model.String(mk, strings.Join(s, ",")))
+					default:
+						// ignore
 					}
-					log.Fields = append(log.Fields, model.String(mk, strings.Join(s, ",")))
-				default:
-					// ignore
 				}
+				return nil
 			}
 		case semconv.AttributeServiceName:
 			// The span has this information, no need to duplicate
+			continue
 		default:
-			log.Fields = append(log.Fields, kvToKeyValue(k, v))
+			keyValue := arrowKeyValues(k, column)
+			setter = func(_ *model.TraceID, _ *model.SpanID, log *model.Log, row int) error {
+				log.Fields = append(log.Fields, keyValue(row))
+				return nil
+			}
+		}
+		d.columns = append(d.columns, column)
+		d.setters = append(d.setters, setter)
+	}
+	return d, nil
+}
+
+func (d *logDecoder) log(row int) (model.TraceID, model.SpanID, *model.Log, error) {
+	log := new(model.Log)
+	var traceID model.TraceID
+	var spanID model.SpanID
+	for i, column := range d.columns {
+		if column.IsNull(row) {
+			continue
+		}
+		if err := d.setters[i](&traceID, &spanID, log, row); err != nil {
+			return model.TraceID{}, 0, nil, err
 		}
 	}
 
@@ -246,45 +408,64 @@ func recordToLog(record map[string]interface{}) (model.TraceID, model.SpanID, *m
 	return traceID, spanID, log, nil
 }
 
-func recordToSpanRef(record map[string]interface{}) (model.TraceID, model.SpanID, *model.SpanRef, error) {
-	spanRef := &model.SpanRef{
-		RefType: model.FollowsFrom,
-	}
-	var traceID model.TraceID
-	var spanID model.SpanID
-	var err error
-	for k, v := range record {
-		if vv, ok := v.(string); ok && vv == "NULL" {
-			continue
-		}
-		switch k {
+// spanRefDecoder converts the rows of a span links table record batch to span references.
+type spanRefDecoder struct {
+	traceID, spanID, linkedTraceID, linkedSpanID func(row int) string
+	columns                                      []arrow.Array
+}
+
+func newSpanRefDecoder(batch arrow.Record) (*spanRefDecoder, error) {
+	d := new(spanRefDecoder)
+	for i, column := range batch.Columns() {
+		var values *func(row int) string
+		var description string
+		switch batch.ColumnName(i) {
 		case common.AttributeTraceID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("trace ID is type %T", v)
-			} else if traceID, err = model.TraceIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
-			}
+			values, description = &d.traceID, "trace ID"
 		case common.AttributeSpanID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("span ID is type %T", v)
-			} else if spanID, err = model.SpanIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
-			}
+			values, description = &d.spanID, "span ID"
 		case common.AttributeLinkedTraceID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("linked trace ID is type %T", v)
-			} else if spanRef.TraceID, err = model.TraceIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
-			}
+			values, description = &d.linkedTraceID, "linked trace ID"
 		case common.AttributeLinkedSpanID:
-			if vv, ok := v.(string); !ok {
-				return model.TraceID{}, 0, nil, fmt.Errorf("linked span ID is type %T", v)
-			} else if spanRef.SpanID, err = model.SpanIDFromString(vv); err != nil {
-				return model.TraceID{}, 0, nil, err
-			}
+			values, description = &d.linkedSpanID, "linked span ID"
 		default:
 			// OpenTelemetry links do not have timestamps/attributes/fields/labels
+			continue
+		}
+		var ok bool
+		if *values, ok = arrowStringValues(column); !ok {
+			return nil, fmt.Errorf("%s is type %s", description, column.DataType())
 		}
+		d.columns = append(d.columns, column)
+	}
+	return d, nil
+}
+
+func (d *spanRefDecoder) spanRef(row int) (model.TraceID, model.SpanID, *model.SpanRef, error) {
+	if d.traceID == nil || d.spanID == nil || d.linkedTraceID == nil || d.linkedSpanID == nil {
+		return model.TraceID{}, 0, nil, errors.New("incomplete span link")
+	}
+	for _, column := range d.columns {
+		if column.IsNull(row) {
+			return model.TraceID{}, 0, nil, errors.New("incomplete span link")
+		}
+	}
+	spanRef := &model.SpanRef{
+		RefType: model.FollowsFrom,
+	}
+	traceID, err := model.TraceIDFromString(d.traceID(row))
+	if err != nil {
+		return model.TraceID{}, 0, nil, err
+	}
+	spanID, err := model.SpanIDFromString(d.spanID(row))
+	if err != nil {
+		return model.TraceID{}, 0, nil, err
+	}
+	if spanRef.TraceID, err = model.TraceIDFromString(d.linkedTraceID(row)); err != nil {
+		return model.TraceID{}, 0, nil, err
+	}
+	if spanRef.SpanID, err = model.SpanIDFromString(d.linkedSpanID(row)); err != nil {
+		return model.TraceID{}, 0, nil, err
 	}
 
 	if (spanRef.TraceID.High == 0 && spanRef.TraceID.Low == 0) || spanRef.SpanID == 0 || (traceID.High == 0 && traceID.Low == 0) || spanID == 0 {
@@ -294,9 +475,274 @@ func recordToSpanRef(record map[string]interface{}) (model.TraceID, model.SpanID
 	return traceID, spanID, spanRef, nil
 }
 
+// arrowStringValues returns the values of a string column.
+// InfluxDB dictionary-encodes tag columns.
+func arrowStringValues(column arrow.Array) (func(row int) string, bool) {
+	switch column := column.(type) {
+	case *array.String:
+		return column.Value, true
+	case *array.LargeString:
+		return column.Value, true
+	case *array.Dictionary:
+		if values, ok := arrowStringValues(column.Dictionary()); ok {
+			return func(row int) string { return values(column.GetValueIndex(row)) }, true
+		}
+	}
+	return nil, false
+}
+
+// arrowCountValues returns the values of an integer column.
+func arrowCountValues(column arrow.Array) (func(row int) uint64, bool) {
+	switch column := column.(type) {
+	case *array.Uint64:
+		return column.Value, true
+	case *array.Int64:
+		return func(row int) uint64 { return uint64(max(column.Value(row), 0)) }, true
+	}
+	return nil, false
+}
+
+func arrowTimeValues(column arrow.Array) (func(row int) time.Time, bool) {
+	if column, ok := column.(*array.Timestamp); ok {
+		unit := column.DataType().(*arrow.TimestampType).Unit
+		return func(row int) time.Time { return column.Value(row).ToTime(unit) }, true
+	}
+	return nil, false
+}
+
+// arrowKeyValues returns the values of a column as tags.
+func arrowKeyValues(k string, column arrow.Array) func(row int) model.KeyValue {
+	switch column := column.(type) {
+	case *array.Boolean:
+		return func(row int) model.KeyValue { return model.Bool(k, column.Value(row)) }
+	case *array.Int64:
+		return func(row int) model.KeyValue { return model.Int64(k, column.Value(row)) }
+	case *array.Float64:
+		return func(row int) model.KeyValue { return model.Float64(k, column.Value(row)) }
+	}
+	if values, ok := arrowStringValues(column); ok {
+		return func(row int) model.KeyValue { return model.String(k, values(row)) }
+	}
+	return func(row int) model.KeyValue { return model.String(k, fmt.Sprint(arrowValue(column, row))) }
+}
+
+// arrowValue returns a non-null value of a column as a Go value.
+func arrowValue(column arrow.Array, row int) interface{} {
+	switch column := column.(type) {
+	case *array.Boolean:
+		return column.Value(row)
+	case *array.Int8:
+		return column.Value(row)
+	case *array.Uint8:
+		return column.Value(row)
+	case *array.Int16:
+		return column.Value(row)
+	case *array.Uint16:
+		return column.Value(row)
+	case *array.Int32:
+		return column.Value(row)
+	case *array.Uint32:
+		return column.Value(row)
+	case *array.Int64:
+		return column.Value(row)
+	case *array.Uint64:
+		return column.Value(row)
+	case *array.Float32:
+		return column.Value(row)
+	case *array.Float64:
+		return column.Value(row)
+	case *array.String:
+		return column.Value(row)
+	case *array.LargeString:
+		return column.Value(row)
+	case *array.Binary:
+		return column.Value(row)
+	case *array.LargeBinary:
+		return column.Value(row)
+	case *array.Timestamp:
+		return column.Value(row).ToTime(column.DataType().(*arrow.TimestampType).Unit)
+	case *array.Dictionary:
+		return arrowValue(column.Dictionary(), column.GetValueIndex(row))
+	default:
+		return column.ValueStr(row)
+	}
+}
+
+// recordBatchToMaps calls f with each row of batch, keyed by column name; null values are omitted.
+// The map is reused between rows.
+func recordBatchToMaps(batch arrow.Record, f func(record map[string]interface{}) error) error {
+	columns := batch.Columns()
+	m := make(map[string]interface{}, len(columns))
+	for row := 0; row < int(batch.NumRows()); row++ {
+		for i, column := range columns {
+			if column.IsNull(row) {
+				delete(m, batch.ColumnName(i))
+			} else {
+				m[batch.ColumnName(i)] = arrowValue(column, row)
+			}
+		}
+		if err := f(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var errTableNotFound = regexp.MustCompile(`table '\S+' not found`)
 
 func isTableNotFound(err error) bool {
 	aerr, ok := err.(adbc.Error)
 	return ok && errTableNotFound.MatchString(aerr.Msg)
 }
+
+// spanToTraces converts a Jaeger span to OpenTelemetry traces,
+// so that it can be written with the same schema as otel2influx.
+// This is the inverse of spanDecoder, logDecoder and spanRefDecoder.
+func spanToTraces(span *model.Span) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	resourceSpans := traces.ResourceSpans().AppendEmpty()
+	if span.Process != nil {
+		resourceAttributes := resourceSpans.Resource().Attributes()
+		for _, tag := range span.Process.Tags {
+			putKeyValue(resourceAttributes, tag)
+		}
+		if span.Process.ServiceName != "" {
+			resourceAttributes.PutStr(semconv.AttributeServiceName, span.Process.ServiceName)
+		}
+	}
+	scopeSpans := resourceSpans.ScopeSpans().AppendEmpty()
+	otelSpan := scopeSpans.Spans().AppendEmpty()
+
+	otelSpan.SetTraceID(traceIDToOtel(span.TraceID))
+	otelSpan.SetSpanID(spanIDToOtel(span.SpanID))
+	otelSpan.SetName(span.OperationName)
+	otelSpan.SetStartTimestamp(pcommon.NewTimestampFromTime(span.StartTime))
+	otelSpan.SetEndTimestamp(pcommon.NewTimestampFromTime(span.StartTime.Add(span.Duration)))
+
+	parentSpanID := span.ParentSpanID()
+	if parentSpanID != 0 {
+		otelSpan.SetParentSpanID(spanIDToOtel(parentSpanID))
+	}
+	for _, ref := range span.References {
+		if ref.TraceID == span.TraceID && ref.SpanID == parentSpanID {
+			continue
+		}
+		link := otelSpan.Links().AppendEmpty()
+		link.SetTraceID(traceIDToOtel(ref.TraceID))
+		link.SetSpanID(spanIDToOtel(ref.SpanID))
+		if ref.RefType == model.ChildOf {
+			link.Attributes().PutStr(semconv.AttributeOpentracingRefType, semconv.AttributeOpentracingRefTypeChildOf)
+		} else {
+			link.Attributes().PutStr(semconv.AttributeOpentracingRefType, semconv.AttributeOpentracingRefTypeFollowsFrom)
+		}
+	}
+
+	foundStatusCode := false
+	isError := false
+	attributes := otelSpan.Attributes()
+	for _, tag := range span.Tags {
+		switch tag.Key {
+		case string(ext.SpanKind):
+			otelSpan.SetKind(spanKindToOtel(tag.AsString()))
+		case semconv.OtelStatusCode:
+			switch tag.AsString() {
+			case ptrace.StatusCodeOk.String(), "OK":
+				otelSpan.Status().SetCode(ptrace.StatusCodeOk)
+				foundStatusCode = true
+			case ptrace.StatusCodeError.String(), "ERROR":
+				otelSpan.Status().SetCode(ptrace.StatusCodeError)
+				foundStatusCode = true
+			}
+		case semconv.OtelStatusDescription:
+			otelSpan.Status().SetMessage(tag.AsString())
+		case string(ext.Error):
+			isError = tag.VType == model.BoolType && tag.Bool()
+		case tagW3CTraceState:
+			otelSpan.TraceState().FromRaw(tag.AsString())
+		case semconv.OtelLibraryName, tagOtelScopeName:
+			scopeSpans.Scope().SetName(tag.AsString())
+		case semconv.OtelLibraryVersion, tagOtelScopeVersion:
+			scopeSpans.Scope().SetVersion(tag.AsString())
+		default:
+			putKeyValue(attributes, tag)
+		}
+	}
+	if isError && !foundStatusCode {
+		otelSpan.Status().SetCode(ptrace.StatusCodeError)
+	}
+
+	for _, log := range span.Logs {
+		event := otelSpan.Events().AppendEmpty()
+		event.SetTimestamp(pcommon.NewTimestampFromTime(log.Timestamp))
+		for _, field := range log.Fields {
+			if field.Key == "event" && event.Name() == "" {
+				event.SetName(field.AsString())
+			} else {
+				putKeyValue(event.Attributes(), field)
+			}
+		}
+	}
+
+	return traces
+}
+
+const (
+	tagW3CTraceState    = "w3c.tracestate"
+	tagOtelScopeName    = "otel.scope.name"
+	tagOtelScopeVersion = "otel.scope.version"
+)
+
+func putKeyValue(m pcommon.Map, kv model.KeyValue) {
+	switch kv.VType {
+	case model.StringType:
+		m.PutStr(kv.Key, kv.VStr)
+	case model.BoolType:
+		m.PutBool(kv.Key, kv.VBool)
+	case model.Int64Type:
+		m.PutInt(kv.Key, kv.VInt64)
+	case model.Float64Type:
+		m.PutDouble(kv.Key, kv.VFloat64)
+	case model.BinaryType:
+		m.PutEmptyBytes(kv.Key).FromRaw(kv.VBinary)
+	}
+}
+
+func traceIDToOtel(traceID model.TraceID) pcommon.TraceID {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], traceID.High)
+	binary.BigEndian.PutUint64(b[8:], traceID.Low)
+	return b
+}
+
+func spanIDToOtel(spanID model.SpanID) pcommon.SpanID {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(spanID))
+	return b
+}
+
+// spanKindToJaeger converts span kind names of the spans table ("Server")
+// and of the spanmetrics connector ("SPAN_KIND_SERVER") to Jaeger span kind names ("server").
+func spanKindToJaeger(spanKind string) string {
+	spanKind = strings.ToLower(strings.TrimPrefix(spanKind, "SPAN_KIND_"))
+	if spanKindToOtel(spanKind) == ptrace.SpanKindUnspecified {
+		return ""
+	}
+	return spanKind
+}
+
+func spanKindToOtel(spanKind string) ptrace.SpanKind {
+	switch spanKind {
+	case string(ext.SpanKindRPCServerEnum):
+		return ptrace.SpanKindServer
+	case string(ext.SpanKindRPCClientEnum):
+		return ptrace.SpanKindClient
+	case string(ext.SpanKindProducerEnum):
+		return ptrace.SpanKindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return ptrace.SpanKindConsumer
+	case "internal":
+		return ptrace.SpanKindInternal
+	default:
+		return ptrace.SpanKindUnspecified
+	}
+}
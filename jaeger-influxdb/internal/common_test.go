@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+// withDictionaryColumn appends a dictionary-encoded string column to batch, as InfluxDB encodes tags.
+func withDictionaryColumn(t *testing.T, batch arrow.Record, name string, values ...string) arrow.Record {
+	t.Helper()
+	builder := array.NewDictionaryBuilder(memory.DefaultAllocator,
+		&arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}).(*array.BinaryDictionaryBuilder)
+	defer builder.Release()
+	for _, value := range values {
+		if value == "" {
+			builder.AppendNull()
+		} else {
+			require.NoError(t, builder.AppendString(value))
+		}
+	}
+	column := builder.NewArray()
+	defer column.Release()
+
+	fields := append(batch.Schema().Fields(), arrow.Field{Name: name, Type: column.DataType(), Nullable: true})
+	columns := append(batch.Columns(), column)
+	return array.NewRecord(arrow.NewSchema(fields, nil), columns, batch.NumRows())
+}
+
+func TestSpanDecoder(t *testing.T) {
+	batch := newTestRecordBatch([]map[string]interface{}{{
+		"time":                    time.Unix(1, 0),
+		"trace_id":                "0102030405060708090a0b0c0d0e0f10",
+		"span_id":                 "0000000000000001",
+		"parent_span_id":          "0000000000000002",
+		"span.name":               "GET /",
+		"span.kind":               "Server",
+		"duration_nano":           int64(time.Second),
+		"otel.status_code":        "Error",
+		"attributes":              `{"http.status_code":500,"k8s.pod.name":"my-pod"}`,
+		"host.name":               "my-host",
+		"sampled":                 true,
+		"trace_state":             "k=v",
+		"otel.status_description": "oops",
+		"dropped_events_count":    uint64(2),
+		"dropped_links_count":     uint64(0),
+	}, {
+		"time":     time.Unix(2, 0),
+		"trace_id": "0102030405060708090a0b0c0d0e0f10",
+		"span_id":  "0000000000000002",
+	}, {
+		"time":       time.Unix(2, 0),
+		"trace_id":   "0102030405060708090a0b0c0d0e0f10",
+		"span_id":    "0000000000000003",
+		"attributes": `{"service.name":"other-service","host.name":"other-host"}`,
+	}, {
+		"time":           time.Unix(2, 0),
+		"trace_id":       "0102030405060708090a0b0c0d0e0f10",
+		"span_id":        "0000000000000004",
+		"parent_span_id": "not-a-span-id",
+		"attributes":     `{"truncated`,
+	}, {
+		"time":     time.Unix(3, 0),
+		"trace_id": "0102030405060708090a0b0c0d0e0f10",
+	}})
+	defer batch.Release()
+	batch = withDictionaryColumn(t, batch, "service.name", "my-service", "", "", "", "my-service")
+	defer batch.Release()
+
+	decoder, err := newSpanDecoder(batch, common.DefaultResourceAttributeClassifier)
+	require.NoError(t, err)
+
+	span, err := decoder.span(0)
+	require.NoError(t, err)
+	traceID := model.NewTraceID(0x0102030405060708, 0x090a0b0c0d0e0f10)
+	assert.Equal(t, traceID, span.TraceID)
+	assert.Equal(t, model.SpanID(1), span.SpanID)
+	assert.Equal(t, []model.SpanRef{model.NewChildOfRef(traceID, 2)}, span.References)
+	assert.Equal(t, "GET /", span.OperationName)
+	assert.Equal(t, time.Unix(1, 0).UnixNano(), span.StartTime.UnixNano())
+	assert.Equal(t, time.Second, span.Duration)
+	assert.Equal(t, "my-service", span.Process.ServiceName)
+	assert.ElementsMatch(t, []model.KeyValue{model.String("host.name", "my-host"), model.String("k8s.pod.name", "my-pod")}, span.Process.Tags)
+	assert.ElementsMatch(t, []model.KeyValue{
+		model.String("span.kind", "server"),
+		model.String("otel.status_code", "Error"),
+		model.String("otel.status_description", "oops"),
+		model.Bool("error", true),
+		model.Float64("http.status_code", 500),
+		model.Bool("sampled", true),
+		model.String("w3c.tracestate", "k=v"),
+	}, span.Tags)
+	assert.Equal(t, []string{"2 events dropped"}, span.Warnings)
+
+	span, err = decoder.span(1)
+	require.NoError(t, err)
+	assert.Equal(t, "<unknown>", span.Process.ServiceName, "null dictionary value")
+	assert.Empty(t, span.References)
+	assert.Empty(t, span.Tags)
+
+	span, err = decoder.span(2)
+	require.NoError(t, err)
+	assert.Equal(t, "other-service", span.Process.ServiceName, "service name in JSON-encoded attributes")
+	assert.Equal(t, []model.KeyValue{model.String("host.name", "other-host")}, span.Process.Tags)
+	assert.Empty(t, span.Tags)
+
+	span, err = decoder.span(3)
+	require.NoError(t, err, "decode failures are span warnings")
+	assert.Empty(t, span.References)
+	assert.Len(t, span.Warnings, 2)
+	assert.Contains(t, span.Warnings[0]+span.Warnings[1], "failed to decode parent span ID")
+	assert.Contains(t, span.Warnings[0]+span.Warnings[1], "failed to unmarshal JSON-encoded attributes")
+
+	_, err = decoder.span(4)
+	assert.EqualError(t, err, "incomplete span")
+
+	batch = newTestRecordBatch([]map[string]interface{}{{"time": "yesterday"}})
+	defer batch.Release()
+	_, err = newSpanDecoder(batch, common.DefaultResourceAttributeClassifier)
+	assert.EqualError(t, err, "time is type utf8")
+
+	batch = newTestRecordBatch([]map[string]interface{}{{
+		"time":          time.Unix(1, 0),
+		"trace_id":      "0102030405060708090a0b0c0d0e0f10",
+		"span_id":       "0000000000000001",
+		"duration_nano": "1s",
+		"span.kind":     int64(2),
+	}})
+	defer batch.Release()
+	decoder, err = newSpanDecoder(batch, common.DefaultResourceAttributeClassifier)
+	require.NoError(t, err, "columns of unexpected types do not fail the batch")
+	assert.ElementsMatch(t, []string{"duration nanoseconds is type utf8", "span kind is type int64"}, decoder.warnings)
+	span, err = decoder.span(0)
+	require.NoError(t, err)
+	assert.Zero(t, span.Duration)
+	assert.ElementsMatch(t, []model.KeyValue{model.String("duration_nano", "1s"), model.Int64("span.kind", 2)}, span.Tags)
+}
+
+func TestSpanDecoder_serviceName(t *testing.T) {
+	batch := newTestRecordBatch([]map[string]interface{}{{
+		"time":       time.Unix(1, 0),
+		"trace_id":   "0102030405060708090a0b0c0d0e0f10",
+		"span_id":    "0000000000000001",
+		"attributes": `{"service.name":"json-service","host.name":"my-host"}`,
+	}})
+	defer batch.Release()
+	attributesFirst := withDictionaryColumn(t, batch, "service.name", "column-service")
+	defer attributesFirst.Release()
+	n := int(attributesFirst.NumCols())
+	fields, columns := attributesFirst.Schema().Fields(), attributesFirst.Columns()
+	columnFirst := array.NewRecord(
+		arrow.NewSchema(append([]arrow.Field{fields[n-1]}, fields[:n-1]...), nil),
+		append([]arrow.Array{columns[n-1]}, columns[:n-1]...),
+		attributesFirst.NumRows())
+	defer columnFirst.Release()
+
+	for name, batch := range map[string]arrow.Record{"attributes first": attributesFirst, "column first": columnFirst} {
+		t.Run(name, func(t *testing.T) {
+			decoder, err := newSpanDecoder(batch, common.DefaultResourceAttributeClassifier)
+			require.NoError(t, err)
+			span, err := decoder.span(0)
+			require.NoError(t, err)
+			assert.Equal(t, "column-service", span.Process.ServiceName)
+			assert.Equal(t, []model.KeyValue{model.String("host.name", "my-host")}, span.Process.Tags)
+			assert.Empty(t, span.Tags)
+		})
+	}
+}
+
+func TestLogDecoder(t *testing.T) {
+	batch := newTestRecordBatch([]map[string]interface{}{{
+		"time":         time.Unix(1, 0),
+		"trace_id":     "0102030405060708090a0b0c0d0e0f10",
+		"span_id":      "0000000000000001",
+		"event.name":   "exception",
+		"service.name": "my-service",
+		"attributes":   `{"exception.message":"oops","retries":3}`,
+	}})
+	defer batch.Release()
+
+	decoder, err := newLogDecoder(batch)
+	require.NoError(t, err)
+	traceID, spanID, log, err := decoder.log(0)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewTraceID(0x0102030405060708, 0x090a0b0c0d0e0f10), traceID)
+	assert.Equal(t, model.SpanID(1), spanID)
+	assert.Equal(t, time.Unix(1, 0).UnixNano(), log.Timestamp.UnixNano())
+	assert.ElementsMatch(t, []model.KeyValue{
+		model.String("event", "exception"),
+		model.String("exception.message", "oops"),
+		model.Int64("retries", 3),
+	}, log.Fields)
+}
+
+func TestSpanRefDecoder(t *testing.T) {
+	batch := newTestRecordBatch([]map[string]interface{}{{
+		"time":            time.Unix(1, 0),
+		"trace_id":        "0102030405060708090a0b0c0d0e0f10",
+		"span_id":         "0000000000000001",
+		"linked_trace_id": "0000000000000000000000000000000b",
+		"linked_span_id":  "000000000000000c",
+	}, {
+		"trace_id": "0102030405060708090a0b0c0d0e0f10",
+		"span_id":  "0000000000000001",
+	}})
+	defer batch.Release()
+
+	decoder, err := newSpanRefDecoder(batch)
+	require.NoError(t, err)
+	traceID, spanID, spanRef, err := decoder.spanRef(0)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewTraceID(0x0102030405060708, 0x090a0b0c0d0e0f10), traceID)
+	assert.Equal(t, model.SpanID(1), spanID)
+	assert.Equal(t, &model.SpanRef{TraceID: model.NewTraceID(0, 0x0b), SpanID: 0x0c, RefType: model.FollowsFrom}, spanRef)
+
+	_, _, _, err = decoder.spanRef(1)
+	assert.EqualError(t, err, "incomplete span link")
+}
+
+func TestRecordBatchToMaps(t *testing.T) {
+	batch := newTestRecordBatch([]map[string]interface{}{
+		{"time": time.Unix(1, 0), "count": int64(1), "value": 0.5},
+		{"time": time.Unix(2, 0), "count": int64(2)},
+	})
+	defer batch.Release()
+	batch = withDictionaryColumn(t, batch, "service.name", "", "my-service")
+	defer batch.Release()
+
+	var records []map[string]interface{}
+	require.NoError(t, recordBatchToMaps(batch, func(record map[string]interface{}) error {
+		records = append(records, map[string]interface{}{})
+		for k, v := range record {
+			records[len(records)-1][k] = v
+		}
+		return nil
+	}))
+	assert.Equal(t, []map[string]interface{}{
+		{"time": time.Unix(1, 0).UTC(), "count": int64(1), "value": 0.5},
+		{"time": time.Unix(2, 0).UTC(), "count": int64(2), "service.name": "my-service"},
+	}, records)
+}
@@ -9,11 +9,14 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap/zapcore"
+
+	"github.com/influxdata/influxdb-observability/common"
 )
 
 type Config struct {
 	LogLevel              string
 	ListenAddr            string
+	PrometheusListenAddr  string
 	InfluxdbAddr          string
 	InfluxdbTLSDisable    bool
 	InfluxdbTimeout       time.Duration
@@ -21,6 +24,23 @@ type Config struct {
 	InfluxdbBucketArchive string
 	InfluxdbToken         string
 	InfluxdbQueryMetadata map[string]string
+
+	InfluxdbWriteBatchSize     int
+	InfluxdbWriteFlushInterval time.Duration
+
+	QueryMaxTraces        int
+	QueryMaxSpansPerTrace int
+	QueryTraceLookback    time.Duration
+	QueryTraceMaxLookback time.Duration
+	QueryParallelism      int
+
+	MetadataSource        string
+	MetadataSpansLookback time.Duration
+	MetadataCacheTTL      time.Duration
+
+	ResourceSemconvVersion   string
+	ResourceAttributeInclude []string
+	ResourceAttributeExclude []string
 }
 
 func (c *Config) Init(command *cobra.Command) error {
@@ -44,6 +64,11 @@ func (c *Config) Init(command *cobra.Command) error {
 			defaultValue: fmt.Sprintf(":%d", ports.RemoteStorageGRPC),
 			usage:        "Jaeger gRPC storage service (this process) host:port address",
 		},
+		{
+			pointer: &c.PrometheusListenAddr,
+			name:    "prometheus-listen-addr",
+			usage:   "Prometheus-compatible query API for the Jaeger Monitor tab (this process) host:port address (empty to disable)",
+		},
 		{
 			pointer: &c.InfluxdbAddr,
 			name:    "influxdb-addr",
@@ -58,12 +83,12 @@ func (c *Config) Init(command *cobra.Command) error {
 			pointer:      &c.InfluxdbTimeout,
 			name:         "influxdb-timeout",
 			defaultValue: 15 * time.Second,
-			usage:        "InfluxDB query timeout",
+			usage:        "InfluxDB query timeout; bounds each trace lookup or search as a whole",
 		},
 		{
 			pointer: &c.InfluxdbBucket,
 			name:    "influxdb-bucket",
-			usage:   "InfluxDB bucket name, containing traces, logs, metrics (query only)",
+			usage:   "InfluxDB bucket name, containing traces, logs, metrics (write permission required to store spans)",
 		},
 		{
 			pointer: &c.InfluxdbBucketArchive,
@@ -80,6 +105,82 @@ func (c *Config) Init(command *cobra.Command) error {
 			name:    "influxdb-query-metadata",
 			usage:   `gRPC metadata sent with SQL queries ("foo=bar") (optional; specify zero to many times)`,
 		},
+		{
+			pointer:      &c.InfluxdbWriteBatchSize,
+			name:         "influxdb-write-batch-size",
+			defaultValue: 5000,
+			usage:        "maximum number of lines written to InfluxDB per request, when storing spans",
+		},
+		{
+			pointer:      &c.InfluxdbWriteFlushInterval,
+			name:         "influxdb-write-flush-interval",
+			defaultValue: time.Second,
+			usage:        "maximum time that spans are buffered before they are written to InfluxDB",
+		},
+		{
+			pointer:      &c.QueryMaxTraces,
+			name:         "query-max-traces",
+			defaultValue: 1000,
+			usage:        "maximum number of traces returned by a trace search",
+		},
+		{
+			pointer:      &c.QueryMaxSpansPerTrace,
+			name:         "query-max-spans-per-trace",
+			defaultValue: 10000,
+			usage:        "maximum number of spans returned per trace; additional spans are dropped",
+		},
+		{
+			pointer:      &c.QueryTraceLookback,
+			name:         "query-trace-lookback",
+			defaultValue: 24 * time.Hour,
+			usage:        "time range of a trace lookup by ID; widened if the trace is not found (zero is unbounded)",
+		},
+		{
+			pointer: &c.QueryTraceMaxLookback,
+			name:    "query-trace-max-lookback",
+			usage:   "maximum time range of a trace lookup by ID (zero is unbounded)",
+		},
+		{
+			pointer:      &c.QueryParallelism,
+			name:         "query-parallelism",
+			defaultValue: 2,
+			usage:        "maximum number of concurrent InfluxDB queries per trace lookup or search",
+		},
+		{
+			pointer:      &c.MetadataSource,
+			name:         "metadata-source",
+			defaultValue: metadataSourceAuto,
+			usage: fmt.Sprintf("source of services, operations and dependencies; one of %s (spanmetrics and servicegraph connector tables), %s (spans table), %s (connector tables, else spans table)",
+				metadataSourceConnectors, metadataSourceSpans, metadataSourceAuto),
+		},
+		{
+			pointer:      &c.MetadataSpansLookback,
+			name:         "metadata-spans-lookback",
+			defaultValue: 24 * time.Hour,
+			usage:        "maximum time range of spans queried for services, operations and dependencies",
+		},
+		{
+			pointer:      &c.MetadataCacheTTL,
+			name:         "metadata-cache-ttl",
+			defaultValue: time.Minute,
+			usage:        "how long services, operations and dependencies are cached (zero disables caching)",
+		},
+		{
+			pointer:      &c.ResourceSemconvVersion,
+			name:         "resource-semconv-version",
+			defaultValue: common.DefaultSemconvVersion,
+			usage:        "OpenTelemetry semantic conventions version used to identify resource (process) attributes; one of " + strings.Join(common.SemconvVersions(), ", "),
+		},
+		{
+			pointer: &c.ResourceAttributeInclude,
+			name:    "resource-attribute-include",
+			usage:   "regular expression matching additional resource (process) attribute keys (optional; specify zero to many times)",
+		},
+		{
+			pointer: &c.ResourceAttributeExclude,
+			name:    "resource-attribute-exclude",
+			usage:   "regular expression matching keys that are never resource (process) attributes (optional; specify zero to many times)",
+		},
 	} {
 		switch v := f.pointer.(type) {
 		case *string:
@@ -92,6 +193,16 @@ func (c *Config) Init(command *cobra.Command) error {
 				return err
 			}
 			*v = viper.GetString(f.name)
+		case *int:
+			var defaultValue int
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(int)
+			}
+			command.Flags().IntVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetInt(f.name)
 		case *time.Duration:
 			var defaultValue time.Duration
 			if f.defaultValue != nil {
@@ -122,6 +233,16 @@ func (c *Config) Init(command *cobra.Command) error {
 				return err
 			}
 			*v = viper.GetStringMapString(f.name)
+		case *[]string:
+			var defaultValue []string
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.([]string)
+			}
+			command.Flags().StringSliceVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetStringSlice(f.name)
 		default:
 			return fmt.Errorf("flag type %T not implemented", f.pointer)
 		}
@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+type Config struct {
+	LogLevel         string
+	GRPCListenAddr   string
+	HTTPListenAddr   string
+	HealthListenAddr string
+
+	InfluxdbAddr       string
+	InfluxdbTLSDisable bool
+	InfluxdbTimeout    time.Duration
+	InfluxdbBucket     string
+	InfluxdbToken      string
+
+	MetricsSchema       string
+	SpanDimensions      []string
+	LogRecordDimensions []string
+
+	MaxBodySize     int
+	QueueSize       int
+	QueueWorkers    int
+	ShutdownTimeout time.Duration
+}
+
+func (c *Config) Init(command *cobra.Command) error {
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	for _, f := range []struct {
+		pointer      interface{}
+		name         string
+		defaultValue interface{}
+		usage        string
+	}{
+		{
+			pointer:      &c.LogLevel,
+			name:         "log-level",
+			defaultValue: zapcore.InfoLevel.String(),
+			usage:        "log level (zap)",
+		},
+		{
+			pointer:      &c.GRPCListenAddr,
+			name:         "grpc-listen-addr",
+			defaultValue: ":4317",
+			usage:        "OTLP/gRPC receiver (this process) host:port address (empty to disable)",
+		},
+		{
+			pointer:      &c.HTTPListenAddr,
+			name:         "http-listen-addr",
+			defaultValue: ":4318",
+			usage:        "OTLP/HTTP receiver (this process) host:port address (empty to disable)",
+		},
+		{
+			pointer:      &c.HealthListenAddr,
+			name:         "health-listen-addr",
+			defaultValue: ":13133",
+			usage:        "health check endpoint (this process) host:port address (empty to disable)",
+		},
+		{
+			pointer: &c.InfluxdbAddr,
+			name:    "influxdb-addr",
+			usage:   "InfluxDB service host:port",
+		},
+		{
+			pointer: &c.InfluxdbTLSDisable,
+			name:    "influxdb-tls-disable",
+			usage:   "Do not use TLS to connect to InfluxDB (mostly for development)",
+		},
+		{
+			pointer:      &c.InfluxdbTimeout,
+			name:         "influxdb-timeout",
+			defaultValue: 15 * time.Second,
+			usage:        "InfluxDB write timeout",
+		},
+		{
+			pointer: &c.InfluxdbBucket,
+			name:    "influxdb-bucket",
+			usage:   "InfluxDB bucket name, to write traces, logs, metrics",
+		},
+		{
+			pointer: &c.InfluxdbToken,
+			name:    "influxdb-token",
+			usage:   "InfluxDB API access token",
+		},
+		{
+			pointer:      &c.MetricsSchema,
+			name:         "metrics-schema",
+			defaultValue: common.MetricsSchemaTelegrafPrometheusV1.String(),
+			usage:        "metrics schema; one of " + strings.Join(metricsSchemaNames(), ", "),
+		},
+		{
+			pointer:      &c.SpanDimensions,
+			name:         "span-dimensions",
+			defaultValue: []string{semconv.AttributeServiceName, common.AttributeSpanName},
+			usage:        "span attributes written as tags (specify zero to many times)",
+		},
+		{
+			pointer:      &c.LogRecordDimensions,
+			name:         "log-record-dimensions",
+			defaultValue: []string{semconv.AttributeServiceName},
+			usage:        "log record attributes written as tags (specify zero to many times)",
+		},
+		{
+			pointer:      &c.MaxBodySize,
+			name:         "max-body-size",
+			defaultValue: 32 << 20,
+			usage:        "maximum size in bytes of a decompressed OTLP/HTTP request body",
+		},
+		{
+			pointer:      &c.QueueSize,
+			name:         "queue-size",
+			defaultValue: 1000,
+			usage:        "maximum number of batches waiting to be written to InfluxDB; requests wait for their batch to be written, and are rejected as retryable when the queue is full",
+		},
+		{
+			pointer:      &c.QueueWorkers,
+			name:         "queue-workers",
+			defaultValue: 4,
+			usage:        "number of concurrent writes to InfluxDB",
+		},
+		{
+			pointer:      &c.ShutdownTimeout,
+			name:         "shutdown-timeout",
+			defaultValue: 10 * time.Second,
+			usage:        "time allowed for in-flight requests and queued batches to complete at exit",
+		},
+	} {
+		switch v := f.pointer.(type) {
+		case *string:
+			var defaultValue string
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(string)
+			}
+			command.Flags().StringVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetString(f.name)
+		case *int:
+			var defaultValue int
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(int)
+			}
+			command.Flags().IntVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetInt(f.name)
+		case *time.Duration:
+			var defaultValue time.Duration
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(time.Duration)
+			}
+			command.Flags().DurationVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetDuration(f.name)
+		case *bool:
+			var defaultValue bool
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(bool)
+			}
+			command.Flags().BoolVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetBool(f.name)
+		case *[]string:
+			var defaultValue []string
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.([]string)
+			}
+			command.Flags().StringSliceVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetStringSlice(f.name)
+		default:
+			return fmt.Errorf("flag type %T not implemented", f.pointer)
+		}
+	}
+	return nil
+}
+
+func metricsSchemaNames() []string {
+	return []string{
+		common.MetricsSchemaTelegrafPrometheusV1.String(),
+		common.MetricsSchemaTelegrafPrometheusV2.String(),
+		common.MetricsSchemaOtelV1.String(),
+	}
+}
@@ -0,0 +1,379 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal"
+	"github.com/influxdata/influxdb-observability/otel2influx"
+)
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+
+	pathTraces  = "/v1/traces"
+	pathMetrics = "/v1/metrics"
+	pathLogs    = "/v1/logs"
+	pathHealth  = "/health"
+)
+
+// Gateway receives OTLP traces, metrics and logs over gRPC and HTTP,
+// converts them with otel2influx, and writes them to InfluxDB.
+type Gateway struct {
+	logger *zap.Logger
+	writer *influxdbWriter
+
+	traces  *otel2influx.OtelTracesToLineProtocol
+	metrics *otel2influx.OtelMetricsToLineProtocol
+	logs    *otel2influx.OtelLogsToLineProtocol
+
+	grpcServer   *grpc.Server
+	httpServer   *http.Server
+	healthServer *http.Server
+	ready        atomic.Bool
+
+	maxBodySize int64
+}
+
+func NewGateway(ctx context.Context, config *Config) (*Gateway, error) {
+	logger := internal.LoggerFromContext(ctx)
+
+	metricsSchema, found := common.MetricsSchemata[config.MetricsSchema]
+	if !found {
+		return nil, fmt.Errorf("metrics-schema value is invalid '%s'", config.MetricsSchema)
+	}
+	if config.MaxBodySize < 1 {
+		return nil, fmt.Errorf("max-body-size must be positive, got %d", config.MaxBodySize)
+	}
+
+	writer, err := newInfluxdbWriter(logger.With(zap.String("influxdb", "writer")), config)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gateway{
+		logger:      logger,
+		writer:      writer,
+		maxBodySize: int64(config.MaxBodySize),
+	}
+	err = g.initConverters(config, metricsSchema)
+	if err != nil {
+		return nil, multierr.Combine(err, writer.Close(ctx))
+	}
+
+	if config.GRPCListenAddr != "" {
+		g.grpcServer = grpc.NewServer()
+		ptraceotlp.RegisterGRPCServer(g.grpcServer, &tracesServer{g: g})
+		pmetricotlp.RegisterGRPCServer(g.grpcServer, &metricsServer{g: g})
+		plogotlp.RegisterGRPCServer(g.grpcServer, &logsServer{g: g})
+	}
+	if config.HTTPListenAddr != "" {
+		g.httpServer = &http.Server{Handler: g.httpHandler()}
+	}
+	if config.HealthListenAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc(pathHealth, g.handleHealth)
+		g.healthServer = &http.Server{Handler: mux}
+	}
+	return g, nil
+}
+
+func (g *Gateway) initConverters(config *Config, metricsSchema common.MetricsSchema) error {
+	converterLogger := internal.CommonLogger(g.logger)
+	var err error
+
+	tracesConfig := otel2influx.DefaultOtelTracesToLineProtocolConfig()
+	tracesConfig.Logger = converterLogger
+	tracesConfig.Writer = g.writer
+	tracesConfig.SpanDimensions = config.SpanDimensions
+	if g.traces, err = otel2influx.NewOtelTracesToLineProtocol(tracesConfig); err != nil {
+		return err
+	}
+
+	metricsConfig := otel2influx.DefaultOtelMetricsToLineProtocolConfig()
+	metricsConfig.Logger = converterLogger
+	metricsConfig.Writer = g.writer
+	metricsConfig.Schema = metricsSchema
+	if g.metrics, err = otel2influx.NewOtelMetricsToLineProtocol(metricsConfig); err != nil {
+		return err
+	}
+
+	logsConfig := otel2influx.DefaultOtelLogsToLineProtocolConfig()
+	logsConfig.Logger = converterLogger
+	logsConfig.Writer = g.writer
+	logsConfig.LogRecordDimensions = config.LogRecordDimensions
+	if g.logs, err = otel2influx.NewOtelLogsToLineProtocol(logsConfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Serve serves on the configured listeners until Shutdown is called or a server fails.
+// When one server fails, the others are stopped, so that Serve returns.
+func (g *Gateway) Serve(grpcListener, httpListener, healthListener net.Listener) error {
+	errCh := make(chan error, 3)
+	var serving int
+	if g.grpcServer != nil && grpcListener != nil {
+		serving++
+		go func() { errCh <- g.grpcServer.Serve(grpcListener) }()
+	}
+	if g.httpServer != nil && httpListener != nil {
+		serving++
+		go func() { errCh <- g.httpServer.Serve(httpListener) }()
+	}
+	if g.healthServer != nil && healthListener != nil {
+		serving++
+		go func() { errCh <- g.healthServer.Serve(healthListener) }()
+	}
+	if serving == 0 {
+		return errors.New("no listener configured")
+	}
+
+	g.ready.Store(true)
+	var err error
+	for ; serving > 0; serving-- {
+		serveErr := <-errCh
+		if serveErr == nil || errors.Is(serveErr, http.ErrServerClosed) || errors.Is(serveErr, grpc.ErrServerStopped) {
+			continue
+		}
+		if err == nil {
+			g.stop()
+		}
+		err = multierr.Combine(err, serveErr)
+	}
+	return err
+}
+
+// stop closes all servers immediately, without waiting for in-flight requests.
+func (g *Gateway) stop() {
+	g.ready.Store(false)
+	if g.grpcServer != nil {
+		g.grpcServer.Stop()
+	}
+	if g.httpServer != nil {
+		_ = g.httpServer.Close()
+	}
+	if g.healthServer != nil {
+		_ = g.healthServer.Close()
+	}
+}
+
+// Shutdown stops receiving, waits for in-flight requests,
+// then waits for queued batches to be written to InfluxDB, all within ctx.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.ready.Store(false)
+	var err error
+	if g.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			g.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			g.logger.Warn("the gRPC server is being stubborn, so forcing it to stop")
+			g.grpcServer.Stop()
+		}
+	}
+	if g.httpServer != nil {
+		err = multierr.Combine(err, g.httpServer.Shutdown(ctx))
+	}
+	err = multierr.Combine(err, g.writer.Close(ctx))
+	if g.healthServer != nil {
+		err = multierr.Combine(err, g.healthServer.Shutdown(ctx))
+	}
+	return err
+}
+
+func (g *Gateway) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	if g.ready.Load() {
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"status":"ok"}`)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `{"status":"unavailable"}`)
+	}
+}
+
+// exportStatus classifies an export error per the OTLP specification:
+// a full write queue or an unavailable InfluxDB is retryable,
+// and a conversion error or a batch rejected by InfluxDB is not.
+func exportStatus(err error) (codes.Code, int) {
+	switch {
+	case errors.Is(err, errQueueFull), errors.Is(err, errQueueClosed), errors.Is(err, errInfluxdbUnavailable),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return codes.Unavailable, http.StatusServiceUnavailable
+	case consumererror.IsPermanent(err):
+		return codes.InvalidArgument, http.StatusBadRequest
+	default:
+		return codes.Internal, http.StatusInternalServerError
+	}
+}
+
+func (g *Gateway) exportError(err error) error {
+	code, _ := exportStatus(err)
+	if code != codes.Unavailable {
+		g.logger.Debug("export failed", zap.Error(err))
+	}
+	return status.Error(code, err.Error())
+}
+
+type tracesServer struct {
+	ptraceotlp.UnimplementedGRPCServer
+	g *Gateway
+}
+
+func (s *tracesServer) Export(ctx context.Context, request ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	if err := s.g.traces.WriteTraces(ctx, request.Traces()); err != nil {
+		return ptraceotlp.NewExportResponse(), s.g.exportError(err)
+	}
+	return ptraceotlp.NewExportResponse(), nil
+}
+
+type metricsServer struct {
+	pmetricotlp.UnimplementedGRPCServer
+	g *Gateway
+}
+
+func (s *metricsServer) Export(ctx context.Context, request pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	if err := s.g.metrics.WriteMetrics(ctx, request.Metrics()); err != nil {
+		return pmetricotlp.NewExportResponse(), s.g.exportError(err)
+	}
+	return pmetricotlp.NewExportResponse(), nil
+}
+
+type logsServer struct {
+	plogotlp.UnimplementedGRPCServer
+	g *Gateway
+}
+
+func (s *logsServer) Export(ctx context.Context, request plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if err := s.g.logs.WriteLogs(ctx, request.Logs()); err != nil {
+		return plogotlp.NewExportResponse(), s.g.exportError(err)
+	}
+	return plogotlp.NewExportResponse(), nil
+}
+
+type otlpRequest interface {
+	UnmarshalProto(data []byte) error
+	UnmarshalJSON(data []byte) error
+}
+
+type otlpResponse interface {
+	MarshalProto() ([]byte, error)
+	MarshalJSON() ([]byte, error)
+}
+
+func (g *Gateway) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(pathTraces, g.otlpHTTPHandler(func() (otlpRequest, func(context.Context) error) {
+		request := ptraceotlp.NewExportRequest()
+		return request, func(ctx context.Context) error { return g.traces.WriteTraces(ctx, request.Traces()) }
+	}, ptraceotlp.NewExportResponse()))
+	mux.Handle(pathMetrics, g.otlpHTTPHandler(func() (otlpRequest, func(context.Context) error) {
+		request := pmetricotlp.NewExportRequest()
+		return request, func(ctx context.Context) error { return g.metrics.WriteMetrics(ctx, request.Metrics()) }
+	}, pmetricotlp.NewExportResponse()))
+	mux.Handle(pathLogs, g.otlpHTTPHandler(func() (otlpRequest, func(context.Context) error) {
+		request := plogotlp.NewExportRequest()
+		return request, func(ctx context.Context) error { return g.logs.WriteLogs(ctx, request.Logs()) }
+	}, plogotlp.NewExportResponse()))
+	return mux
+}
+
+// otlpHTTPHandler serves one OTLP/HTTP signal path, with protobuf or JSON encoding.
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+func (g *Gateway) otlpHTTPHandler(newRequest func() (otlpRequest, func(context.Context) error), response otlpResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != contentTypeProtobuf && contentType != contentTypeJSON {
+			http.Error(w, fmt.Sprintf("unsupported content type '%s'", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "":
+		case "gzip":
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer func() { _ = gzipReader.Close() }()
+			body = gzipReader
+		default:
+			http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		buf, err := io.ReadAll(io.LimitReader(body, g.maxBodySize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(buf)) > g.maxBodySize {
+			http.Error(w, fmt.Sprintf("request body exceeds %d bytes", g.maxBodySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		request, export := newRequest()
+		if contentType == contentTypeJSON {
+			err = request.UnmarshalJSON(buf)
+		} else {
+			err = request.UnmarshalProto(buf)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err = export(r.Context()); err != nil {
+			_, httpStatus := exportStatus(err)
+			if httpStatus == http.StatusServiceUnavailable {
+				w.Header().Set("Retry-After", "1")
+			} else {
+				g.logger.Debug("export failed", zap.Error(err))
+			}
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+
+		var res []byte
+		if contentType == contentTypeJSON {
+			res, err = response.MarshalJSON()
+		} else {
+			res, err = response.MarshalProto()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(res)
+	})
+}
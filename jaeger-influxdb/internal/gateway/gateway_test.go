@@ -0,0 +1,289 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal"
+)
+
+func TestComposeWriteURL(t *testing.T) {
+	for _, testCase := range []struct {
+		influxdbAddr  string
+		disableTLS    bool
+		expectedValue string
+		expectError   bool
+	}{
+		{"host.tld:8086", false, "https://host.tld:8086/api/v2/write?bucket=b&precision=ns", false},
+		{"host.tld:8086", true, "http://host.tld:8086/api/v2/write?bucket=b&precision=ns", false},
+		{"host", false, "https://host/api/v2/write?bucket=b&precision=ns", false},
+		{"http://host:8086", false, "http://host:8086/api/v2/write?bucket=b&precision=ns", false},
+		{"https://host", true, "https://host/api/v2/write?bucket=b&precision=ns", false},
+
+		{"", false, "", true},
+		{"grpc://host:8086", false, "", true},
+		{"http://", false, "", true},
+	} {
+		t.Run(testCase.influxdbAddr, func(t *testing.T) {
+			actualValue, err := composeWriteURL(testCase.influxdbAddr, testCase.disableTLS, "b")
+			if testCase.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedValue, actualValue)
+			}
+		})
+	}
+}
+
+func newTestGateway(t *testing.T, influxdbURL string, queueSize int) *Gateway {
+	t.Helper()
+	config := &Config{
+		InfluxdbAddr:        influxdbURL,
+		InfluxdbTimeout:     time.Second,
+		InfluxdbBucket:      "otel",
+		InfluxdbToken:       "my-token",
+		MetricsSchema:       "telegraf-prometheus-v1",
+		SpanDimensions:      []string{"service.name", "span.name"},
+		LogRecordDimensions: []string{"service.name"},
+		HTTPListenAddr:      "localhost:0",
+		HealthListenAddr:    "localhost:0",
+		MaxBodySize:         1 << 10,
+		QueueSize:           queueSize,
+		QueueWorkers:        1,
+	}
+	ctx := internal.LoggerWithContext(context.Background(), zap.NewNop())
+	g, err := NewGateway(ctx, config)
+	require.NoError(t, err)
+	return g
+}
+
+func newTestTracesRequest(t *testing.T) ptraceotlp.ExportRequest {
+	t.Helper()
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "my-service")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	span.SetSpanID([8]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	span.SetName("my-span")
+	span.SetStartTimestamp(pcommon.Timestamp(1_000_000_000))
+	span.SetEndTimestamp(pcommon.Timestamp(2_000_000_000))
+	return ptraceotlp.NewExportRequestFromTraces(traces)
+}
+
+func TestGateway_HTTPTraces(t *testing.T) {
+	written := make(chan *http.Request, 1)
+	writtenBody := make(chan string, 1)
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		written <- r
+		writtenBody <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxdb.Close()
+
+	g := newTestGateway(t, influxdb.URL, 10)
+	server := httptest.NewServer(g.httpHandler())
+	defer server.Close()
+
+	for _, contentType := range []string{contentTypeProtobuf, contentTypeJSON} {
+		t.Run(contentType, func(t *testing.T) {
+			request := newTestTracesRequest(t)
+			var body []byte
+			var err error
+			if contentType == contentTypeJSON {
+				body, err = request.MarshalJSON()
+			} else {
+				body, err = request.MarshalProto()
+			}
+			require.NoError(t, err)
+
+			res, err := http.Post(server.URL+pathTraces, contentType, bytes.NewReader(body))
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, contentType, res.Header.Get("Content-Type"))
+
+			select {
+			case r := <-written:
+				assert.Equal(t, "/api/v2/write", r.URL.Path)
+				assert.Equal(t, "otel", r.URL.Query().Get("bucket"))
+				assert.Equal(t, "Token my-token", r.Header.Get("Authorization"))
+				lines := <-writtenBody
+				assert.True(t, strings.HasPrefix(lines, "spans,service.name=my-service,span_id=0102030405060708,trace_id=0102030405060708090a0b0c0d0e0f10 "), lines)
+				assert.Contains(t, lines, `span.name="my-span"`)
+				assert.True(t, strings.HasSuffix(lines, " 1000000000\n"), lines)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for InfluxDB write")
+			}
+		})
+	}
+
+	assert.NoError(t, g.Shutdown(context.Background()))
+}
+
+func TestGateway_HTTPErrors(t *testing.T) {
+	g := newTestGateway(t, "localhost:8086", 1)
+	defer func() { _ = g.Shutdown(context.Background()) }()
+	server := httptest.NewServer(g.httpHandler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + pathTraces)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	res, err = http.Post(server.URL+pathTraces, "text/plain", strings.NewReader("foo"))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	res, err = http.Post(server.URL+pathTraces, contentTypeJSON, strings.NewReader("{"))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Post(server.URL+pathTraces, contentTypeJSON, strings.NewReader(strings.Repeat(" ", 1<<10+1)))
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestGateway_WriteFailure(t *testing.T) {
+	for _, testCase := range []struct {
+		influxdbStatus   int
+		expectedStatus   int
+		expectedAttempts int
+	}{
+		{http.StatusBadRequest, http.StatusBadRequest, 1},
+		{http.StatusServiceUnavailable, http.StatusServiceUnavailable, writeMaxAttempts},
+	} {
+		t.Run(http.StatusText(testCase.influxdbStatus), func(t *testing.T) {
+			var attempts atomic.Int32
+			influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+				w.WriteHeader(testCase.influxdbStatus)
+			}))
+			defer influxdb.Close()
+
+			g := newTestGateway(t, influxdb.URL, 1)
+			server := httptest.NewServer(g.httpHandler())
+			defer server.Close()
+			body, err := newTestTracesRequest(t).MarshalProto()
+			require.NoError(t, err)
+
+			res, err := http.Post(server.URL+pathTraces, contentTypeProtobuf, bytes.NewReader(body))
+			require.NoError(t, err)
+			_ = res.Body.Close()
+			assert.Equal(t, testCase.expectedStatus, res.StatusCode)
+			assert.EqualValues(t, testCase.expectedAttempts, attempts.Load())
+			assert.NoError(t, g.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestGateway_QueueFull(t *testing.T) {
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxdb.Close()
+
+	g := newTestGateway(t, influxdb.URL, 1)
+	server := httptest.NewServer(g.httpHandler())
+	defer server.Close()
+	body, err := newTestTracesRequest(t).MarshalProto()
+	require.NoError(t, err)
+	post := func() *http.Response {
+		res, err := http.Post(server.URL+pathTraces, contentTypeProtobuf, bytes.NewReader(body))
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		return res
+	}
+
+	// The only worker is blocked on the first batch, and the second batch fills the queue.
+	accepted := make(chan int, 2)
+	go func() { accepted <- post().StatusCode }()
+	<-received
+	go func() { accepted <- post().StatusCode }()
+	require.Eventually(t, func() bool { return len(g.writer.queue) == 1 }, 5*time.Second, 10*time.Millisecond)
+	res := post()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+
+	code, _ := exportStatus(errQueueFull)
+	assert.Equal(t, codes.Unavailable, code)
+
+	// Requests are answered after their batches are written.
+	close(release)
+	assert.Equal(t, http.StatusOK, <-accepted)
+	assert.Equal(t, http.StatusOK, <-accepted)
+	assert.NoError(t, g.Shutdown(context.Background()))
+	assert.Len(t, received, 1)
+	assert.ErrorIs(t, g.writer.write(context.Background(), []byte("m f=1\n")), errQueueClosed)
+}
+
+func TestGateway_Health(t *testing.T) {
+	g := newTestGateway(t, "localhost:8086", 1)
+	healthListener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	httpListener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	getHealth := func() int {
+		res, err := http.Get("http://" + healthListener.Addr().String() + pathHealth)
+		if err != nil {
+			return 0
+		}
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- g.Serve(nil, httpListener, healthListener) }()
+	assert.Eventually(t, func() bool { return getHealth() == http.StatusOK }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, g.Shutdown(context.Background()))
+	assert.NoError(t, <-served)
+	assert.Zero(t, getHealth())
+}
+
+func TestGateway_ServeFailure(t *testing.T) {
+	g := newTestGateway(t, "localhost:8086", 1)
+	healthListener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	httpListener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	require.NoError(t, httpListener.Close())
+
+	served := make(chan error, 1)
+	go func() { served <- g.Serve(nil, httpListener, healthListener) }()
+	select {
+	case err = <-served:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after a server failed")
+	}
+	assert.NoError(t, g.Shutdown(context.Background()))
+}
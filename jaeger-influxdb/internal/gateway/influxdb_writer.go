@@ -0,0 +1,287 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/otel2influx"
+)
+
+var _ otel2influx.InfluxWriter = (*influxdbWriter)(nil)
+var _ otel2influx.InfluxWriterBatch = (*influxdbWriterBatch)(nil)
+
+var (
+	errQueueFull           = errors.New("write queue is full")
+	errQueueClosed         = errors.New("write queue is closed")
+	errInfluxdbUnavailable = errors.New("InfluxDB is unavailable")
+)
+
+const (
+	writeMaxAttempts  = 3
+	writeRetryBackoff = time.Second
+)
+
+// influxdbWriter writes line protocol to the InfluxDB v2 write API.
+// Batches are queued in a bounded queue, and written by a fixed number of workers,
+// so that a slow InfluxDB pushes back on OTLP clients instead of growing memory without bound.
+// Each request waits for its batch to be written, so that a failed write is reported to the client,
+// which retries or drops it per the OTLP specification.
+type influxdbWriter struct {
+	logger     *zap.Logger
+	httpClient *http.Client
+	writeURL   string
+	authToken  string
+
+	queue    chan *writeJob
+	queueMu  sync.RWMutex
+	closed   bool
+	workerWG sync.WaitGroup
+}
+
+func newInfluxdbWriter(logger *zap.Logger, config *Config) (*influxdbWriter, error) {
+	if config.InfluxdbBucket == "" {
+		return nil, fmt.Errorf("influxdb-bucket not specified, either by flag or env var")
+	}
+	if config.QueueSize < 1 {
+		return nil, fmt.Errorf("queue-size must be positive, got %d", config.QueueSize)
+	}
+	if config.QueueWorkers < 1 {
+		return nil, fmt.Errorf("queue-workers must be positive, got %d", config.QueueWorkers)
+	}
+	writeURL, err := composeWriteURL(config.InfluxdbAddr, config.InfluxdbTLSDisable, config.InfluxdbBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &influxdbWriter{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: config.InfluxdbTimeout},
+		writeURL:   writeURL,
+		authToken:  config.InfluxdbToken,
+		queue:      make(chan *writeJob, config.QueueSize),
+	}
+	for i := 0; i < config.QueueWorkers; i++ {
+		w.workerWG.Add(1)
+		go w.work()
+	}
+	return w, nil
+}
+
+// composeWriteURL accepts influxdb-addr as host, host:port, or a URL with http or https scheme.
+func composeWriteURL(influxdbAddr string, tlsDisable bool, bucket string) (string, error) {
+	if influxdbAddr == "" {
+		return "", fmt.Errorf("influxdb-addr not specified, either by flag or env var")
+	}
+	scheme := "https"
+	if tlsDisable {
+		scheme = "http"
+	}
+	host := influxdbAddr
+	if strings.Contains(influxdbAddr, "://") {
+		u, err := url.Parse(influxdbAddr)
+		if err != nil {
+			return "", fmt.Errorf("influxdb-addr value is invalid '%s': %w", influxdbAddr, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("influxdb-addr value is invalid '%s': URL scheme '%s' is not recognized", influxdbAddr, u.Scheme)
+		}
+		scheme, host = u.Scheme, u.Host
+	}
+	if host == "" {
+		return "", fmt.Errorf("influxdb-addr value is invalid '%s': host is missing", influxdbAddr)
+	}
+
+	writeURL := &url.URL{Scheme: scheme, Host: host, Path: "/api/v2/write"}
+	queryValues := writeURL.Query()
+	queryValues.Set("precision", "ns")
+	queryValues.Set("bucket", bucket)
+	writeURL.RawQuery = queryValues.Encode()
+	return writeURL.String(), nil
+}
+
+func (w *influxdbWriter) NewBatch() otel2influx.InfluxWriterBatch {
+	encoder := new(lineprotocol.Encoder)
+	encoder.SetLax(true)
+	encoder.SetPrecision(lineprotocol.Nanosecond)
+	return &influxdbWriterBatch{
+		w:       w,
+		encoder: encoder,
+	}
+}
+
+type writeJob struct {
+	ctx  context.Context
+	body []byte
+	done chan error
+}
+
+// write queues line protocol, then waits until it is written to InfluxDB, or until ctx is done.
+func (w *influxdbWriter) write(ctx context.Context, body []byte) error {
+	job := &writeJob{ctx: ctx, body: body, done: make(chan error, 1)}
+	if err := w.enqueue(job); err != nil {
+		return err
+	}
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("batch not written to InfluxDB: %w", ctx.Err())
+	}
+}
+
+// enqueue adds a write job to the write queue, without blocking.
+func (w *influxdbWriter) enqueue(job *writeJob) error {
+	w.queueMu.RLock()
+	defer w.queueMu.RUnlock()
+	if w.closed {
+		return errQueueClosed
+	}
+	select {
+	case w.queue <- job:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (w *influxdbWriter) work() {
+	defer w.workerWG.Done()
+	for job := range w.queue {
+		if err := job.ctx.Err(); err != nil {
+			// the request is gone, so nobody is waiting for this batch
+			job.done <- err
+			continue
+		}
+		err := w.writeWithRetry(job.ctx, job.body)
+		if err != nil {
+			w.logger.Warn("failed to write batch to InfluxDB", zap.Error(err))
+		}
+		job.done <- err
+	}
+}
+
+// writeWithRetry returns an error wrapping errInfluxdbUnavailable if the final attempt failed with a retryable error,
+// or a permanent error if InfluxDB rejected the batch.
+func (w *influxdbWriter) writeWithRetry(ctx context.Context, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= writeMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(writeRetryBackoff * time.Duration(attempt-1)):
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %w", errInfluxdbUnavailable, err)
+			}
+		}
+		var retryable bool
+		if retryable, err = w.writeOnce(ctx, body); err == nil {
+			return nil
+		} else if !retryable {
+			return consumererror.NewPermanent(err)
+		}
+		w.logger.Debug("retrying write to InfluxDB", zap.Int("attempt", attempt), zap.Error(err))
+	}
+	return fmt.Errorf("%w: %w", errInfluxdbUnavailable, err)
+}
+
+func (w *influxdbWriter) writeOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.authToken != "" {
+		req.Header.Set("Authorization", "Token "+w.authToken)
+	}
+
+	res, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	retryable := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retryable, fmt.Errorf("InfluxDB write API returned status %s: %s", res.Status, strings.TrimSpace(string(resBody)))
+}
+
+// Close stops accepting batches, then waits for queued batches to be written,
+// or for ctx to be done.
+func (w *influxdbWriter) Close(ctx context.Context) error {
+	w.queueMu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.workerWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d queued batches not written to InfluxDB: %w", len(w.queue), ctx.Err())
+	}
+}
+
+type influxdbWriterBatch struct {
+	w       *influxdbWriter
+	encoder *lineprotocol.Encoder
+}
+
+func (b *influxdbWriterBatch) EnqueuePoint(ctx context.Context, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time, vType common.InfluxMetricValueType) error {
+	lineStart := len(b.encoder.Bytes())
+	b.encoder.StartLine(measurement)
+	tagKeys := make([]string, 0, len(tags))
+	for k := range tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		b.encoder.AddTag(k, tags[k])
+	}
+	for k, v := range fields {
+		if fieldValue, ok := lineprotocol.NewValue(v); ok {
+			b.encoder.AddField(k, fieldValue)
+		} else {
+			b.w.logger.Debug("failed to cast field to line protocol field value", zap.String("field", k), zap.String("type", fmt.Sprintf("%T", v)))
+		}
+	}
+	b.encoder.EndLine(ts)
+	if err := b.encoder.Err(); err != nil {
+		// discard the partial line
+		b.encoder.SetBuffer(b.encoder.Bytes()[:lineStart])
+		return fmt.Errorf("failed to encode point as line protocol: %w", err)
+	}
+	return nil
+}
+
+func (b *influxdbWriterBatch) WriteBatch(ctx context.Context) error {
+	body := b.encoder.Bytes()
+	if len(body) == 0 {
+		return nil
+	}
+	// the queue owns body now
+	b.encoder.SetBuffer(nil)
+	return b.w.write(ctx, body)
+}
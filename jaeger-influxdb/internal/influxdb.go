@@ -2,7 +2,6 @@ package internal
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"net"
@@ -14,13 +13,16 @@ import (
 
 	"github.com/apache/arrow-adbc/go/adbc"
 	"github.com/apache/arrow-adbc/go/adbc/driver/flightsql"
-	_ "github.com/apache/arrow-adbc/go/adbc/sqldriver/flightsql"
+	"github.com/apache/arrow/go/v16/arrow"
 	"github.com/golang/groupcache/lru"
 	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/common"
 )
 
 var _ shared.StoragePlugin = (*InfluxdbStorage)(nil)
@@ -35,6 +37,8 @@ const (
 	tableSpanMetricsDuration         = "duration_ms_histogram"                                    // https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.78.0/connector/spanmetricsconnector
 	tableServiceGraphRequestCount    = "traces_service_graph_request_total__sum"                  // https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.78.0/connector/servicegraphconnector
 	tableServiceGraphRequestDuration = "traces_service_graph_request_duration_seconds__histogram" // https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.78.0/connector/servicegraphconnector
+	columnSpanMetricsStatusCode      = "status.code"                                              // https://github.com/open-telemetry/opentelemetry-collector-contrib/blob/v0.78.0/connector/spanmetricsconnector/connector.go#L32
+	statusCodeError                  = "STATUS_CODE_ERROR"
 	columnServiceGraphClient         = "client"
 	columnServiceGraphServer         = "server"
 	columnServiceGraphCount          = "value_cumulative_monotonic_int"
@@ -48,12 +52,13 @@ type InfluxdbStorage struct {
 
 	queryTimeout time.Duration
 
-	db               *sql.DB
+	db               *adbcDB
 	reader           spanstore.Reader
 	readerDependency dependencystore.Reader
-	writer           spanstore.Writer
+	readerMetrics    metricsstore.Reader
+	writer           *influxdbWriterPrimary
 
-	dbArchive     *sql.DB
+	dbArchive     *adbcDB
 	readerArchive spanstore.Reader
 	writerArchive spanstore.Writer
 }
@@ -74,6 +79,35 @@ func NewInfluxdbStorage(ctx context.Context, config *Config) (*InfluxdbStorage,
 	if config.InfluxdbBucketArchive == "" {
 		logger.Warn("influxdb-bucket-archive not specified, so trace archiving is disabled")
 	}
+	switch config.MetadataSource {
+	case metadataSourceAuto, metadataSourceConnectors, metadataSourceSpans:
+	default:
+		return nil, fmt.Errorf("metadata-source value is invalid '%s'", config.MetadataSource)
+	}
+	if config.QueryMaxTraces < 1 {
+		return nil, fmt.Errorf("query-max-traces must be positive, got %d", config.QueryMaxTraces)
+	}
+	if config.QueryMaxSpansPerTrace < 1 {
+		return nil, fmt.Errorf("query-max-spans-per-trace must be positive, got %d", config.QueryMaxSpansPerTrace)
+	}
+	if config.QueryParallelism < 1 {
+		return nil, fmt.Errorf("query-parallelism must be positive, got %d", config.QueryParallelism)
+	}
+	if config.QueryTraceLookback < 0 || config.QueryTraceMaxLookback < 0 {
+		return nil, fmt.Errorf("query-trace-lookback and query-trace-max-lookback must not be negative")
+	}
+	if config.MetadataSpansLookback <= 0 {
+		return nil, fmt.Errorf("metadata-spans-lookback must be positive, got %s", config.MetadataSpansLookback)
+	}
+
+	resourceAttributes, err := common.NewResourceAttributeClassifier(&common.ResourceAttributeClassifierConfig{
+		SemconvVersion:  config.ResourceSemconvVersion,
+		IncludePatterns: config.ResourceAttributeInclude,
+		ExcludePatterns: config.ResourceAttributeExclude,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	is := &InfluxdbStorage{
 		logger:       logger,
@@ -84,76 +118,109 @@ func NewInfluxdbStorage(ctx context.Context, config *Config) (*InfluxdbStorage,
 	if config.InfluxdbTLSDisable {
 		uriScheme = uriSchemeNotSecure
 	}
-	dsn := []string{
-		fmt.Sprintf("%s=%s://%s/", adbc.OptionKeyURI, uriScheme, influxdbAddr),
-		fmt.Sprintf("%s=Bearer %s", flightsql.OptionAuthorizationHeader, config.InfluxdbToken),
-		fmt.Sprintf("%s=%s", flightsql.OptionRPCCallHeaderPrefix+"bucket-name", config.InfluxdbBucket),
+	options := map[string]string{
+		adbc.OptionKeyURI:                                   fmt.Sprintf("%s://%s/", uriScheme, influxdbAddr),
+		flightsql.OptionAuthorizationHeader:                 "Bearer " + config.InfluxdbToken,
+		flightsql.OptionRPCCallHeaderPrefix + "bucket-name": config.InfluxdbBucket,
 	}
 	for k, v := range config.InfluxdbQueryMetadata {
 		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
-		if len(k) == 0 || strings.Contains(k, ";") || strings.Contains(v, ";") {
+		if len(k) == 0 {
 			return nil, fmt.Errorf("invalid gRPC metadata: %s=%s", k, v)
 		}
-		dsn = append(dsn, fmt.Sprintf("%s=%s", flightsql.OptionRPCCallHeaderPrefix+k, v))
+		options[flightsql.OptionRPCCallHeaderPrefix+k] = v
 	}
 
-	db, err := sql.Open("flightsql", strings.Join(dsn, " ; "))
-	if err != nil {
-		row := db.QueryRowContext(ctx, "SELECT 1")
-		var v int
-		err = multierr.Combine(row.Scan(&v))
-		if err == nil && v != 1 {
-			err = errors.New("failed to ping database")
-		}
-	}
+	db, err := newADBCDB(options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to contact InfluxDB query service: %w", err)
 	}
+	// InfluxDB may become available after this service starts, so a failed ping is not fatal
+	if err = pingADBCDB(ctx, db); err != nil {
+		logger.Warn("failed to ping InfluxDB query service", zap.Error(err))
+	}
 
 	reader := &influxdbReader{
-		logger:         logger.With(zap.String("influxdb", "reader")),
-		executeQuery:   is.executeQuery,
-		db:             db,
-		tableSpans:     tableSpans,
-		tableLogs:      tableLogs,
-		tableSpanLinks: tableSpanLinks,
+		logger:            logger.With(zap.String("influxdb", "reader")),
+		executeQuery:      is.executeQuery,
+		executeArrowQuery: is.executeArrowQuery,
+		db:                db,
+		tableSpans:        tableSpans,
+		tableLogs:         tableLogs,
+		tableSpanLinks:    tableSpanLinks,
+
+		resourceAttributes: resourceAttributes,
+
+		maxTraces:        config.QueryMaxTraces,
+		maxSpansPerTrace: config.QueryMaxSpansPerTrace,
+		traceLookback:    config.QueryTraceLookback,
+		traceMaxLookback: config.QueryTraceMaxLookback,
+		queryTimeout:     config.InfluxdbTimeout,
+		queryParallelism: config.QueryParallelism,
+
+		metadataSource:        config.MetadataSource,
+		metadataSpansLookback: config.MetadataSpansLookback,
+		metadataCache:         newMetadataCache(config.MetadataCacheTTL),
 	}
 	readerDependency := &influxdbDependencyReader{
 		logger: logger.With(zap.String("influxdb", "reader-dependency")),
 		ir:     reader,
 	}
-	writer := &influxdbWriterNoop{
-		logger: logger.With(zap.String("influxdb", "writer")),
+	readerMetrics := &influxdbMetricsReader{
+		logger:       logger.With(zap.String("influxdb", "reader-metrics")),
+		executeQuery: is.executeQuery,
+		db:           db,
+		tableCalls:   tableSpanMetricsCalls,
+		tableLatency: tableSpanMetricsDuration,
+	}
+	writer, err := newInfluxdbWriterPrimary(logger.With(zap.String("influxdb", "writer")),
+		&http.Client{Timeout: config.InfluxdbTimeout}, composeWriteURL(influxdbAddr, config.InfluxdbTLSDisable, config.InfluxdbBucket),
+		config.InfluxdbToken, config.InfluxdbWriteBatchSize, config.InfluxdbWriteFlushInterval)
+	if err != nil {
+		return nil, multierr.Combine(err, db.Close())
 	}
 
 	is.db = db
 	is.reader = reader
 	is.readerDependency = readerDependency
+	is.readerMetrics = readerMetrics
 	is.writer = writer
 
 	var readerArchive spanstore.Reader
 	var writerArchive spanstore.Writer
-	var dbArchive *sql.DB
+	var dbArchive *adbcDB
 
 	if config.InfluxdbBucketArchive != "" {
-		dsnArchive := strings.Join([]string{
-			fmt.Sprintf("%s=%s://%s/", adbc.OptionKeyURI, uriScheme, influxdbAddr),
-			fmt.Sprintf("%s=Bearer %s", flightsql.OptionAuthorizationHeader, config.InfluxdbToken),
-			fmt.Sprintf("%s=%s", flightsql.OptionRPCCallHeaderPrefix+"bucket-name", config.InfluxdbBucketArchive),
-		}, " ; ")
-
-		dbArchive, err = sql.Open("flightsql", dsnArchive)
+		dbArchive, err = newADBCDB(map[string]string{
+			adbc.OptionKeyURI:                                   fmt.Sprintf("%s://%s/", uriScheme, influxdbAddr),
+			flightsql.OptionAuthorizationHeader:                 "Bearer " + config.InfluxdbToken,
+			flightsql.OptionRPCCallHeaderPrefix + "bucket-name": config.InfluxdbBucketArchive,
+		})
 		if err != nil {
-			return nil, err
+			return nil, multierr.Combine(err, writer.Close(config.InfluxdbTimeout), db.Close())
 		}
 
 		readerArchive = &influxdbReader{
-			logger:         logger.With(zap.String("influxdb", "reader-archive")),
-			executeQuery:   is.executeQuery,
-			db:             dbArchive,
-			tableSpans:     tableSpans,
-			tableLogs:      tableLogs,
-			tableSpanLinks: tableSpanLinks,
+			logger:            logger.With(zap.String("influxdb", "reader-archive")),
+			executeQuery:      is.executeQuery,
+			executeArrowQuery: is.executeArrowQuery,
+			db:                dbArchive,
+			tableSpans:        tableSpans,
+			tableLogs:         tableLogs,
+			tableSpanLinks:    tableSpanLinks,
+
+			resourceAttributes: resourceAttributes,
+
+			maxTraces:        config.QueryMaxTraces,
+			maxSpansPerTrace: config.QueryMaxSpansPerTrace,
+			traceLookback:    config.QueryTraceLookback,
+			traceMaxLookback: config.QueryTraceMaxLookback,
+			queryTimeout:     config.InfluxdbTimeout,
+			queryParallelism: config.QueryParallelism,
+
+			metadataSource:        config.MetadataSource,
+			metadataSpansLookback: config.MetadataSpansLookback,
+			metadataCache:         newMetadataCache(config.MetadataCacheTTL),
 		}
 		writerArchive = &influxdbWriterArchive{
 			logger:       logger.With(zap.String("influxdb", "writer-archive")),
@@ -168,7 +235,7 @@ func NewInfluxdbStorage(ctx context.Context, config *Config) (*InfluxdbStorage,
 			tableLogsSrc:      tableLogs,
 			tableSpanLinksSrc: tableSpanLinks,
 
-			writeURLArchive:       composeWriteURL(influxdbAddr, config.InfluxdbBucketArchive),
+			writeURLArchive:       composeWriteURL(influxdbAddr, config.InfluxdbTLSDisable, config.InfluxdbBucketArchive),
 			bucketNameArchive:     config.InfluxdbBucketArchive,
 			tableSpansArchive:     tableSpans,
 			tableLogsArchive:      tableLogs,
@@ -184,7 +251,7 @@ func NewInfluxdbStorage(ctx context.Context, config *Config) (*InfluxdbStorage,
 }
 
 func (is *InfluxdbStorage) Close() error {
-	err := is.db.Close()
+	err := multierr.Combine(is.writer.Close(is.queryTimeout), is.db.Close())
 	if is.dbArchive != nil {
 		err = multierr.Append(err, is.dbArchive.Close())
 	}
@@ -199,6 +266,11 @@ func (is *InfluxdbStorage) DependencyReader() dependencystore.Reader {
 	return is.readerDependency
 }
 
+// MetricsReader reads the metrics of the Jaeger Service Performance Monitoring tab.
+func (is *InfluxdbStorage) MetricsReader() metricsstore.Reader {
+	return is.readerMetrics
+}
+
 func (is *InfluxdbStorage) SpanWriter() spanstore.Writer {
 	return is.writer
 }
@@ -211,51 +283,45 @@ func (is *InfluxdbStorage) ArchiveSpanWriter() spanstore.Writer {
 	return is.writerArchive
 }
 
-func (is *InfluxdbStorage) executeQuery(ctx context.Context, db *sql.DB, query string, f func(record map[string]interface{}) error) error {
+// executeArrowQuery executes query and calls f with each record batch of the result.
+func (is *InfluxdbStorage) executeArrowQuery(ctx context.Context, db *adbcDB, query string, f func(batch arrow.Record) error) error {
 	ctx, cancel := context.WithTimeout(ctx, is.queryTimeout)
 	defer cancel()
 
 	is.logger.Debug("executing query", zap.String("query", query))
 
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = rows.Close() }()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return err
-	}
-	m := make(map[string]interface{}, len(columns))
+	return db.query(ctx, query, f)
+}
 
-	rowValues := make([]interface{}, len(columns))
-	for i := range rowValues {
-		rowValues[i] = new(interface{})
-	}
+// executeQuery executes query and calls f with each row of the result, keyed by column name.
+// The map is reused between rows.
+func (is *InfluxdbStorage) executeQuery(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+	return is.executeArrowQuery(ctx, db, query, func(batch arrow.Record) error {
+		return recordBatchToMaps(batch, f)
+	})
+}
 
-	for rows.Next() {
-		if err = rows.Scan(rowValues[:]...); err != nil {
-			return err
-		}
-		for i, columnName := range columns {
-			v := rowValues[i].(*interface{})
-			if v == nil || *v == nil {
-				delete(m, columnName)
-			} else {
-				m[columnName] = *v
-			}
-		}
-		if err = f(m); err != nil {
-			return err
+// pingADBCDB checks that db answers queries.
+func pingADBCDB(ctx context.Context, db *adbcDB) error {
+	var v interface{}
+	err := db.query(ctx, "SELECT 1", func(batch arrow.Record) error {
+		if batch.NumRows() > 0 && batch.NumCols() > 0 && !batch.Column(0).IsNull(0) {
+			v = arrowValue(batch.Column(0), 0)
 		}
+		return nil
+	})
+	if err == nil && v != int64(1) {
+		err = errors.New("failed to ping database")
 	}
-
-	return multierr.Combine(rows.Err(), rows.Close())
+	return err
 }
 
-func composeWriteURL(influxdbClientHost, influxdbBucket string) string {
-	writeURL := &url.URL{Scheme: "https", Host: influxdbClientHost, Path: "/api/v2/write"}
+func composeWriteURL(influxdbClientHost string, tlsDisable bool, influxdbBucket string) string {
+	scheme := "https"
+	if tlsDisable {
+		scheme = "http"
+	}
+	writeURL := &url.URL{Scheme: scheme, Host: influxdbClientHost, Path: "/api/v2/write"}
 
 	queryValues := writeURL.Query()
 	queryValues.Set("precision", "ns")
@@ -0,0 +1,398 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2/metrics"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
+	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
+	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/common"
+)
+
+var _ metricsstore.Reader = (*influxdbMetricsReader)(nil)
+
+const (
+	// minStep matches the Jaeger Prometheus metrics reader.
+	// The actual resolution is the flush interval of the spanmetrics connector.
+	minStep = time.Millisecond
+	// maxPointsPerSeries matches the Prometheus query API limit.
+	maxPointsPerSeries = 11000
+
+	labelServiceName = "service_name"
+	labelOperation   = "operation"
+)
+
+// influxdbMetricsReader reads the Jaeger Service Performance Monitoring metrics
+// from the tables of the spanmetrics connector, as written by otel2influx with the otel-v1 schema.
+//
+// Rates and quantiles are computed like the PromQL functions rate and histogram_quantile,
+// over raw points selected for the query time range.
+type influxdbMetricsReader struct {
+	logger *zap.Logger
+
+	executeQuery func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error
+
+	db                       *adbcDB
+	tableCalls, tableLatency string
+}
+
+func (imr *influxdbMetricsReader) GetLatencies(ctx context.Context, params *metricsstore.LatenciesQueryParameters) (*metrics.MetricFamily, error) {
+	if params.Quantile < 0 || params.Quantile > 1 {
+		return nil, fmt.Errorf("quantile value is invalid '%v'", params.Quantile)
+	}
+	return imr.getMetricFamily(ctx, imr.tableLatency, &params.BaseQueryParameters,
+		"service_latencies", fmt.Sprintf("%.2fth quantile latency, grouped by service", params.Quantile),
+		func(group []*spanMetricsSeries, from, to time.Time) (float64, bool) {
+			total, buckets := 0.0, make(map[float64]float64)
+			for _, series := range group {
+				if r, ok := series.rate(from, to); ok {
+					total += r.count
+					for bound, count := range r.buckets {
+						buckets[bound] += count
+					}
+				}
+			}
+			return histogramQuantile(params.Quantile, total, buckets)
+		})
+}
+
+func (imr *influxdbMetricsReader) GetCallRates(ctx context.Context, params *metricsstore.CallRateQueryParameters) (*metrics.MetricFamily, error) {
+	return imr.getMetricFamily(ctx, imr.tableCalls, &params.BaseQueryParameters,
+		"service_call_rate", "calls/sec, grouped by service",
+		func(group []*spanMetricsSeries, from, to time.Time) (float64, bool) {
+			calls, _, ok := callRates(group, from, to)
+			return calls, ok
+		})
+}
+
+func (imr *influxdbMetricsReader) GetErrorRates(ctx context.Context, params *metricsstore.ErrorRateQueryParameters) (*metrics.MetricFamily, error) {
+	return imr.getMetricFamily(ctx, imr.tableCalls, &params.BaseQueryParameters,
+		"service_error_rate", "error rate, computed as a fraction of errors/sec over calls/sec, grouped by service",
+		func(group []*spanMetricsSeries, from, to time.Time) (float64, bool) {
+			calls, errs, ok := callRates(group, from, to)
+			if !ok || calls == 0 {
+				return 0, false
+			}
+			return errs / calls, true
+		})
+}
+
+func (imr *influxdbMetricsReader) GetMinStepDuration(_ context.Context, _ *metricsstore.MinStepDurationQueryParameters) (time.Duration, error) {
+	return minStep, nil
+}
+
+// callRates sums the call rates, and the error call rates, of a group of series.
+func callRates(group []*spanMetricsSeries, from, to time.Time) (calls, errs float64, ok bool) {
+	for _, series := range group {
+		if r, found := series.rate(from, to); found {
+			ok = true
+			calls += r.count
+			if series.errored {
+				errs += r.count
+			}
+		}
+	}
+	return
+}
+
+func (imr *influxdbMetricsReader) getMetricFamily(ctx context.Context, table string, bqp *metricsstore.BaseQueryParameters,
+	name, help string, evaluate func(group []*spanMetricsSeries, from, to time.Time) (float64, bool)) (*metrics.MetricFamily, error) {
+	if len(bqp.ServiceNames) == 0 {
+		return nil, errors.New("no service names specified")
+	}
+	if bqp.EndTime == nil || bqp.Lookback == nil || bqp.Step == nil || bqp.RatePer == nil {
+		return nil, errors.New("end time, lookback, step and rate-per must be specified")
+	}
+	if *bqp.Step <= 0 || *bqp.RatePer <= 0 || *bqp.Lookback < 0 {
+		return nil, fmt.Errorf("step and rate-per must be positive, and lookback must not be negative")
+	}
+	if *bqp.Lookback/(*bqp.Step) >= maxPointsPerSeries {
+		return nil, fmt.Errorf("exceeded maximum resolution of %d points per timeseries", maxPointsPerSeries)
+	}
+	end := *bqp.EndTime
+	start := end.Add(-*bqp.Lookback)
+
+	if bqp.GroupByOperation {
+		name = strings.Replace(name, "service", "service_operation", 1)
+		help = strings.Replace(help, "service", "service & operation", 1)
+	}
+	metricFamily := &metrics.MetricFamily{
+		Name:    name,
+		Type:    metrics.MetricType_GAUGE,
+		Help:    help,
+		Metrics: []*metrics.Metric{},
+	}
+
+	seriesByKey := make(map[string]*spanMetricsSeries)
+	f := func(record map[string]interface{}) error {
+		series, sample, err := recordToSpanMetricsSample(record)
+		if err != nil {
+			imr.logger.Debug("failed to convert spanmetrics point; point skipped", zap.Error(err))
+			return nil
+		}
+		if existing, found := seriesByKey[series.key]; found {
+			series = existing
+		} else {
+			seriesByKey[series.key] = series
+		}
+		series.samples = append(series.samples, sample)
+		return nil
+	}
+	err := imr.executeQuery(ctx, imr.db, querySpanMetrics(table, bqp, start.Add(-*bqp.RatePer), end), f)
+	if err != nil {
+		if isTableNotFound(err) { // ignore table not found (schema-on-write)
+			return metricFamily, nil
+		}
+		return nil, err
+	}
+
+	groups := make(map[[2]string][]*spanMetricsSeries)
+	for _, series := range seriesByKey {
+		sort.SliceStable(series.samples, func(i, j int) bool { return series.samples[i].time.Before(series.samples[j].time) })
+		groupKey := [2]string{series.serviceName}
+		if bqp.GroupByOperation {
+			groupKey[1] = series.operation
+		}
+		groups[groupKey] = append(groups[groupKey], series)
+	}
+	groupKeys := make([][2]string, 0, len(groups))
+	for groupKey := range groups {
+		groupKeys = append(groupKeys, groupKey)
+	}
+	sort.Slice(groupKeys, func(i, j int) bool {
+		if groupKeys[i][0] != groupKeys[j][0] {
+			return groupKeys[i][0] < groupKeys[j][0]
+		}
+		return groupKeys[i][1] < groupKeys[j][1]
+	})
+
+	for _, groupKey := range groupKeys {
+		var metricPoints []*metrics.MetricPoint
+		for t := start; !t.After(end); t = t.Add(*bqp.Step) {
+			value, ok := evaluate(groups[groupKey], t.Add(-*bqp.RatePer), t)
+			if !ok || math.IsNaN(value) {
+				continue
+			}
+			timestamp, err := types.TimestampProto(t)
+			if err != nil {
+				return nil, err
+			}
+			metricPoints = append(metricPoints, &metrics.MetricPoint{
+				Timestamp: timestamp,
+				Value: &metrics.MetricPoint_GaugeValue{
+					GaugeValue: &metrics.GaugeValue{Value: &metrics.GaugeValue_DoubleValue{DoubleValue: value}},
+				},
+			})
+		}
+		if len(metricPoints) == 0 {
+			continue
+		}
+		labels := []*metrics.Label{{Name: labelServiceName, Value: groupKey[0]}}
+		if bqp.GroupByOperation {
+			labels = append(labels, &metrics.Label{Name: labelOperation, Value: groupKey[1]})
+		}
+		metricFamily.Metrics = append(metricFamily.Metrics, &metrics.Metric{Labels: labels, MetricPoints: metricPoints})
+	}
+
+	return metricFamily, nil
+}
+
+// spanMetricsSeries is one time series of a spanmetrics connector table, identified by its tag set.
+type spanMetricsSeries struct {
+	key                    string
+	serviceName, operation string
+	errored                bool
+	delta                  bool
+	samples                []spanMetricsSample
+}
+
+// spanMetricsSample is a count, and for histograms, the count of each bucket by upper bound.
+// The +Inf bucket is not stored by the otel-v1 schema; it is inferred from the total count.
+type spanMetricsSample struct {
+	time    time.Time
+	count   float64
+	buckets map[float64]float64
+}
+
+// recordToSpanMetricsSample converts a point of the calls table, or of the duration histogram table.
+// String-valued columns are tags, and identify the series.
+func recordToSpanMetricsSample(record map[string]interface{}) (*spanMetricsSeries, spanMetricsSample, error) {
+	series := new(spanMetricsSeries)
+	var sample spanMetricsSample
+	var foundCount bool
+	var tagKeys []string
+
+	for k, v := range record {
+		if k == common.AttributeTime {
+			var ok bool
+			if sample.time, ok = v.(time.Time); !ok {
+				return nil, sample, fmt.Errorf("time is type %T", v)
+			}
+			continue
+		}
+		if s, ok := v.(string); ok {
+			tagKeys = append(tagKeys, k)
+			switch k {
+			case semconv.AttributeServiceName:
+				series.serviceName = s
+			case common.AttributeSpanName:
+				series.operation = s
+			case columnSpanMetricsStatusCode:
+				series.errored = s == statusCodeError
+			}
+			continue
+		}
+
+		var temporality, bound string
+		switch {
+		case k == common.MetricHistogramCountFieldKey:
+		case strings.HasPrefix(k, "value_"): // calls: value_<temporality>_monotonic_<type>
+			temporality, _, _ = strings.Cut(strings.TrimPrefix(k, "value_"), "_")
+		default: // histogram: <temporality>_<bound>
+			temporality, bound, _ = strings.Cut(k, "_")
+		}
+		if temporality != "" && temporality != "cumulative" && temporality != "delta" {
+			continue
+		}
+		value, ok := toFloat64(v)
+		if !ok {
+			continue
+		}
+		series.delta = temporality == "delta" || series.delta
+		if bound == "" {
+			sample.count = value
+			foundCount = true
+			continue
+		}
+		upperBound, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			continue
+		}
+		if sample.buckets == nil {
+			sample.buckets = make(map[float64]float64)
+		}
+		sample.buckets[upperBound] = value
+	}
+
+	if sample.time.IsZero() {
+		return nil, sample, errors.New("time not found")
+	}
+	if series.serviceName == "" {
+		return nil, sample, errors.New("service name not found")
+	}
+	if !foundCount {
+		return nil, sample, errors.New("count not found")
+	}
+	sort.Strings(tagKeys)
+	var key strings.Builder
+	for _, k := range tagKeys {
+		key.WriteString(strconv.Quote(k))
+		key.WriteByte('=')
+		key.WriteString(strconv.Quote(record[k].(string)))
+		key.WriteByte(',')
+	}
+	series.key = key.String()
+
+	return series, sample, nil
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch vv := v.(type) {
+	case float64:
+		return vv, true
+	case int64:
+		return float64(vv), true
+	case uint64:
+		return float64(vv), true
+	default:
+		return 0, false
+	}
+}
+
+// rate computes the per-second rate of a series, over the samples in the time range (from, to].
+// Cumulative series need two samples, and counter resets are handled like PromQL.
+func (s *spanMetricsSeries) rate(from, to time.Time) (spanMetricsSample, bool) {
+	i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].time.After(from) })
+	j := sort.Search(len(s.samples), func(j int) bool { return s.samples[j].time.After(to) })
+	samples := s.samples[i:j]
+
+	var seconds float64
+	result := spanMetricsSample{time: to, buckets: make(map[float64]float64)}
+	if s.delta {
+		if len(samples) == 0 {
+			return result, false
+		}
+		for _, sample := range samples {
+			result.count += sample.count
+			for bound, count := range sample.buckets {
+				result.buckets[bound] += count
+			}
+		}
+		seconds = to.Sub(from).Seconds()
+	} else {
+		if len(samples) < 2 {
+			return result, false
+		}
+		for k := 1; k < len(samples); k++ {
+			result.count += increase(samples[k-1].count, samples[k].count)
+			for bound, count := range samples[k].buckets {
+				result.buckets[bound] += increase(samples[k-1].buckets[bound], count)
+			}
+		}
+		seconds = samples[len(samples)-1].time.Sub(samples[0].time).Seconds()
+	}
+	if seconds <= 0 {
+		return result, false
+	}
+
+	result.count /= seconds
+	for bound := range result.buckets {
+		result.buckets[bound] /= seconds
+	}
+	return result, true
+}
+
+func increase(previous, current float64) float64 {
+	if current < previous { // counter reset
+		return current
+	}
+	return current - previous
+}
+
+// histogramQuantile estimates quantile q from non-cumulative bucket counts, like the PromQL function histogram_quantile.
+// Values are interpolated linearly within a bucket; the lower bound of the lowest bucket is zero, if the upper bound is positive.
+// If the quantile is in the +Inf bucket, then the highest finite upper bound is returned.
+func histogramQuantile(q, total float64, buckets map[float64]float64) (float64, bool) {
+	if total <= 0 || len(buckets) == 0 {
+		return 0, false
+	}
+	bounds := make([]float64, 0, len(buckets))
+	for bound := range buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * total
+	var lowerBound, cumulative float64
+	for i, upperBound := range bounds {
+		count := buckets[upperBound]
+		if cumulative+count >= rank && count > 0 {
+			if i == 0 && upperBound <= 0 {
+				return upperBound, true
+			}
+			return lowerBound + (upperBound-lowerBound)*(rank-cumulative)/count, true
+		}
+		lowerBound, cumulative = upperBound, cumulative+count
+	}
+	return bounds[len(bounds)-1], true
+}
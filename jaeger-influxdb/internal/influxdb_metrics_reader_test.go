@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2/metrics"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := map[float64]float64{1: 1, 2: 1, 4: 2}
+	for _, testCase := range []struct {
+		q, total, expected float64
+	}{
+		{0.25, 4, 1},
+		{0.5, 4, 2},
+		{0.75, 4, 3},
+		{1, 4, 4},
+		{1, 5, 4}, // +Inf bucket
+	} {
+		actual, ok := histogramQuantile(testCase.q, testCase.total, buckets)
+		assert.True(t, ok)
+		assert.Equal(t, testCase.expected, actual, "q=%v total=%v", testCase.q, testCase.total)
+	}
+
+	_, ok := histogramQuantile(0.5, 0, buckets)
+	assert.False(t, ok)
+	_, ok = histogramQuantile(0.5, 4, nil)
+	assert.False(t, ok)
+}
+
+func TestSpanMetricsSeriesRate(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	series := &spanMetricsSeries{samples: []spanMetricsSample{
+		{time: t0, count: 0},
+		{time: t0.Add(10 * time.Second), count: 10},
+		{time: t0.Add(20 * time.Second), count: 20},
+		{time: t0.Add(30 * time.Second), count: 5}, // counter reset
+	}}
+	r, ok := series.rate(t0.Add(-time.Second), t0.Add(30*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, 25.0/30, r.count)
+
+	_, ok = series.rate(t0.Add(25*time.Second), t0.Add(time.Minute))
+	assert.False(t, ok, "one cumulative sample is not enough")
+
+	series.delta = true
+	r, ok = series.rate(t0.Add(25*time.Second), t0.Add(35*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, 0.5, r.count)
+}
+
+// newTestMetricsReader returns a reader of synthetic cumulative points, every 10s from t0 through t0+60s.
+// Service "my-service" operation "GET /" has 1 OK call/s and 0.5 error calls/s;
+// each 10s adds latencies 1x <=10ms, 2x <=100ms and 1x <=1000ms.
+func newTestMetricsReader(t *testing.T, t0 time.Time) *influxdbMetricsReader {
+	executeQuery := func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+		for i := 0; i <= 6; i++ {
+			ts := t0.Add(time.Duration(i) * 10 * time.Second)
+			n := int64(i)
+			var records []map[string]interface{}
+			switch {
+			case strings.Contains(query, quoteIdentifier(tableSpanMetricsCalls)):
+				records = []map[string]interface{}{{
+					"time": ts, "service.name": "my-service", "span.name": "GET /", "span.kind": "SPAN_KIND_SERVER", "status.code": "STATUS_CODE_UNSET",
+					"start_time_unix_nano": t0.UnixNano(), "value_cumulative_monotonic_int": 10 * n,
+				}, {
+					"time": ts, "service.name": "my-service", "span.name": "GET /", "span.kind": "SPAN_KIND_SERVER", "status.code": "STATUS_CODE_ERROR",
+					"start_time_unix_nano": t0.UnixNano(), "value_cumulative_monotonic_int": 5 * n,
+				}}
+			case strings.Contains(query, quoteIdentifier(tableSpanMetricsDuration)):
+				records = []map[string]interface{}{{
+					"time": ts, "service.name": "my-service", "span.name": "GET /", "span.kind": "SPAN_KIND_SERVER", "status.code": "STATUS_CODE_UNSET",
+					"cumulative_10": uint64(n), "cumulative_100": uint64(2 * n), "cumulative_1000": uint64(n),
+					"count": uint64(4 * n), "sum": float64(200 * n),
+				}}
+			default:
+				t.Fatalf("unexpected query %s", query)
+			}
+			for _, record := range records {
+				require.NoError(t, f(record))
+			}
+		}
+		return nil
+	}
+	return &influxdbMetricsReader{
+		logger:       zap.NewNop(),
+		executeQuery: executeQuery,
+		tableCalls:   tableSpanMetricsCalls,
+		tableLatency: tableSpanMetricsDuration,
+	}
+}
+
+func TestInfluxdbMetricsReader(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	reader := newTestMetricsReader(t, t0)
+	ctx := context.Background()
+
+	endTime, lookback, step, ratePer := t0.Add(time.Minute), 30*time.Second, 10*time.Second, 30*time.Second
+	bqp := metricsstore.BaseQueryParameters{
+		ServiceNames: []string{"my-service"},
+		EndTime:      &endTime,
+		Lookback:     &lookback,
+		Step:         &step,
+		RatePer:      &ratePer,
+		SpanKinds:    []string{"SPAN_KIND_SERVER"},
+	}
+	assertMetricFamily := func(t *testing.T, expectedName string, expectedLabels []*metrics.Label, expectedValue float64, actual *metrics.MetricFamily) {
+		t.Helper()
+		assert.Equal(t, expectedName, actual.Name)
+		assert.Equal(t, metrics.MetricType_GAUGE, actual.Type)
+		require.Len(t, actual.Metrics, 1)
+		assert.Equal(t, expectedLabels, actual.Metrics[0].Labels)
+		require.Len(t, actual.Metrics[0].MetricPoints, 4)
+		for i, metricPoint := range actual.Metrics[0].MetricPoints {
+			assert.Equal(t, endTime.Add(-lookback).Add(time.Duration(i)*step).Unix(), metricPoint.Timestamp.Seconds)
+			assert.InDelta(t, expectedValue, metricPoint.GetGaugeValue().GetDoubleValue(), 1e-9)
+		}
+	}
+	serviceLabels := []*metrics.Label{{Name: "service_name", Value: "my-service"}}
+
+	callRates, err := reader.GetCallRates(ctx, &metricsstore.CallRateQueryParameters{BaseQueryParameters: bqp})
+	require.NoError(t, err)
+	assertMetricFamily(t, "service_call_rate", serviceLabels, 1.5, callRates)
+
+	errorRates, err := reader.GetErrorRates(ctx, &metricsstore.ErrorRateQueryParameters{BaseQueryParameters: bqp})
+	require.NoError(t, err)
+	assertMetricFamily(t, "service_error_rate", serviceLabels, 1.0/3, errorRates)
+
+	latencies, err := reader.GetLatencies(ctx, &metricsstore.LatenciesQueryParameters{BaseQueryParameters: bqp, Quantile: 0.5})
+	require.NoError(t, err)
+	assertMetricFamily(t, "service_latencies", serviceLabels, 55, latencies)
+
+	bqp.GroupByOperation = true
+	latencies, err = reader.GetLatencies(ctx, &metricsstore.LatenciesQueryParameters{BaseQueryParameters: bqp, Quantile: 0.95})
+	require.NoError(t, err)
+	assertMetricFamily(t, "service_operation_latencies",
+		[]*metrics.Label{{Name: "service_name", Value: "my-service"}, {Name: "operation", Value: "GET /"}}, 820, latencies)
+
+	minStep, err := reader.GetMinStepDuration(ctx, &metricsstore.MinStepDurationQueryParameters{})
+	require.NoError(t, err)
+	assert.Equal(t, time.Millisecond, minStep)
+}
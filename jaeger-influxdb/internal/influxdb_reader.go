@@ -2,14 +2,20 @@ package internal
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/golang/groupcache/lru"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/dependencystore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/influxdata/influxdb-observability/common"
 )
@@ -20,64 +26,188 @@ var _ dependencystore.Reader = (*influxdbDependencyReader)(nil)
 type influxdbReader struct {
 	logger *zap.Logger
 
-	executeQuery func(ctx context.Context, db *sql.DB, query string, f func(record map[string]interface{}) error) error
+	executeQuery      func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error
+	executeArrowQuery func(ctx context.Context, db *adbcDB, query string, f func(batch arrow.Record) error) error
 
-	db                                    *sql.DB
+	db                                    *adbcDB
 	tableSpans, tableLogs, tableSpanLinks string
+
+	resourceAttributes *common.ResourceAttributeClassifier
+
+	maxTraces        int
+	maxSpansPerTrace int
+
+	traceLookback, traceMaxLookback time.Duration
+
+	queryTimeout     time.Duration
+	queryParallelism int
+
+	metadataSource        string
+	metadataSpansLookback time.Duration
+	metadataCache         *metadataCache
 }
 
+const (
+	// defaultNumTraces matches the default search limit of Jaeger UI.
+	defaultNumTraces = 20
+	// searchTimeRangePadding widens the time range of a trace search for the follow-up trace queries,
+	// so that spans just outside of the search range are included.
+	searchTimeRangePadding = time.Hour
+	// traceLookbackGrowth is the factor by which GetTrace widens its time range, when the trace is not found.
+	traceLookbackGrowth = 8
+	// traceLookbackEdge is how close to the start of the GetTrace time range a span may start,
+	// before earlier spans of the trace are assumed to be outside of the range.
+	traceLookbackEdge = time.Minute
+)
+
+// GetTrace gets a trace without time hints; the Jaeger v1.57 storage API has none.
+// The time range is widened, up to traceMaxLookback, if the trace is not found or looks incomplete:
+// it has no root span, or a span starts at the edge of the range.
+// traceLookbacks caps this at three scans, and the query timeout bounds all of them together.
 func (ir *influxdbReader) GetTrace(ctx context.Context, traceID model.TraceID) (*model.Trace, error) {
+	ctx, cancel := ir.withQueryTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	lookbacks := ir.traceLookbacks()
+	var found *model.Trace
+	for i, lookback := range lookbacks {
+		var tr timeRange
+		if lookback > 0 {
+			tr.start = now.Add(-lookback)
+		}
+		trace, err := ir.getTrace(ctx, traceID, tr)
+		switch {
+		case err != nil && found != nil:
+			// Keep the trace of the narrower range
+			ir.logger.Warn("failed to widen time range of incomplete trace", zap.Stringer("trace_id", traceID), zap.Error(err))
+			return found, nil
+		case i == len(lookbacks)-1, err != nil && !errors.Is(err, spanstore.ErrTraceNotFound):
+			return trace, err
+		case err != nil:
+			ir.logger.Debug("trace not found; widening time range", zap.Stringer("trace_id", traceID), zap.Duration("lookback", lookback))
+		case isTraceComplete(trace, tr):
+			return trace, nil
+		default:
+			ir.logger.Debug("trace incomplete; widening time range", zap.Stringer("trace_id", traceID), zap.Duration("lookback", lookback))
+			found = trace
+		}
+	}
+	return nil, spanstore.ErrTraceNotFound
+}
+
+// isTraceComplete reports whether a trace found in tr is unlikely to have spans before tr.
+func isTraceComplete(trace *model.Trace, tr timeRange) bool {
+	if tr.start.IsZero() {
+		return true
+	}
+	hasRoot := false
+	for _, span := range trace.Spans {
+		if span.StartTime.Before(tr.start.Add(traceLookbackEdge)) {
+			return false
+		}
+		if span.ParentSpanID() == 0 {
+			hasRoot = true
+		}
+	}
+	return hasRoot
+}
+
+// traceLookbacks returns the lookbacks tried by GetTrace, in order; zero is unbounded.
+// For example, 24h then 8d then unbounded; there are at most three.
+func (ir *influxdbReader) traceLookbacks() []time.Duration {
+	if ir.traceLookback <= 0 {
+		return []time.Duration{0}
+	}
+	lookbacks := []time.Duration{ir.traceLookback}
+	if ir.traceMaxLookback > 0 && ir.traceMaxLookback <= ir.traceLookback {
+		return lookbacks
+	}
+	if wider := ir.traceLookback * traceLookbackGrowth; ir.traceMaxLookback <= 0 || wider < ir.traceMaxLookback {
+		lookbacks = append(lookbacks, wider)
+	}
+	return append(lookbacks, ir.traceMaxLookback)
+}
+
+// getTrace gets a trace with spans that start within tr.
+func (ir *influxdbReader) getTrace(ctx context.Context, traceID model.TraceID, tr timeRange) (*model.Trace, error) {
 	// Get spans
 	spansBySpanID := make(map[model.SpanID]*model.Span)
 
-	f := func(record map[string]interface{}) error {
-		span, err := recordToSpan(record)
+	f := func(batch arrow.Record) error {
+		decoder, err := newSpanDecoder(batch, ir.resourceAttributes)
 		if err != nil {
 			ir.logger.Warn("failed to convert span to Span", zap.Error(err))
-		} else {
-			spansBySpanID[span.SpanID] = span
+			return nil
+		}
+		ir.warnSpanDecoder(decoder)
+		for row := 0; row < int(batch.NumRows()); row++ {
+			span, err := decoder.span(row)
+			if err != nil {
+				ir.logger.Warn("failed to convert span to Span", zap.Error(err))
+			} else {
+				spansBySpanID[span.SpanID] = span
+			}
 		}
 		return nil
 	}
-	err := ir.executeQuery(ctx, ir.db, queryGetTraceSpans(ir.tableSpans, traceID), f)
+	err := ir.executeArrowQuery(ctx, ir.db, queryGetTraceSpans(ir.tableSpans, tr, ir.maxSpansPerTrace, traceID), f)
 	switch {
 	case err != nil && !isTableNotFound(err): // ignore table not found (schema-on-write)
 		return nil, err
 	case len(spansBySpanID) == 0:
 		return nil, spanstore.ErrTraceNotFound
 	}
+	truncated := ir.truncateTrace(traceID, spansBySpanID)
 
-	// Get events
-	f = func(record map[string]interface{}) error {
-		if _, spanID, log, err := recordToLog(record); err != nil {
+	// Get events and links concurrently
+	var mu sync.Mutex
+	fEvents := func(batch arrow.Record) error {
+		decoder, err := newLogDecoder(batch)
+		if err != nil {
 			ir.logger.Warn("failed to convert event to Log", zap.Error(err))
-		} else if span, ok := spansBySpanID[spanID]; !ok {
-			ir.logger.Warn("span event contains unknown span ID")
-		} else {
-			span.Logs = append(span.Logs, *log)
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if _, spanID, log, err := decoder.log(row); err != nil {
+				ir.logger.Warn("failed to convert event to Log", zap.Error(err))
+			} else if span, ok := spansBySpanID[spanID]; !ok {
+				if !truncated {
+					ir.logger.Warn("span event contains unknown span ID")
+				}
+			} else {
+				span.Logs = append(span.Logs, *log)
+			}
 		}
 		return nil
 	}
-	err = ir.executeQuery(ctx, ir.db, queryGetTraceEvents(ir.tableLogs, traceID), f)
-	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
-		return nil, err
-	}
-
-	// Get links
-	f = func(record map[string]interface{}) error {
-		_, spanID, spanRef, err := recordToSpanRef(record)
+	fLinks := func(batch arrow.Record) error {
+		decoder, err := newSpanRefDecoder(batch)
 		if err != nil {
 			ir.logger.Warn("failed to convert link to SpanRef", zap.Error(err))
-		} else if span, found := spansBySpanID[spanID]; !found {
-			ir.logger.Warn("link contains unknown span ID")
-		} else {
-			span.References = append(span.References, *spanRef)
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if _, spanID, spanRef, err := decoder.spanRef(row); err != nil {
+				ir.logger.Warn("failed to convert link to SpanRef", zap.Error(err))
+			} else if span, found := spansBySpanID[spanID]; !found {
+				if !truncated {
+					ir.logger.Warn("link contains unknown span ID")
+				}
+			} else {
+				span.References = append(span.References, *spanRef)
+			}
 		}
 		return nil
 	}
-
-	err = ir.executeQuery(ctx, ir.db, queryGetTraceLinks(ir.tableSpanLinks, traceID), f)
-	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
+	err = ir.executeQueriesConcurrently(ctx,
+		recordQuery{query: queryGetTraceEvents(ir.tableLogs, tr, traceID), f: fEvents},
+		recordQuery{query: queryGetTraceLinks(ir.tableSpanLinks, tr, traceID), f: fLinks})
+	if err != nil {
 		return nil, err
 	}
 
@@ -91,7 +221,56 @@ func (ir *influxdbReader) GetTrace(ctx context.Context, traceID model.TraceID) (
 	return trace, nil
 }
 
+// warnSpanDecoder logs the span columns that are decoded as tags because of unexpected types.
+func (ir *influxdbReader) warnSpanDecoder(decoder *spanDecoder) {
+	if len(decoder.warnings) > 0 {
+		ir.logger.Warn("span columns of unexpected types are decoded as tags", zap.Strings("columns", decoder.warnings))
+	}
+}
+
+// truncateTrace keeps the earliest maxSpansPerTrace spans of a trace, as ranked by queryGetTraceSpans,
+// and reports whether spans were dropped. The earliest span is marked with a warning, which Jaeger UI shows.
+func (ir *influxdbReader) truncateTrace(traceID model.TraceID, spansBySpanID map[model.SpanID]*model.Span) bool {
+	if len(spansBySpanID) <= ir.maxSpansPerTrace {
+		return false
+	}
+	spans := make([]*model.Span, 0, len(spansBySpanID))
+	for _, span := range spansBySpanID {
+		spans = append(spans, span)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if !spans[i].StartTime.Equal(spans[j].StartTime) {
+			return spans[i].StartTime.Before(spans[j].StartTime)
+		}
+		return spans[i].SpanID < spans[j].SpanID
+	})
+	for _, span := range spans[ir.maxSpansPerTrace:] {
+		delete(spansBySpanID, span.SpanID)
+	}
+	spans[0].Warnings = append(spans[0].Warnings,
+		fmt.Sprintf("trace has more than %d spans; only the earliest %d spans are shown", ir.maxSpansPerTrace, ir.maxSpansPerTrace))
+	ir.logger.Warn("trace has too many spans; the earliest spans are kept",
+		zap.Stringer("trace_id", traceID), zap.Int("max_spans_per_trace", ir.maxSpansPerTrace))
+	return true
+}
+
 func (ir *influxdbReader) GetServices(ctx context.Context) ([]string, error) {
+	services, err := ir.metadataCache.getOrLoad("services", func() (interface{}, error) {
+		if ir.metadataSource != metadataSourceSpans {
+			services, err := ir.getServices(ctx, queryGetServices())
+			if err != nil || len(services) > 0 || ir.metadataSource == metadataSourceConnectors {
+				return services, err
+			}
+		}
+		return ir.getServices(ctx, queryGetServicesFromSpans(ir.tableSpans, time.Now().Add(-ir.metadataSpansLookback)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return services.([]string), nil
+}
+
+func (ir *influxdbReader) getServices(ctx context.Context, query string) ([]string, error) {
 	var services []string
 	f := func(record map[string]interface{}) error {
 		if v, found := record[semconv.AttributeServiceName]; found && v != nil {
@@ -100,7 +279,7 @@ func (ir *influxdbReader) GetServices(ctx context.Context) ([]string, error) {
 		return nil
 	}
 
-	err := ir.executeQuery(ctx, ir.db, queryGetServices(), f)
+	err := ir.executeQuery(ctx, ir.db, query, f)
 	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
 		return nil, err
 	}
@@ -108,91 +287,166 @@ func (ir *influxdbReader) GetServices(ctx context.Context) ([]string, error) {
 }
 
 func (ir *influxdbReader) GetOperations(ctx context.Context, operationQueryParameters spanstore.OperationQueryParameters) ([]spanstore.Operation, error) {
+	serviceName := operationQueryParameters.ServiceName
+	cached, err := ir.metadataCache.getOrLoad("operations "+serviceName, func() (interface{}, error) {
+		if ir.metadataSource != metadataSourceSpans {
+			operations, err := ir.getOperations(ctx, queryGetOperations(serviceName))
+			if err != nil || len(operations) > 0 || ir.metadataSource == metadataSourceConnectors {
+				return operations, err
+			}
+		}
+		return ir.getOperations(ctx, queryGetOperationsFromSpans(ir.tableSpans, serviceName, time.Now().Add(-ir.metadataSpansLookback)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	operations := cached.([]spanstore.Operation)
+	if operationQueryParameters.SpanKind == "" {
+		return operations, nil
+	}
+	var filtered []spanstore.Operation
+	for _, operation := range operations {
+		if operation.SpanKind == operationQueryParameters.SpanKind {
+			filtered = append(filtered, operation)
+		}
+	}
+	return filtered, nil
+}
+
+// getOperations reads span name and span kind columns.
+func (ir *influxdbReader) getOperations(ctx context.Context, query string) ([]spanstore.Operation, error) {
 	var operations []spanstore.Operation
 	f := func(record map[string]interface{}) error {
 		if v, found := record[common.AttributeSpanName]; found && v != nil {
 			operation := spanstore.Operation{Name: v.(string)}
 			if spanKind, found := record[common.AttributeSpanKind]; found && spanKind != nil {
-				operation.SpanKind = spanKind.(string)
+				operation.SpanKind = spanKindToJaeger(spanKind.(string))
 			}
 			operations = append(operations, operation)
 		}
 		return nil
 	}
 
-	err := ir.executeQuery(ctx, ir.db, queryGetOperations(operationQueryParameters.ServiceName), f)
+	err := ir.executeQuery(ctx, ir.db, query, f)
 	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
 		return nil, err
 	}
 	return operations, nil
 }
 
+// FindTraces finds trace IDs, then gets their spans, events and links.
+// The query timeout bounds all of these queries together.
 func (ir *influxdbReader) FindTraces(ctx context.Context, traceQueryParameters *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	ctx, cancel := ir.withQueryTimeout(ctx)
+	defer cancel()
+
 	// Get trace IDs
 	traceIDs, err := ir.FindTraceIDs(ctx, traceQueryParameters)
 	if err != nil || len(traceIDs) == 0 {
 		return nil, err
 	}
 
-	// Get traces
-	spansBySpanIDByTraceID := make(map[model.TraceID]map[model.SpanID]*model.Span)
-	f := func(record map[string]interface{}) error {
-		if span, err := recordToSpan(record); err != nil {
+	// Get traces, in the time range of the search
+	var tr timeRange
+	if !traceQueryParameters.StartTimeMin.IsZero() {
+		tr.start = traceQueryParameters.StartTimeMin.Add(-searchTimeRangePadding)
+	}
+	if !traceQueryParameters.StartTimeMax.IsZero() {
+		tr.end = traceQueryParameters.StartTimeMax.Add(searchTimeRangePadding)
+	}
+	spansBySpanIDByTraceID := make(map[model.TraceID]map[model.SpanID]*model.Span, len(traceIDs))
+	truncatedTraceIDs := make(map[model.TraceID]struct{})
+	f := func(batch arrow.Record) error {
+		decoder, err := newSpanDecoder(batch, ir.resourceAttributes)
+		if err != nil {
 			return err
-		} else if trace, found := spansBySpanIDByTraceID[span.TraceID]; !found {
-			spansBySpanIDByTraceID[span.TraceID] = map[model.SpanID]*model.Span{span.SpanID: span}
-		} else {
-			trace[span.SpanID] = span
+		}
+		ir.warnSpanDecoder(decoder)
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if span, err := decoder.span(row); err != nil {
+				return err
+			} else if trace, found := spansBySpanIDByTraceID[span.TraceID]; !found {
+				spansBySpanIDByTraceID[span.TraceID] = map[model.SpanID]*model.Span{span.SpanID: span}
+			} else {
+				trace[span.SpanID] = span
+			}
 		}
 		return nil
 	}
 
-	err = ir.executeQuery(ctx, ir.db, queryGetTraceSpans(ir.tableSpans, traceIDs...), f)
+	err = ir.executeArrowQuery(ctx, ir.db, queryGetTraceSpans(ir.tableSpans, tr, ir.maxSpansPerTrace, traceIDs...), f)
 	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
 		return nil, err
 	}
+	for traceID, spansBySpanID := range spansBySpanIDByTraceID {
+		if ir.truncateTrace(traceID, spansBySpanID) {
+			truncatedTraceIDs[traceID] = struct{}{}
+		}
+	}
 
-	// Get events
-	f = func(record map[string]interface{}) error {
-		if traceID, spanID, log, err := recordToLog(record); err != nil {
+	// Get events and links concurrently
+	var mu sync.Mutex
+	fEvents := func(batch arrow.Record) error {
+		decoder, err := newLogDecoder(batch)
+		if err != nil {
 			return err
-		} else if trace, found := spansBySpanIDByTraceID[traceID]; !found {
-			ir.logger.Warn("trace not found for log")
-		} else if span, found := trace[spanID]; !found {
-			ir.logger.Warn("span not found for log")
-		} else {
-			span.Logs = append(span.Logs, *log)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if traceID, spanID, log, err := decoder.log(row); err != nil {
+				return err
+			} else if trace, found := spansBySpanIDByTraceID[traceID]; !found {
+				ir.logger.Warn("trace not found for log")
+			} else if span, found := trace[spanID]; !found {
+				if _, truncated := truncatedTraceIDs[traceID]; !truncated {
+					ir.logger.Warn("span not found for log")
+				}
+			} else {
+				span.Logs = append(span.Logs, *log)
+			}
 		}
 		return nil
 	}
 
-	err = ir.executeQuery(ctx, ir.db, queryGetTraceEvents(ir.tableLogs, traceIDs...), f)
-	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
-		return nil, err
-	}
-
-	// Get links
-	f = func(record map[string]interface{}) error {
-		if traceID, spanID, spanRef, err := recordToSpanRef(record); err != nil {
+	fLinks := func(batch arrow.Record) error {
+		decoder, err := newSpanRefDecoder(batch)
+		if err != nil {
 			return err
-		} else if trace, found := spansBySpanIDByTraceID[traceID]; !found {
-			ir.logger.Warn("trace not found for span ref")
-		} else if span, found := trace[spanID]; !found {
-			ir.logger.Warn("span not found for span ref")
-		} else {
-			span.References = append(span.References, *spanRef)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for row := 0; row < int(batch.NumRows()); row++ {
+			if traceID, spanID, spanRef, err := decoder.spanRef(row); err != nil {
+				return err
+			} else if trace, found := spansBySpanIDByTraceID[traceID]; !found {
+				ir.logger.Warn("trace not found for span ref")
+			} else if span, found := trace[spanID]; !found {
+				if _, truncated := truncatedTraceIDs[traceID]; !truncated {
+					ir.logger.Warn("span not found for span ref")
+				}
+			} else {
+				span.References = append(span.References, *spanRef)
+			}
 		}
 		return nil
 	}
-
-	err = ir.executeQuery(ctx, ir.db, queryGetTraceLinks(ir.tableSpanLinks, traceIDs...), f)
-	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
+	err = ir.executeQueriesConcurrently(ctx,
+		recordQuery{query: queryGetTraceEvents(ir.tableLogs, tr, traceIDs...), f: fEvents},
+		recordQuery{query: queryGetTraceLinks(ir.tableSpanLinks, tr, traceIDs...), f: fLinks})
+	if err != nil {
 		return nil, err
 	}
 
+	// Assemble traces in the order of trace IDs, most recent first
 	traces := make([]*model.Trace, 0, len(spansBySpanIDByTraceID))
-	for _, spans := range spansBySpanIDByTraceID {
-		trace := &model.Trace{Spans: make([]*model.Span, 0, len(spansBySpanIDByTraceID))}
+	for _, traceID := range traceIDs {
+		spans, found := spansBySpanIDByTraceID[traceID]
+		if !found {
+			continue
+		}
+		trace := &model.Trace{Spans: make([]*model.Span, 0, len(spans))}
 		for _, span := range spans {
 			trace.Spans = append(trace.Spans, span)
 		}
@@ -202,6 +456,39 @@ func (ir *influxdbReader) FindTraces(ctx context.Context, traceQueryParameters *
 	return traces, nil
 }
 
+// recordQuery is a query and its record batch handler.
+type recordQuery struct {
+	query string
+	f     func(batch arrow.Record) error
+}
+
+// executeQueriesConcurrently executes queries, at most queryParallelism at a time, and returns the first error.
+// Record batch handlers of different queries may be called concurrently.
+func (ir *influxdbReader) executeQueriesConcurrently(ctx context.Context, queries ...recordQuery) error {
+	g, ctx := errgroup.WithContext(ctx)
+	if ir.queryParallelism > 0 {
+		g.SetLimit(ir.queryParallelism)
+	}
+	for _, q := range queries {
+		g.Go(func() error {
+			err := ir.executeArrowQuery(ctx, ir.db, q.query, q.f)
+			if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
+				return err
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// withQueryTimeout bounds an operation of several queries by the query timeout.
+func (ir *influxdbReader) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ir.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ir.queryTimeout)
+}
+
 func (ir *influxdbReader) FindTraceIDs(ctx context.Context, traceQueryParameters *spanstore.TraceQueryParameters) ([]model.TraceID, error) {
 	var traceIDs []model.TraceID
 	f := func(record map[string]interface{}) error {
@@ -215,19 +502,87 @@ func (ir *influxdbReader) FindTraceIDs(ctx context.Context, traceQueryParameters
 		return nil
 	}
 
-	err := ir.executeQuery(ctx, ir.db, queryFindTraceIDs(ir.tableSpans, traceQueryParameters), f)
+	columns, err := ir.getColumns(ctx, ir.tableSpans)
+	if err != nil {
+		return nil, err
+	}
+	isColumn := func(column string) bool {
+		if columns == nil { // unknown schema
+			return true
+		}
+		_, found := columns[column]
+		return found
+	}
+
+	// Jaeger UI sends zero when the limit is not set
+	tqp := *traceQueryParameters
+	if tqp.NumTraces <= 0 {
+		tqp.NumTraces = defaultNumTraces
+	} else if tqp.NumTraces > ir.maxTraces {
+		tqp.NumTraces = ir.maxTraces
+	}
+
+	err = ir.executeQuery(ctx, ir.db, queryFindTraceIDs(ir.tableSpans, &tqp, isColumn), f)
 	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
 		return nil, err
 	}
 	return traceIDs, nil
 }
 
+// getColumns returns the column names of table.
+// If the table does not exist, the result is empty; if the schema is not available, the result is nil.
+func (ir *influxdbReader) getColumns(ctx context.Context, table string) (map[string]struct{}, error) {
+	columns, err := ir.metadataCache.getOrLoad("columns "+table, func() (interface{}, error) {
+		columns := make(map[string]struct{})
+		f := func(record map[string]interface{}) error {
+			if v, found := record["column_name"]; found && v != nil {
+				columns[v.(string)] = struct{}{}
+			}
+			return nil
+		}
+		if err := ir.executeQuery(ctx, ir.db, queryGetColumns(table), f); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			ir.logger.Warn("failed to get table columns; tags will only match columns", zap.String("table", table), zap.Error(err))
+			return map[string]struct{}(nil), nil
+		}
+		return columns, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return columns.(map[string]struct{}), nil
+}
+
 type influxdbDependencyReader struct {
 	logger *zap.Logger
 	ir     *influxdbReader
 }
 
 func (idr *influxdbDependencyReader) GetDependencies(ctx context.Context, endTs time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	ir := idr.ir
+	cacheKey := fmt.Sprintf("dependencies %d %d", endTs.Truncate(ir.metadataCache.ttl).UnixNano(), lookback)
+	dependencyLinks, err := ir.metadataCache.getOrLoad(cacheKey, func() (interface{}, error) {
+		if ir.metadataSource != metadataSourceSpans {
+			dependencyLinks, err := idr.getDependencies(ctx, queryGetDependencies(endTs, lookback))
+			if err != nil || len(dependencyLinks) > 0 || ir.metadataSource == metadataSourceConnectors {
+				return dependencyLinks, err
+			}
+		}
+		// Joining spans is expensive, so limit the time window
+		if lookback > ir.metadataSpansLookback {
+			lookback = ir.metadataSpansLookback
+		}
+		return idr.getDependencies(ctx, queryGetDependenciesFromSpans(ir.tableSpans, endTs, lookback))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dependencyLinks.([]model.DependencyLink), nil
+}
+
+func (idr *influxdbDependencyReader) getDependencies(ctx context.Context, query string) ([]model.DependencyLink, error) {
 	var dependencyLinks []model.DependencyLink
 
 	f := func(record map[string]interface{}) error {
@@ -262,9 +617,64 @@ func (idr *influxdbDependencyReader) GetDependencies(ctx context.Context, endTs
 		return nil
 	}
 
-	err := idr.ir.executeQuery(ctx, idr.ir.db, queryGetDependencies(endTs, lookback), f)
+	err := idr.ir.executeQuery(ctx, idr.ir.db, query, f)
 	if err != nil && !isTableNotFound(err) { // ignore table not found (schema-on-write)
 		return nil, err
 	}
 	return dependencyLinks, nil
 }
+
+const (
+	metadataSourceAuto       = "auto"
+	metadataSourceConnectors = "connectors"
+	metadataSourceSpans      = "spans"
+)
+
+// metadataCache caches services, operations and dependency links for a short time,
+// because Jaeger UI requests them often, and deriving them from spans is expensive.
+type metadataCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type metadataCacheEntry struct {
+	expires time.Time
+	value   interface{}
+}
+
+// newMetadataCache returns a cache with entries that expire after ttl.
+// If ttl is not positive, then nothing is cached.
+func newMetadataCache(ttl time.Duration) *metadataCache {
+	return &metadataCache{
+		ttl:   ttl,
+		cache: lru.New(1000),
+	}
+}
+
+func (mc *metadataCache) getOrLoad(key string, load func() (interface{}, error)) (interface{}, error) {
+	if mc.ttl <= 0 {
+		return load()
+	}
+
+	mc.mu.Lock()
+	if v, found := mc.cache.Get(key); found {
+		if entry := v.(metadataCacheEntry); time.Now().Before(entry.expires) {
+			mc.mu.Unlock()
+			return entry.value, nil
+		}
+		mc.cache.Remove(key)
+	}
+	mc.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	mc.mu.Lock()
+	mc.cache.Add(key, metadataCacheEntry{expires: time.Now().Add(mc.ttl), value: value})
+	mc.mu.Unlock()
+	return value, nil
+}
@@ -0,0 +1,522 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// arrowQueryFromMaps adapts a fake executeQuery to executeArrowQuery, with all records in one record batch.
+// Column types are those of the first non-nil value of each column.
+func arrowQueryFromMaps(executeQuery func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error) func(ctx context.Context, db *adbcDB, query string, f func(batch arrow.Record) error) error {
+	return func(ctx context.Context, db *adbcDB, query string, f func(batch arrow.Record) error) error {
+		var records []map[string]interface{}
+		err := executeQuery(ctx, db, query, func(record map[string]interface{}) error {
+			records = append(records, maps.Clone(record))
+			return nil
+		})
+		if err != nil || len(records) == 0 {
+			return err
+		}
+		batch := newTestRecordBatch(records)
+		defer batch.Release()
+		return f(batch)
+	}
+}
+
+func newTestRecordBatch(records []map[string]interface{}) arrow.Record {
+	dataTypes := make(map[string]arrow.DataType)
+	for _, record := range records {
+		for k, v := range record {
+			if _, found := dataTypes[k]; found || v == nil {
+				continue
+			}
+			switch v.(type) {
+			case time.Time:
+				dataTypes[k] = arrow.FixedWidthTypes.Timestamp_ns
+			case string:
+				dataTypes[k] = arrow.BinaryTypes.String
+			case int64:
+				dataTypes[k] = arrow.PrimitiveTypes.Int64
+			case uint64:
+				dataTypes[k] = arrow.PrimitiveTypes.Uint64
+			case float64:
+				dataTypes[k] = arrow.PrimitiveTypes.Float64
+			case bool:
+				dataTypes[k] = arrow.FixedWidthTypes.Boolean
+			default:
+				panic(fmt.Sprintf("unsupported type %T", v))
+			}
+		}
+	}
+	var fields []arrow.Field
+	for k, dataType := range dataTypes {
+		fields = append(fields, arrow.Field{Name: k, Type: dataType, Nullable: true})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(fields, nil))
+	defer builder.Release()
+	for _, record := range records {
+		for i, field := range fields {
+			v := record[field.Name]
+			if v == nil {
+				builder.Field(i).AppendNull()
+				continue
+			}
+			switch b := builder.Field(i).(type) {
+			case *array.TimestampBuilder:
+				b.Append(arrow.Timestamp(v.(time.Time).UnixNano()))
+			case *array.StringBuilder:
+				b.Append(v.(string))
+			case *array.Int64Builder:
+				b.Append(v.(int64))
+			case *array.Uint64Builder:
+				b.Append(v.(uint64))
+			case *array.Float64Builder:
+				b.Append(v.(float64))
+			case *array.BooleanBuilder:
+				b.Append(v.(bool))
+			}
+		}
+	}
+	return builder.NewRecord()
+}
+
+// newTestMetadataReader returns a reader of tables with the given records, and a log of the tables queried.
+func newTestMetadataReader(metadataSource string, cacheTTL time.Duration, recordsByTable map[string][]map[string]interface{}) (*influxdbDependencyReader, *[]string) {
+	var queriedTables []string
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			for _, table := range []string{tableSpanMetricsCalls, tableServiceGraphRequestCount, tableSpans} {
+				if strings.Contains(query, quoteIdentifier(table)) {
+					queriedTables = append(queriedTables, table)
+					for _, record := range recordsByTable[table] {
+						if err := f(record); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+			}
+			panic("unexpected query " + query)
+		},
+		tableSpans:            tableSpans,
+		metadataSource:        metadataSource,
+		metadataSpansLookback: time.Hour,
+		metadataCache:         newMetadataCache(cacheTTL),
+	}
+	return &influxdbDependencyReader{logger: zap.NewNop(), ir: ir}, &queriedTables
+}
+
+func TestInfluxdbReader_metadataSource(t *testing.T) {
+	connectorRecords := map[string][]map[string]interface{}{
+		tableSpanMetricsCalls:         {{"service.name": "connector-service", "span.name": "GET /", "span.kind": "SPAN_KIND_SERVER"}},
+		tableServiceGraphRequestCount: {{"client": "connector-a", "server": "connector-b", "value_cumulative_monotonic_int": int64(3)}},
+	}
+	spansRecords := map[string][]map[string]interface{}{
+		tableSpans: {{"service.name": "spans-service", "span.name": "GET /", "span.kind": "Server", "client": "spans-a", "server": "spans-b", "value_cumulative_monotonic_int": int64(5)}},
+	}
+	allRecords := map[string][]map[string]interface{}{}
+	for _, records := range []map[string][]map[string]interface{}{connectorRecords, spansRecords} {
+		for table, r := range records {
+			allRecords[table] = r
+		}
+	}
+	ctx := context.Background()
+
+	for _, testCase := range []struct {
+		name            string
+		metadataSource  string
+		records         map[string][]map[string]interface{}
+		expectedService string
+		expectedKind    string
+		expectedParent  string
+	}{
+		{"connectors", metadataSourceConnectors, allRecords, "connector-service", "server", "connector-a"},
+		{"spans", metadataSourceSpans, allRecords, "spans-service", "server", "spans-a"},
+		{"auto with connectors", metadataSourceAuto, allRecords, "connector-service", "server", "connector-a"},
+		{"auto without connectors", metadataSourceAuto, spansRecords, "spans-service", "server", "spans-a"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			idr, _ := newTestMetadataReader(testCase.metadataSource, 0, testCase.records)
+
+			services, err := idr.ir.GetServices(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{testCase.expectedService}, services)
+
+			operations, err := idr.ir.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: testCase.expectedService})
+			require.NoError(t, err)
+			assert.Equal(t, []spanstore.Operation{{Name: "GET /", SpanKind: testCase.expectedKind}}, operations)
+
+			dependencyLinks, err := idr.GetDependencies(ctx, time.Unix(1000, 0), time.Hour)
+			require.NoError(t, err)
+			require.Len(t, dependencyLinks, 1)
+			assert.Equal(t, testCase.expectedParent, dependencyLinks[0].Parent)
+		})
+	}
+
+	t.Run("connectors without connectors", func(t *testing.T) {
+		idr, queriedTables := newTestMetadataReader(metadataSourceConnectors, 0, spansRecords)
+		services, err := idr.ir.GetServices(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, services)
+		dependencyLinks, err := idr.GetDependencies(ctx, time.Unix(1000, 0), time.Hour)
+		require.NoError(t, err)
+		assert.Empty(t, dependencyLinks)
+		assert.Equal(t, []string{tableSpanMetricsCalls, tableServiceGraphRequestCount}, *queriedTables)
+	})
+}
+
+func TestInfluxdbReader_metadataCache(t *testing.T) {
+	records := map[string][]map[string]interface{}{
+		tableSpans: {{"service.name": "my-service", "client": "a", "server": "b", "value_cumulative_monotonic_int": int64(1)}},
+	}
+	idr, queriedTables := newTestMetadataReader(metadataSourceSpans, time.Hour, records)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		services, err := idr.ir.GetServices(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"my-service"}, services)
+		dependencyLinks, err := idr.GetDependencies(ctx, time.Unix(1000, 0), time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, []model.DependencyLink{{Parent: "a", Child: "b", CallCount: 1}}, dependencyLinks)
+	}
+	assert.Len(t, *queriedTables, 2)
+
+	_, err := idr.GetDependencies(ctx, time.Unix(1000, 0), 2*time.Hour)
+	require.NoError(t, err)
+	assert.Len(t, *queriedTables, 3, "different lookback is a different cache entry")
+}
+
+func TestInfluxdbReader_FindTraceIDs(t *testing.T) {
+	var findQuery string
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			if strings.Contains(query, "information_schema.columns") {
+				for _, column := range []string{"time", "trace_id", "span_id", "service.name", "span.name", "otel.status_code", "attributes"} {
+					if err := f(map[string]interface{}{"column_name": column}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			findQuery = query
+			return f(map[string]interface{}{"trace_id": "00000000000000010000000000000002"})
+		},
+		tableSpans:    tableSpans,
+		metadataCache: newMetadataCache(time.Minute),
+	}
+
+	traceIDs, err := ir.FindTraceIDs(context.Background(), &spanstore.TraceQueryParameters{
+		ServiceName: "my-service",
+		Tags:        map[string]string{"http.status_code": "500", "error": "true"},
+		NumTraces:   20,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []model.TraceID{model.NewTraceID(1, 2)}, traceIDs)
+	assert.Contains(t, findQuery, `"service.name" = 'my-service'`)
+	assert.Contains(t, findQuery, `"otel.status_code" = 'Error'`)
+	assert.Contains(t, findQuery, `"attributes" ~ `+quoteLiteral(`(?:^\{|,)"http\.status_code":(?:"500"|500)[,}]`))
+}
+
+func TestInfluxdbReader_FindTraces(t *testing.T) {
+	var findQuery, spansQuery string
+	spanCountByTraceID := map[model.TraceID]int{
+		model.NewTraceID(0, 1): 2,
+		model.NewTraceID(0, 2): 5,
+		model.NewTraceID(0, 3): 1,
+	}
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			switch {
+			case strings.Contains(query, "information_schema.columns"), strings.Contains(query, `FROM "logs"`), strings.Contains(query, `FROM "span-links"`):
+				return nil
+			case strings.Contains(query, `MAX("time")`):
+				findQuery = query
+				for _, traceID := range []model.TraceID{model.NewTraceID(0, 3), model.NewTraceID(0, 1), model.NewTraceID(0, 2)} {
+					if err := f(map[string]interface{}{"trace_id": traceIDToString(traceID)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			case strings.Contains(query, `FROM "spans"`):
+				spansQuery = query
+				for traceID, spanCount := range spanCountByTraceID {
+					// Spans in reverse order of start time, the rank column is ignored
+					for i := spanCount; i >= 1; i-- {
+						record := map[string]interface{}{
+							"time":             time.Unix(int64(i), 0),
+							"trace_id":         traceIDToString(traceID),
+							"span_id":          model.NewSpanID(uint64(i)).String(),
+							"jaeger_span_rank": int64(i),
+						}
+						if err := f(record); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}
+			panic("unexpected query " + query)
+		},
+		tableSpans:       tableSpans,
+		tableLogs:        tableLogs,
+		tableSpanLinks:   tableSpanLinks,
+		maxTraces:        100,
+		maxSpansPerTrace: 3,
+		metadataCache:    newMetadataCache(time.Minute),
+	}
+	ir.executeArrowQuery = arrowQueryFromMaps(ir.executeQuery)
+	ctx := context.Background()
+
+	traces, err := ir.FindTraces(ctx, &spanstore.TraceQueryParameters{})
+	require.NoError(t, err)
+	require.Len(t, traces, 3)
+	for i, expected := range []struct {
+		traceID   model.TraceID
+		spanCount int
+	}{
+		{model.NewTraceID(0, 3), 1},
+		{model.NewTraceID(0, 1), 2},
+		{model.NewTraceID(0, 2), 3},
+	} {
+		require.Len(t, traces[i].Spans, expected.spanCount)
+		assert.Equal(t, expected.traceID, traces[i].Spans[0].TraceID)
+	}
+	assertTruncated(t, traces[2])
+	assert.Empty(t, traces[1].Spans[0].Warnings)
+	assert.True(t, strings.HasSuffix(findQuery, " LIMIT 20"), findQuery)
+	assert.Contains(t, spansQuery, `ROW_NUMBER() OVER (PARTITION BY "trace_id" ORDER BY "time", "span_id")`)
+	assert.True(t, strings.HasSuffix(spansQuery, ` WHERE "jaeger_span_rank" <= 4`), spansQuery, "per trace, not per query")
+
+	_, err = ir.FindTraces(ctx, &spanstore.TraceQueryParameters{NumTraces: 5000})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(findQuery, " LIMIT 100"), findQuery)
+
+	_, err = ir.FindTraces(ctx, &spanstore.TraceQueryParameters{StartTimeMin: time.Unix(7200, 0), StartTimeMax: time.Unix(10800, 0)})
+	require.NoError(t, err)
+	assert.Contains(t, spansQuery, `"time" >= to_timestamp(3600000000000) AND "time" <= to_timestamp(14400000000000)`, "search time range, padded")
+
+	trace, err := ir.GetTrace(ctx, model.NewTraceID(0, 2))
+	require.NoError(t, err)
+	assertTruncated(t, trace)
+	assert.True(t, strings.HasSuffix(spansQuery, ` WHERE "jaeger_span_rank" <= 4`), spansQuery)
+}
+
+// assertTruncated asserts that a trace of 5 spans is truncated to the earliest 3, with a warning on the earliest.
+func assertTruncated(t *testing.T, trace *model.Trace) {
+	t.Helper()
+	var spanIDs []model.SpanID
+	for _, span := range trace.Spans {
+		spanIDs = append(spanIDs, span.SpanID)
+		if span.SpanID == 1 {
+			assert.Equal(t, []string{"trace has more than 3 spans; only the earliest 3 spans are shown"}, span.Warnings)
+		} else {
+			assert.Empty(t, span.Warnings)
+		}
+	}
+	assert.ElementsMatch(t, []model.SpanID{1, 2, 3}, spanIDs)
+}
+
+func TestInfluxdbReader_GetOperations_spanKind(t *testing.T) {
+	records := map[string][]map[string]interface{}{
+		tableSpanMetricsCalls: {
+			{"service.name": "my-service", "span.name": "GET /", "span.kind": "SPAN_KIND_SERVER"},
+			{"service.name": "my-service", "span.name": "SELECT", "span.kind": "SPAN_KIND_CLIENT"},
+		},
+	}
+	idr, queriedTables := newTestMetadataReader(metadataSourceAuto, time.Minute, records)
+	ctx := context.Background()
+
+	operations, err := idr.ir.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "my-service"})
+	require.NoError(t, err)
+	assert.Equal(t, []spanstore.Operation{{Name: "GET /", SpanKind: "server"}, {Name: "SELECT", SpanKind: "client"}}, operations)
+
+	operations, err = idr.ir.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "my-service", SpanKind: "client"})
+	require.NoError(t, err)
+	assert.Equal(t, []spanstore.Operation{{Name: "SELECT", SpanKind: "client"}}, operations)
+
+	operations, err = idr.ir.GetOperations(ctx, spanstore.OperationQueryParameters{ServiceName: "my-service", SpanKind: "consumer"})
+	require.NoError(t, err)
+	assert.Empty(t, operations)
+
+	assert.Len(t, *queriedTables, 1, "span kind is filtered after the cache")
+}
+
+func TestInfluxdbReader_traceLookbacks(t *testing.T) {
+	for _, testCase := range []struct {
+		lookback, maxLookback time.Duration
+		expected              []time.Duration
+	}{
+		{0, 0, []time.Duration{0}},
+		{time.Hour, 0, []time.Duration{time.Hour, 8 * time.Hour, 0}},
+		{time.Hour, 24 * time.Hour, []time.Duration{time.Hour, 8 * time.Hour, 24 * time.Hour}},
+		{time.Hour, 4 * time.Hour, []time.Duration{time.Hour, 4 * time.Hour}},
+		{time.Hour, time.Hour, []time.Duration{time.Hour}},
+	} {
+		ir := &influxdbReader{traceLookback: testCase.lookback, traceMaxLookback: testCase.maxLookback}
+		assert.Equal(t, testCase.expected, ir.traceLookbacks(), "lookback %s max %s", testCase.lookback, testCase.maxLookback)
+	}
+}
+
+func TestInfluxdbReader_GetTrace_widening(t *testing.T) {
+	var spansQueries []string
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			if !strings.Contains(query, `FROM "spans"`) {
+				return nil
+			}
+			spansQueries = append(spansQueries, query)
+			if strings.Contains(query, `"time" >=`) {
+				return nil
+			}
+			return f(map[string]interface{}{"time": time.Unix(1, 0), "trace_id": traceIDToString(model.NewTraceID(0, 1)), "span_id": "0000000000000001"})
+		},
+		tableSpans:       tableSpans,
+		tableLogs:        tableLogs,
+		tableSpanLinks:   tableSpanLinks,
+		maxSpansPerTrace: 10,
+		traceLookback:    time.Hour,
+	}
+	ir.executeArrowQuery = arrowQueryFromMaps(ir.executeQuery)
+
+	trace, err := ir.GetTrace(context.Background(), model.NewTraceID(0, 1))
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+	require.Len(t, spansQueries, 3)
+	assert.Contains(t, spansQueries[0], `"time" >= to_timestamp(`)
+	assert.Contains(t, spansQueries[1], `"time" >= to_timestamp(`)
+	assert.NotContains(t, spansQueries[2], `"time" >=`)
+
+	ir.traceMaxLookback = 24 * time.Hour
+	spansQueries = nil
+	_, err = ir.GetTrace(context.Background(), model.NewTraceID(0, 1))
+	assert.ErrorIs(t, err, spanstore.ErrTraceNotFound)
+	assert.Len(t, spansQueries, 3)
+}
+
+func TestInfluxdbReader_GetTrace_incomplete(t *testing.T) {
+	traceID := model.NewTraceID(0, 1)
+	var spansQueries []string
+	var narrowSpans []map[string]interface{}
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			if !strings.Contains(query, `FROM "spans"`) {
+				return nil
+			}
+			spansQueries = append(spansQueries, query)
+			spans := narrowSpans
+			if len(spansQueries) > 1 {
+				// The root span is older than the first lookback
+				spans = append(spans, map[string]interface{}{"time": time.Now().Add(-2 * time.Hour), "trace_id": traceIDToString(traceID), "span_id": "0000000000000001"})
+			}
+			for _, span := range spans {
+				if err := f(span); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		tableSpans:       tableSpans,
+		tableLogs:        tableLogs,
+		tableSpanLinks:   tableSpanLinks,
+		maxSpansPerTrace: 10,
+		traceLookback:    time.Hour,
+	}
+	ir.executeArrowQuery = arrowQueryFromMaps(ir.executeQuery)
+	ctx := context.Background()
+
+	for _, testCase := range []struct {
+		name          string
+		span          map[string]interface{}
+		expectedSpans int
+		expectedScans int
+	}{
+		{"complete", map[string]interface{}{"time": time.Now().Add(-time.Minute), "trace_id": traceIDToString(traceID), "span_id": "0000000000000002"}, 1, 1},
+		{"no root span", map[string]interface{}{"time": time.Now().Add(-time.Minute), "trace_id": traceIDToString(traceID), "span_id": "0000000000000002", "parent_span_id": "0000000000000001"}, 2, 2},
+		{"span at the edge", map[string]interface{}{"time": time.Now().Add(-time.Hour + time.Second), "trace_id": traceIDToString(traceID), "span_id": "0000000000000002"}, 2, 2},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			spansQueries, narrowSpans = nil, []map[string]interface{}{testCase.span}
+			trace, err := ir.GetTrace(ctx, traceID)
+			require.NoError(t, err)
+			assert.Len(t, trace.Spans, testCase.expectedSpans)
+			assert.Len(t, spansQueries, testCase.expectedScans)
+		})
+	}
+
+	// An incomplete trace is returned after the last scan
+	ir.traceMaxLookback = time.Hour
+	spansQueries, narrowSpans = nil, []map[string]interface{}{{"time": time.Now().Add(-time.Minute), "trace_id": traceIDToString(traceID), "span_id": "0000000000000002", "parent_span_id": "0000000000000001"}}
+	trace, err := ir.GetTrace(ctx, traceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+	assert.Len(t, spansQueries, 1)
+}
+
+func TestInfluxdbReader_GetTrace_concurrent(t *testing.T) {
+	traceID := model.NewTraceID(0, 1)
+	linksStarted := make(chan struct{})
+	linksBlock := false
+	ir := &influxdbReader{
+		logger: zap.NewNop(),
+		executeQuery: func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error {
+			switch {
+			case strings.Contains(query, `FROM "spans"`):
+				return f(map[string]interface{}{"time": time.Unix(1, 0), "trace_id": traceIDToString(traceID), "span_id": "0000000000000001"})
+			case strings.Contains(query, `FROM "logs"`):
+				// Completes only if the links query runs concurrently
+				select {
+				case <-linksStarted:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			case strings.Contains(query, `FROM "span-links"`):
+				if linksBlock {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				close(linksStarted)
+				return nil
+			}
+			panic("unexpected query " + query)
+		},
+		tableSpans:       tableSpans,
+		tableLogs:        tableLogs,
+		tableSpanLinks:   tableSpanLinks,
+		maxSpansPerTrace: 10,
+		queryTimeout:     5 * time.Second,
+		queryParallelism: 2,
+	}
+	ir.executeArrowQuery = arrowQueryFromMaps(ir.executeQuery)
+
+	trace, err := ir.GetTrace(context.Background(), traceID)
+	require.NoError(t, err)
+	assert.Len(t, trace.Spans, 1)
+
+	linksBlock = true
+	ir.queryTimeout = 50 * time.Millisecond
+	_, err = ir.GetTrace(context.Background(), traceID)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "timeout applies to the whole operation")
+}
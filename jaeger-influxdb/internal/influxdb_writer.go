@@ -3,11 +3,11 @@ package internal
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,34 +15,321 @@ import (
 	"github.com/influxdata/line-protocol/v2/lineprotocol"
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 
 	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/otel2influx"
 )
 
-var _ spanstore.Writer = (*influxdbWriterNoop)(nil)
+var _ spanstore.Writer = (*influxdbWriterPrimary)(nil)
+var _ otel2influx.InfluxWriter = (*influxdbWriterPrimary)(nil)
 var _ spanstore.Writer = (*influxdbWriterArchive)(nil)
 
-type influxdbWriterNoop struct {
-	logger *zap.Logger
+var errWriterClosed = errors.New("span writer is closed")
+
+const (
+	writeMaxAttempts  = 3
+	writeRetryBackoff = time.Second
+)
+
+// influxdbWriterPrimary converts Jaeger spans to line protocol with otel2influx,
+// and writes them to InfluxDB in batches.
+// A batch is written when it reaches batchSize lines, or flushInterval after the previous write.
+// When a full batch fails to be written, the error is returned by the WriteSpan call that filled the batch.
+// When a batch written at the flush interval fails, its lines are counted, and reported by Close.
+// Writes of full batches are bound to the context of WriteSpan; other writes are bound to the writer,
+// and are canceled when Close times out.
+type influxdbWriterPrimary struct {
+	logger     *zap.Logger
+	converter  *otel2influx.OtelTracesToLineProtocol
+	httpClient *http.Client
+	writeURL   string
+	authToken  string
+
+	batchSize     int
+	flushInterval time.Duration
+	retryBackoff  time.Duration
+
+	bufMu     sync.Mutex
+	buf       []byte
+	bufLines  int
+	bufClosed bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	queue   chan *writeRequest
+	closing chan struct{}
+	done    chan struct{}
+
+	failedMu    sync.Mutex
+	failedLines int
+	failedErr   error
+}
+
+type writeRequest struct {
+	ctx    context.Context
+	body   []byte
+	result chan error
+}
+
+func newInfluxdbWriterPrimary(logger *zap.Logger, httpClient *http.Client, writeURL, authToken string, batchSize int, flushInterval time.Duration) (*influxdbWriterPrimary, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("influxdb-write-batch-size must be positive, got %d", batchSize)
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("influxdb-write-flush-interval must be positive, got %s", flushInterval)
+	}
+	w := &influxdbWriterPrimary{
+		logger:        logger,
+		httpClient:    httpClient,
+		writeURL:      writeURL,
+		authToken:     authToken,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		retryBackoff:  writeRetryBackoff,
+		queue:         make(chan *writeRequest),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	tracesConfig := otel2influx.DefaultOtelTracesToLineProtocolConfig()
+	tracesConfig.Logger = CommonLogger(logger)
+	tracesConfig.Writer = w
+	var err error
+	if w.converter, err = otel2influx.NewOtelTracesToLineProtocol(tracesConfig); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+func (iwp *influxdbWriterPrimary) WriteSpan(ctx context.Context, span *model.Span) error {
+	return iwp.converter.WriteTraces(ctx, spanToTraces(span))
+}
+
+// run writes full batches as they are queued, and partial batches when the flush interval elapses,
+// until Close is called.
+func (iwp *influxdbWriterPrimary) run() {
+	defer close(iwp.done)
+	ticker := time.NewTicker(iwp.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-iwp.closing:
+			return
+		case req := <-iwp.queue:
+			req.result <- iwp.write(req.ctx, req.body)
+		case <-ticker.C:
+			iwp.bufMu.Lock()
+			body, lines := iwp.takeBufLocked()
+			iwp.bufMu.Unlock()
+			if body == nil {
+				continue
+			}
+			if err := iwp.write(iwp.ctx, body); err != nil {
+				iwp.logger.Error("failed to write spans to InfluxDB; batch dropped", zap.Int("lines", lines), zap.Error(err))
+				iwp.failedMu.Lock()
+				iwp.failedLines += lines
+				iwp.failedErr = err
+				iwp.failedMu.Unlock()
+			}
+		}
+	}
+}
+
+func (iwp *influxdbWriterPrimary) takeBufLocked() ([]byte, int) {
+	if len(iwp.buf) == 0 {
+		return nil, 0
+	}
+	body, lines := iwp.buf, iwp.bufLines
+	iwp.buf = nil
+	iwp.bufLines = 0
+	return body, lines
+}
+
+// enqueue blocks until the batch is taken for writing, which limits the rate of WriteSpan to the rate of writes,
+// or until ctx is done or the writer is closed.
+// The write error is sent to the returned channel.
+func (iwp *influxdbWriterPrimary) enqueue(ctx context.Context, body []byte) (<-chan error, error) {
+	req := &writeRequest{ctx: ctx, body: body, result: make(chan error, 1)}
+	select {
+	case iwp.queue <- req:
+		return req.result, nil
+	case <-iwp.closing:
+		return nil, errWriterClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
-func (iwn *influxdbWriterNoop) WriteSpan(_ context.Context, _ *model.Span) error {
-	iwn.logger.Debug("no-op WriteSpan called")
-	return errors.New("WriteSpan is not implemented in this context")
+// write retries failed writes that may succeed later, such as after status 429 or 503, until ctx is done.
+func (iwp *influxdbWriterPrimary) write(ctx context.Context, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= writeMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(iwp.retryBackoff * time.Duration(attempt-1)):
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %w", ctx.Err(), err)
+			}
+		}
+		var retryable bool
+		if retryable, err = iwp.writeOnce(ctx, body); err == nil || !retryable || ctx.Err() != nil {
+			return err
+		}
+		iwp.logger.Debug("retrying write to InfluxDB", zap.Int("attempt", attempt), zap.Error(err))
+	}
+	return err
+}
+
+func (iwp *influxdbWriterPrimary) writeOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, iwp.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", iwp.authToken))
+	res, err := iwp.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	retryable := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retryable, fmt.Errorf("line protocol write returned %q %q", res.Status, string(resBody))
+}
+
+// Close writes buffered spans, then stops the writer.
+// Close waits up to timeout in all, for the final write and for the write in progress, if any;
+// writes still in progress after timeout are canceled.
+// The returned error includes the final write error, and the count of lines dropped by earlier flushes.
+func (iwp *influxdbWriterPrimary) Close(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	iwp.bufMu.Lock()
+	iwp.bufClosed = true
+	body, _ := iwp.takeBufLocked()
+	select {
+	case <-iwp.closing:
+	default:
+		// Writers waiting in enqueue return errWriterClosed
+		close(iwp.closing)
+	}
+	iwp.bufMu.Unlock()
+
+	var err error
+	if body != nil {
+		err = iwp.write(ctx, body)
+	}
+	select {
+	case <-iwp.done:
+	case <-ctx.Done():
+		err = multierr.Append(err, errors.New("timed out waiting for span writes to InfluxDB"))
+	}
+	iwp.cancel()
+
+	iwp.failedMu.Lock()
+	defer iwp.failedMu.Unlock()
+	if iwp.failedLines > 0 {
+		err = multierr.Append(err, fmt.Errorf("%d lines of spans were not written to InfluxDB: %w", iwp.failedLines, iwp.failedErr))
+	}
+	return err
+}
+
+func (iwp *influxdbWriterPrimary) NewBatch() otel2influx.InfluxWriterBatch {
+	encoder := new(lineprotocol.Encoder)
+	encoder.SetLax(true)
+	encoder.SetPrecision(lineprotocol.Nanosecond)
+	return &influxdbWriterPrimaryBatch{
+		iwp:     iwp,
+		encoder: encoder,
+	}
+}
+
+type influxdbWriterPrimaryBatch struct {
+	iwp     *influxdbWriterPrimary
+	encoder *lineprotocol.Encoder
+	lines   int
+}
+
+func (b *influxdbWriterPrimaryBatch) EnqueuePoint(_ context.Context, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time, _ common.InfluxMetricValueType) error {
+	lineStart := len(b.encoder.Bytes())
+	b.encoder.StartLine(measurement)
+	for _, k := range sortedKeys(tags) {
+		b.encoder.AddTag(k, tags[k])
+	}
+	for _, k := range sortedKeys(fields) {
+		if fieldValue, ok := lineprotocol.NewValue(fields[k]); ok {
+			b.encoder.AddField(k, fieldValue)
+		} else {
+			b.iwp.logger.Sugar().Warnf("failed to cast field %s (%T) to line protocol field value", k, fields[k])
+		}
+	}
+	b.encoder.EndLine(ts)
+	if err := b.encoder.Err(); err != nil {
+		// discard the partial line
+		b.encoder.SetBuffer(b.encoder.Bytes()[:lineStart])
+		return fmt.Errorf("failed to encode point as line protocol: %w", err)
+	}
+	b.lines++
+	return nil
+}
+
+// WriteBatch adds the lines of the batch to the buffer of the writer.
+// When the buffer reaches the batch size, WriteBatch waits for it to be written, and returns the write error,
+// or the error of ctx if it is done first.
+func (b *influxdbWriterPrimaryBatch) WriteBatch(ctx context.Context) error {
+	if b.lines == 0 {
+		return nil
+	}
+	iwp := b.iwp
+	iwp.bufMu.Lock()
+	if iwp.bufClosed {
+		iwp.bufMu.Unlock()
+		return errWriterClosed
+	}
+	iwp.buf = append(iwp.buf, b.encoder.Bytes()...)
+	iwp.bufLines += b.lines
+	var body []byte
+	if iwp.bufLines >= iwp.batchSize {
+		body, _ = iwp.takeBufLocked()
+	}
+	iwp.bufMu.Unlock()
+
+	b.encoder.Reset()
+	b.lines = 0
+	if body == nil {
+		return nil
+	}
+	result, err := iwp.enqueue(ctx, body)
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 type influxdbWriterArchive struct {
 	logger *zap.Logger
 
-	executeQuery func(ctx context.Context, db *sql.DB, query string, f func(record map[string]interface{}) error) error
+	executeQuery func(ctx context.Context, db *adbcDB, query string, f func(record map[string]interface{}) error) error
 
 	recentTraces   *lru.Cache
 	recentTracesMu sync.Mutex
 	httpClient     *http.Client
 	authToken      string
 
-	dbSrc                                                         *sql.DB
+	dbSrc                                                         *adbcDB
 	bucketNameSrc, tableSpansSrc, tableLogsSrc, tableSpanLinksSrc string
 
 	writeURLArchive                                                               string
@@ -64,7 +351,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 
 	// trace spans
 
-	err := iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceSpans(iwa.tableSpansSrc, span.TraceID),
+	err := iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceSpans(iwa.tableSpansSrc, timeRange{}, 0, span.TraceID),
 		func(row map[string]interface{}) error {
 			lpEncoder.StartLine(iwa.tableSpansArchive)
 			var tagCount int
@@ -73,7 +360,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					lpEncoder.AddTag(k, stringValue)
 					tagCount++
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type string but got %T", k, row[k])
+					iwa.logger.Sugar().Warnf("expected column %s to have type string but got %T", k, row[k])
 				}
 			}
 			if tagCount != 2 {
@@ -90,7 +377,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					if fieldValue, ok := lineprotocol.NewValue(v); ok {
 						lpEncoder.AddField(k, fieldValue)
 					} else {
-						iwa.logger.Sugar().Warn("failed to cast column %s (%T) to line protocol field value", k, v)
+						iwa.logger.Sugar().Warnf("failed to cast column %s (%T) to line protocol field value", k, v)
 					}
 				}
 			}
@@ -100,7 +387,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					foundTime = true
 					lpEncoder.EndLine(timeValue)
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type time but got %T", common.AttributeTime, v)
+					iwa.logger.Sugar().Warnf("expected column %s to have type time but got %T", common.AttributeTime, v)
 				}
 			}
 			if !foundTime {
@@ -114,7 +401,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 
 	// trace events
 
-	err = iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceEvents(iwa.tableLogsSrc, span.TraceID),
+	err = iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceEvents(iwa.tableLogsSrc, timeRange{}, span.TraceID),
 		func(row map[string]interface{}) error {
 			lpEncoder.StartLine(iwa.tableLogsArchive)
 			var tagCount int
@@ -123,7 +410,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					lpEncoder.AddTag(k, stringValue)
 					tagCount++
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type string but got %T", k, row[k])
+					iwa.logger.Sugar().Warnf("expected column %s to have type string but got %T", k, row[k])
 				}
 			}
 			if tagCount != 2 {
@@ -140,7 +427,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					if fieldValue, ok := lineprotocol.NewValue(v); ok {
 						lpEncoder.AddField(k, fieldValue)
 					} else {
-						iwa.logger.Sugar().Warn("failed to cast column %s (%T) to line protocol field value", k, v)
+						iwa.logger.Sugar().Warnf("failed to cast column %s (%T) to line protocol field value", k, v)
 					}
 				}
 			}
@@ -150,7 +437,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					foundTime = true
 					lpEncoder.EndLine(timeValue)
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type time but got %T", common.AttributeTime, v)
+					iwa.logger.Sugar().Warnf("expected column %s to have type time but got %T", common.AttributeTime, v)
 				}
 			}
 			if !foundTime {
@@ -164,7 +451,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 
 	// trace span links
 
-	err = iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceLinks(iwa.tableSpanLinksSrc, span.TraceID),
+	err = iwa.executeQuery(ctx, iwa.dbSrc, queryGetTraceLinks(iwa.tableSpanLinksSrc, timeRange{}, span.TraceID),
 		func(row map[string]interface{}) error {
 			lpEncoder.StartLine(iwa.tableSpanLinksArchive)
 			var tagCount int
@@ -173,7 +460,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					lpEncoder.AddTag(k, stringValue)
 					tagCount++
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type string but got %T", k, row[k])
+					iwa.logger.Sugar().Warnf("expected column %s to have type string but got %T", k, row[k])
 				}
 			}
 			if tagCount != 4 {
@@ -190,7 +477,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					if fieldValue, ok := lineprotocol.NewValue(v); ok {
 						lpEncoder.AddField(k, fieldValue)
 					} else {
-						iwa.logger.Sugar().Warn("failed to cast column %s (%T) to line protocol field value", k, v)
+						iwa.logger.Sugar().Warnf("failed to cast column %s (%T) to line protocol field value", k, v)
 					}
 				}
 			}
@@ -200,7 +487,7 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 					foundTime = true
 					lpEncoder.EndLine(timeValue)
 				} else {
-					iwa.logger.Sugar().Warn("expected column %s to have type time but got %T", common.AttributeTime, v)
+					iwa.logger.Sugar().Warnf("expected column %s to have type time but got %T", common.AttributeTime, v)
 				}
 			}
 			if !foundTime {
@@ -233,3 +520,12 @@ func (iwa *influxdbWriterArchive) WriteSpan(ctx context.Context, span *model.Spa
 
 	return nil
 }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
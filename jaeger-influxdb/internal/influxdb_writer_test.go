@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+)
+
+func newTestSpan(spanID model.SpanID) *model.Span {
+	traceID := model.NewTraceID(0x0102030405060708, 0x090a0b0c0d0e0f10)
+	return &model.Span{
+		TraceID:       traceID,
+		SpanID:        spanID,
+		OperationName: "GET /",
+		References: []model.SpanRef{
+			model.NewChildOfRef(traceID, 0x0a),
+			model.NewFollowsFromRef(model.NewTraceID(0, 0x0b), 0x0c),
+		},
+		StartTime: time.Unix(1, 0),
+		Duration:  time.Second,
+		Tags: []model.KeyValue{
+			model.String("span.kind", "server"),
+			model.Bool("error", true),
+			model.Int64("http.status_code", 500),
+			model.String("otel.scope.name", "my-scope"),
+		},
+		Logs: []model.Log{{
+			Timestamp: time.Unix(1, 5e8),
+			Fields:    []model.KeyValue{model.String("event", "exception"), model.String("exception.message", "oops")},
+		}},
+		Process: model.NewProcess("my-service", []model.KeyValue{model.String("host.name", "my-host")}),
+	}
+}
+
+func TestSpanToTraces(t *testing.T) {
+	traces := spanToTraces(newTestSpan(0x01))
+
+	require.Equal(t, 1, traces.SpanCount())
+	resourceSpans := traces.ResourceSpans().At(0)
+	assert.Equal(t, map[string]interface{}{"service.name": "my-service", "host.name": "my-host"}, resourceSpans.Resource().Attributes().AsRaw())
+	scopeSpans := resourceSpans.ScopeSpans().At(0)
+	assert.Equal(t, "my-scope", scopeSpans.Scope().Name())
+
+	span := scopeSpans.Spans().At(0)
+	assert.Equal(t, pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, span.TraceID())
+	assert.Equal(t, pcommon.SpanID{0, 0, 0, 0, 0, 0, 0, 1}, span.SpanID())
+	assert.Equal(t, pcommon.SpanID{0, 0, 0, 0, 0, 0, 0, 0x0a}, span.ParentSpanID())
+	assert.Equal(t, "GET /", span.Name())
+	assert.Equal(t, ptrace.SpanKindServer, span.Kind())
+	assert.Equal(t, ptrace.StatusCodeError, span.Status().Code())
+	assert.Equal(t, time.Unix(1, 0).UnixNano(), span.StartTimestamp().AsTime().UnixNano())
+	assert.Equal(t, time.Unix(2, 0).UnixNano(), span.EndTimestamp().AsTime().UnixNano())
+	assert.Equal(t, map[string]interface{}{"http.status_code": int64(500)}, span.Attributes().AsRaw())
+
+	require.Equal(t, 1, span.Events().Len())
+	assert.Equal(t, "exception", span.Events().At(0).Name())
+	assert.Equal(t, map[string]interface{}{"exception.message": "oops"}, span.Events().At(0).Attributes().AsRaw())
+
+	require.Equal(t, 1, span.Links().Len())
+	assert.Equal(t, pcommon.TraceID{15: 0x0b}, span.Links().At(0).TraceID())
+	assert.Equal(t, pcommon.SpanID{7: 0x0c}, span.Links().At(0).SpanID())
+	assert.Equal(t, map[string]interface{}{"opentracing.ref_type": "follows_from"}, span.Links().At(0).Attributes().AsRaw())
+}
+
+func TestInfluxdbWriterPrimary(t *testing.T) {
+	written := make(chan string, 10)
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token my-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		written <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxdb.Close()
+
+	// Each test span is three lines: the span, one event, and one link.
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 5, time.Hour)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, writer.WriteSpan(ctx, newTestSpan(0x01)))
+	assert.Empty(t, written)
+	require.NoError(t, writer.WriteSpan(ctx, newTestSpan(0x02)))
+	body := <-written
+	assert.Equal(t, 6, strings.Count(body, "\n"))
+	assert.Equal(t, 2, strings.Count(body, "spans,"), body)
+	assert.Contains(t, body, "span-links,")
+	assert.Contains(t, body, "logs,")
+
+	require.NoError(t, writer.WriteSpan(ctx, newTestSpan(0x03)))
+	require.NoError(t, writer.Close(time.Second))
+	body = <-written
+	assert.Equal(t, 3, strings.Count(body, "\n"))
+	assert.Contains(t, body, "span_id=0000000000000003")
+
+	assert.ErrorIs(t, writer.WriteSpan(ctx, newTestSpan(0x04)), errWriterClosed)
+	assert.Empty(t, written)
+}
+
+func TestInfluxdbWriterPrimary_flushInterval(t *testing.T) {
+	written := make(chan string, 10)
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		written <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influxdb.Close()
+
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 1000, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer func() { _ = writer.Close(time.Second) }()
+
+	require.NoError(t, writer.WriteSpan(context.Background(), newTestSpan(0x01)))
+	select {
+	case body := <-written:
+		assert.Equal(t, 3, strings.Count(body, "\n"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for flush")
+	}
+}
+
+func TestInfluxdbWriterPrimary_writeFailure(t *testing.T) {
+	var attempts atomic.Int32
+	status := make(chan int, 10)
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(<-status)
+	}))
+	defer influxdb.Close()
+
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 3, time.Hour)
+	require.NoError(t, err)
+	writer.retryBackoff = time.Millisecond
+	ctx := context.Background()
+
+	// A retryable failure is retried.
+	status <- http.StatusServiceUnavailable
+	status <- http.StatusNoContent
+	require.NoError(t, writer.WriteSpan(ctx, newTestSpan(0x01)))
+	assert.EqualValues(t, 2, attempts.Load())
+
+	// A rejected batch is not retried, and the error is returned by the WriteSpan call that filled the batch.
+	status <- http.StatusBadRequest
+	err = writer.WriteSpan(ctx, newTestSpan(0x02))
+	assert.ErrorContains(t, err, "400 Bad Request")
+	assert.EqualValues(t, 3, attempts.Load())
+
+	require.NoError(t, writer.Close(time.Second))
+}
+
+func TestInfluxdbWriterPrimary_flushIntervalFailure(t *testing.T) {
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer influxdb.Close()
+
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 1000, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.WriteSpan(context.Background(), newTestSpan(0x01)))
+	assert.Eventually(t, func() bool {
+		writer.failedMu.Lock()
+		defer writer.failedMu.Unlock()
+		return writer.failedLines == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ErrorContains(t, writer.Close(time.Second), "3 lines of spans were not written to InfluxDB")
+}
+
+// newBlockingInfluxdb returns a server whose writes block until the request is canceled or the test ends.
+func newBlockingInfluxdb(t *testing.T) (*httptest.Server, <-chan struct{}) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	influxdb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(influxdb.Close)
+	t.Cleanup(func() { close(release) })
+	return influxdb, started
+}
+
+func TestInfluxdbWriterPrimary_writeCanceled(t *testing.T) {
+	influxdb, started := newBlockingInfluxdb(t)
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 3, time.Hour)
+	require.NoError(t, err)
+	defer func() { _ = writer.Close(time.Second) }()
+
+	// The WriteSpan call that fills a batch returns when its context is done, not after all retries.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	err = writer.WriteSpan(ctx, newTestSpan(0x01))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestInfluxdbWriterPrimary_closeTimeout(t *testing.T) {
+	influxdb, started := newBlockingInfluxdb(t)
+	writer, err := newInfluxdbWriterPrimary(zap.NewNop(), influxdb.Client(), influxdb.URL, "my-token", 1000, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	require.NoError(t, writer.WriteSpan(context.Background(), newTestSpan(0x01)))
+	<-started
+	require.NoError(t, writer.WriteSpan(context.Background(), newTestSpan(0x02)))
+
+	// Close bounds the final write and the flush interval write in progress together.
+	closeStart := time.Now()
+	err = writer.Close(100 * time.Millisecond)
+	assert.ErrorContains(t, err, "timed out waiting for span writes to InfluxDB")
+	assert.Less(t, time.Since(closeStart), time.Second)
+}
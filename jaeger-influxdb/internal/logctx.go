@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/common"
 )
 
 type loggerContext struct{}
@@ -16,3 +18,17 @@ func LoggerFromContext(ctx context.Context) *zap.Logger {
 	logger, _ := ctx.Value(loggerContext{}).(*zap.Logger)
 	return logger
 }
+
+// CommonLogger adapts zap to common.Logger, for the otel2influx and influx2otel converters.
+// Conversion problems are logged at debug level.
+func CommonLogger(logger *zap.Logger) common.Logger {
+	return &common.ErrorLogger{Logger: &zapCommonLogger{logger.Sugar()}}
+}
+
+type zapCommonLogger struct {
+	*zap.SugaredLogger
+}
+
+func (l *zapCommonLogger) Debug(msg string, kv ...interface{}) {
+	l.SugaredLogger.Debugw(msg, kv...)
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2/metrics"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
+	"go.uber.org/zap"
+)
+
+// Jaeger Query reads Service Performance Monitoring metrics from a Prometheus-compatible query API
+// (METRICS_STORAGE_TYPE=prometheus), and the Jaeger gRPC storage plugin API does not include metrics.
+// So the metrics reader is served with the subset of the Prometheus HTTP API that Jaeger Query uses:
+// range queries of the shapes built by the Jaeger Prometheus metrics reader.
+// https://github.com/jaegertracing/jaeger/blob/v1.57.0/plugin/metrics/prometheus/metricsstore/reader.go
+
+const pathPrometheusQueryRange = "/api/v1/query_range"
+
+// promSelector matches the series selector of a Jaeger query; the span kind filter is optional.
+const promSelector = `service_name =~ "([^"]*)", (?:span_kind =~ "([^"]*)")?`
+
+var (
+	// histogram_quantile(0.95, sum(rate(duration_bucket{service_name =~ "a|b", span_kind =~ "SPAN_KIND_SERVER"}[10m])) by (service_name,le))
+	promQueryLatencies = regexp.MustCompile(`^histogram_quantile\(([0-9.]+), sum\(rate\((\w+)_bucket\{` + promSelector + `\}\[(\w+)\]\)\) by \(([\w,]+)\)\)$`)
+	// sum(rate(calls{service_name =~ "a|b", span_kind =~ "SPAN_KIND_SERVER"}[10m])) by (service_name)
+	promQueryCallRates = regexp.MustCompile(`^sum\(rate\((\w+)\{` + promSelector + `\}\[(\w+)\]\)\) by \(([\w,]+)\)$`)
+	// sum(rate(calls{service_name =~ "a|b", status_code = "STATUS_CODE_ERROR", span_kind =~ "SPAN_KIND_SERVER"}[10m])) by (service_name) / sum(rate(calls{...}[10m])) by (service_name)
+	promQueryErrorRates = regexp.MustCompile(`^sum\(rate\((\w+)\{service_name =~ "([^"]*)", status_code = "STATUS_CODE_ERROR", (?:span_kind =~ "([^"]*)")?\}\[(\w+)\]\)\) by \(([\w,]+)\)` +
+		` / sum\(rate\(\w+\{` + promSelector + `\}\[\w+\]\)\) by \([\w,]+\)$`)
+)
+
+// NewPrometheusQueryHandler serves reader with the Prometheus range query API, for Jaeger Query.
+func NewPrometheusQueryHandler(logger *zap.Logger, reader metricsstore.Reader) http.Handler {
+	h := &prometheusQueryHandler{logger: logger, reader: reader}
+	mux := http.NewServeMux()
+	mux.HandleFunc(pathPrometheusQueryRange, h.handleQueryRange)
+	return mux
+}
+
+type prometheusQueryHandler struct {
+	logger *zap.Logger
+	reader metricsstore.Reader
+}
+
+// promRangeQuery is a Jaeger query, parsed from PromQL.
+type promRangeQuery struct {
+	get            func(ctx context.Context, reader metricsstore.Reader) (*metrics.MetricFamily, error)
+	bqp            metricsstore.BaseQueryParameters
+	operationLabel string
+	// scale converts the milliseconds of the spanmetrics duration table to the unit of the latency metric name
+	scale float64
+}
+
+func (h *prometheusQueryHandler) handleQueryRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writePrometheusError(w, http.StatusMethodNotAllowed, "bad_data", "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", err.Error())
+		return
+	}
+	start, err := parsePrometheusTime(r.Form.Get("start"))
+	if err != nil {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", fmt.Sprintf("invalid parameter 'start': %s", err))
+		return
+	}
+	end, err := parsePrometheusTime(r.Form.Get("end"))
+	if err != nil {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", fmt.Sprintf("invalid parameter 'end': %s", err))
+		return
+	}
+	step, err := parsePrometheusDuration(r.Form.Get("step"))
+	if err != nil {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", fmt.Sprintf("invalid parameter 'step': %s", err))
+		return
+	}
+	if end.Before(start) || step <= 0 {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", "end must not be before start, and step must be positive")
+		return
+	}
+	query, err := parsePrometheusQuery(r.Form.Get("query"))
+	if err != nil {
+		writePrometheusError(w, http.StatusBadRequest, "bad_data", err.Error())
+		return
+	}
+	lookback := end.Sub(start)
+	query.bqp.EndTime, query.bqp.Lookback, query.bqp.Step = &end, &lookback, &step
+
+	metricFamily, err := query.get(r.Context(), h.reader)
+	if err != nil {
+		h.logger.Debug("Prometheus range query failed", zap.String("query", r.Form.Get("query")), zap.Error(err))
+		writePrometheusError(w, http.StatusUnprocessableEntity, "execution", err.Error())
+		return
+	}
+
+	result := make([]promSeries, 0, len(metricFamily.Metrics))
+	for _, metric := range metricFamily.Metrics {
+		series := promSeries{Metric: make(map[string]string, len(metric.Labels)), Values: make([]promSample, 0, len(metric.MetricPoints))}
+		for _, label := range metric.Labels {
+			name := label.Name
+			if name == labelOperation {
+				name = query.operationLabel
+			}
+			series.Metric[name] = label.Value
+		}
+		for _, point := range metric.MetricPoints {
+			series.Values = append(series.Values, promSample{
+				timestamp: time.Unix(point.Timestamp.Seconds, int64(point.Timestamp.Nanos)),
+				value:     point.GetGaugeValue().GetDoubleValue() * query.scale,
+			})
+		}
+		result = append(result, series)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"resultType": "matrix", "result": result},
+	})
+}
+
+// parsePrometheusQuery parses a query built by the Jaeger Prometheus metrics reader.
+// Service names and span kinds are matched exactly, not as regular expressions.
+func parsePrometheusQuery(query string) (*promRangeQuery, error) {
+	var q promRangeQuery
+	var services, spanKinds, ratePer, groupBy string
+	if m := promQueryLatencies.FindStringSubmatch(query); m != nil {
+		quantile, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("quantile value is invalid '%s'", m[1])
+		}
+		q.get = func(ctx context.Context, reader metricsstore.Reader) (*metrics.MetricFamily, error) {
+			return reader.GetLatencies(ctx, &metricsstore.LatenciesQueryParameters{BaseQueryParameters: q.bqp, Quantile: quantile})
+		}
+		if strings.HasSuffix(m[2], "_seconds") {
+			q.scale = 1.0 / 1000
+		}
+		services, spanKinds, ratePer, groupBy = m[3], m[4], m[5], m[6]
+	} else if m = promQueryErrorRates.FindStringSubmatch(query); m != nil {
+		q.get = func(ctx context.Context, reader metricsstore.Reader) (*metrics.MetricFamily, error) {
+			return reader.GetErrorRates(ctx, &metricsstore.ErrorRateQueryParameters{BaseQueryParameters: q.bqp})
+		}
+		services, spanKinds, ratePer, groupBy = m[2], m[3], m[4], m[5]
+	} else if m = promQueryCallRates.FindStringSubmatch(query); m != nil {
+		q.get = func(ctx context.Context, reader metricsstore.Reader) (*metrics.MetricFamily, error) {
+			return reader.GetCallRates(ctx, &metricsstore.CallRateQueryParameters{BaseQueryParameters: q.bqp})
+		}
+		services, spanKinds, ratePer, groupBy = m[2], m[3], m[4], m[5]
+	} else {
+		return nil, fmt.Errorf("query is not supported; only the queries of the Jaeger Prometheus metrics reader are supported: %s", query)
+	}
+	if q.scale == 0 {
+		q.scale = 1
+	}
+
+	rate, err := parsePrometheusDuration(ratePer)
+	if err != nil || rate <= 0 {
+		return nil, fmt.Errorf("range value is invalid '%s'", ratePer)
+	}
+	q.bqp.RatePer = &rate
+	q.bqp.ServiceNames = strings.Split(services, "|")
+	if spanKinds != "" {
+		q.bqp.SpanKinds = strings.Split(spanKinds, "|")
+	}
+	for _, label := range strings.Split(groupBy, ",") {
+		// the operation label is "span_name" with the spanmetrics connector, or "operation" with the legacy spanmetrics processor
+		if label == "span_name" || label == labelOperation {
+			q.bqp.GroupByOperation = true
+			q.operationLabel = label
+		}
+	}
+	return &q, nil
+}
+
+// parsePrometheusTime parses a Unix timestamp in seconds, or an RFC 3339 timestamp.
+func parsePrometheusTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(math.Round(fraction*1000))*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parsePrometheusDuration parses a duration in seconds, or a single-unit duration such as 10m.
+func parsePrometheusDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values []promSample      `json:"values"`
+}
+
+type promSample struct {
+	timestamp time.Time
+	value     float64
+}
+
+// MarshalJSON encodes a sample like the Prometheus API: [<unix seconds>, "<value>"].
+func (s promSample) MarshalJSON() ([]byte, error) {
+	timestamp := strconv.FormatFloat(float64(s.timestamp.UnixMilli())/1000, 'f', -1, 64)
+	return []byte(fmt.Sprintf(`[%s,"%s"]`, timestamp, strconv.FormatFloat(s.value, 'f', -1, 64))), nil
+}
+
+func writePrometheusError(w http.ResponseWriter, httpStatus int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "error", "errorType": errorType, "error": message})
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/jaegertracing/jaeger/pkg/prometheus/config"
+	prometheusmetricsstore "github.com/jaegertracing/jaeger/plugin/metrics/prometheus/metricsstore"
+	"github.com/jaegertracing/jaeger/proto-gen/api_v2/metrics"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+// capturingMetricsReader returns one point per query, with the value of the query kind.
+type capturingMetricsReader struct {
+	metricsstore.Reader
+	params   *metricsstore.BaseQueryParameters
+	quantile float64
+}
+
+func (r *capturingMetricsReader) metricFamily(params *metricsstore.BaseQueryParameters, value float64) *metrics.MetricFamily {
+	r.params = params
+	labels := []*metrics.Label{{Name: labelServiceName, Value: params.ServiceNames[0]}}
+	if params.GroupByOperation {
+		labels = append(labels, &metrics.Label{Name: labelOperation, Value: "GET /"})
+	}
+	return &metrics.MetricFamily{Metrics: []*metrics.Metric{{
+		Labels: labels,
+		MetricPoints: []*metrics.MetricPoint{{
+			Timestamp: &types.Timestamp{Seconds: 1000, Nanos: 5e8},
+			Value:     &metrics.MetricPoint_GaugeValue{GaugeValue: &metrics.GaugeValue{Value: &metrics.GaugeValue_DoubleValue{DoubleValue: value}}},
+		}},
+	}}}
+}
+
+func (r *capturingMetricsReader) GetLatencies(_ context.Context, params *metricsstore.LatenciesQueryParameters) (*metrics.MetricFamily, error) {
+	r.quantile = params.Quantile
+	return r.metricFamily(&params.BaseQueryParameters, 250), nil
+}
+
+func (r *capturingMetricsReader) GetCallRates(_ context.Context, params *metricsstore.CallRateQueryParameters) (*metrics.MetricFamily, error) {
+	return r.metricFamily(&params.BaseQueryParameters, 1.5), nil
+}
+
+func (r *capturingMetricsReader) GetErrorRates(_ context.Context, params *metricsstore.ErrorRateQueryParameters) (*metrics.MetricFamily, error) {
+	return r.metricFamily(&params.BaseQueryParameters, 0.25), nil
+}
+
+// TestPrometheusQueryHandler queries the handler with the Jaeger Query Prometheus metrics reader.
+func TestPrometheusQueryHandler(t *testing.T) {
+	reader := new(capturingMetricsReader)
+	server := httptest.NewServer(NewPrometheusQueryHandler(zap.NewNop(), reader))
+	defer server.Close()
+
+	jaegerReader, err := prometheusmetricsstore.NewMetricsReader(config.Configuration{
+		ServerURL:                   server.URL,
+		ConnectTimeout:              time.Second,
+		SupportSpanmetricsConnector: true,
+		LatencyUnit:                 "s",
+		NormalizeDuration:           true,
+	}, zap.NewNop(), noop.NewTracerProvider())
+	require.NoError(t, err)
+
+	endTime, lookback, step, ratePer := time.Unix(2000, 0), time.Hour, time.Minute, 10*time.Minute
+	bqp := metricsstore.BaseQueryParameters{
+		ServiceNames:     []string{"my-service", "other-service"},
+		GroupByOperation: true,
+		EndTime:          &endTime,
+		Lookback:         &lookback,
+		Step:             &step,
+		RatePer:          &ratePer,
+		SpanKinds:        []string{"SPAN_KIND_SERVER", "SPAN_KIND_CLIENT"},
+	}
+	ctx := context.Background()
+	assertMetric := func(t *testing.T, expected float64, metricFamily *metrics.MetricFamily) {
+		t.Helper()
+		require.Len(t, metricFamily.Metrics, 1)
+		metric := metricFamily.Metrics[0]
+		assert.ElementsMatch(t, []*metrics.Label{{Name: "service_name", Value: "my-service"}, {Name: "operation", Value: "GET /"}}, metric.Labels)
+		require.Len(t, metric.MetricPoints, 1)
+		assert.Equal(t, &types.Timestamp{Seconds: 1000, Nanos: 5e8}, metric.MetricPoints[0].Timestamp)
+		assert.Equal(t, expected, metric.MetricPoints[0].GetGaugeValue().GetDoubleValue())
+
+		assert.Equal(t, bqp.ServiceNames, reader.params.ServiceNames)
+		assert.True(t, reader.params.GroupByOperation)
+		assert.Equal(t, endTime, *reader.params.EndTime)
+		assert.Equal(t, lookback, *reader.params.Lookback)
+		assert.Equal(t, step, *reader.params.Step)
+		assert.Equal(t, ratePer, *reader.params.RatePer)
+		assert.Equal(t, bqp.SpanKinds, reader.params.SpanKinds)
+	}
+
+	callRates, err := jaegerReader.GetCallRates(ctx, &metricsstore.CallRateQueryParameters{BaseQueryParameters: bqp})
+	require.NoError(t, err)
+	assertMetric(t, 1.5, callRates)
+
+	errorRates, err := jaegerReader.GetErrorRates(ctx, &metricsstore.ErrorRateQueryParameters{BaseQueryParameters: bqp})
+	require.NoError(t, err)
+	assertMetric(t, 0.25, errorRates)
+
+	// The duration table is in milliseconds, and the normalized latency metric name is in seconds.
+	latencies, err := jaegerReader.GetLatencies(ctx, &metricsstore.LatenciesQueryParameters{BaseQueryParameters: bqp, Quantile: 0.95})
+	require.NoError(t, err)
+	assertMetric(t, 0.25, latencies)
+	assert.Equal(t, 0.95, reader.quantile)
+
+	bqp.GroupByOperation, bqp.SpanKinds = false, nil
+	_, err = jaegerReader.GetCallRates(ctx, &metricsstore.CallRateQueryParameters{BaseQueryParameters: bqp})
+	require.NoError(t, err)
+	assert.False(t, reader.params.GroupByOperation)
+	assert.Empty(t, reader.params.SpanKinds)
+
+	res, err := http.PostForm(server.URL+pathPrometheusQueryRange, url.Values{
+		"query": {`up`}, "start": {"1000"}, "end": {"2000"}, "step": {"60"},
+	})
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
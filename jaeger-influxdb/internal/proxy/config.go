@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	otlpProtocolGRPC         = "grpc"
+	otlpProtocolHTTPProtobuf = "http/protobuf"
+)
+
+type Config struct {
+	LogLevel   string
+	ListenAddr string
+
+	OTLPEndpoint string
+	OTLPProtocol string
+	OTLPInsecure bool
+	OTLPTimeout  time.Duration
+	OTLPHeaders  []string
+
+	AuthPassthrough bool
+	MaxBodySize     int
+	ShutdownTimeout time.Duration
+}
+
+func (c *Config) Init(command *cobra.Command) error {
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	for _, f := range []struct {
+		pointer      interface{}
+		name         string
+		defaultValue interface{}
+		usage        string
+	}{
+		{
+			pointer:      &c.LogLevel,
+			name:         "log-level",
+			defaultValue: zapcore.InfoLevel.String(),
+			usage:        "log level (zap)",
+		},
+		{
+			pointer:      &c.ListenAddr,
+			name:         "listen-addr",
+			defaultValue: ":8086",
+			usage:        "InfluxDB write API (this process) host:port address",
+		},
+		{
+			pointer: &c.OTLPEndpoint,
+			name:    "otlp-endpoint",
+			usage:   "OTLP receiver host:port or URL, to export metrics",
+		},
+		{
+			pointer:      &c.OTLPProtocol,
+			name:         "otlp-protocol",
+			defaultValue: otlpProtocolGRPC,
+			usage:        "OTLP transport protocol; one of " + otlpProtocolGRPC + ", " + otlpProtocolHTTPProtobuf,
+		},
+		{
+			pointer: &c.OTLPInsecure,
+			name:    "otlp-insecure",
+			usage:   "Do not use TLS to connect to the OTLP receiver (mostly for development)",
+		},
+		{
+			pointer:      &c.OTLPTimeout,
+			name:         "otlp-timeout",
+			defaultValue: 10 * time.Second,
+			usage:        "OTLP export timeout",
+		},
+		{
+			pointer: &c.OTLPHeaders,
+			name:    "otlp-header",
+			usage:   "key=value header (HTTP) or metadata (gRPC) sent with each export (specify zero to many times)",
+		},
+		{
+			pointer: &c.AuthPassthrough,
+			name:    "auth-passthrough",
+			usage:   "Forward the credentials of each write request as the authorization header of its export",
+		},
+		{
+			pointer:      &c.MaxBodySize,
+			name:         "max-body-size",
+			defaultValue: 32 << 20,
+			usage:        "maximum size in bytes of a decompressed write request body",
+		},
+		{
+			pointer:      &c.ShutdownTimeout,
+			name:         "shutdown-timeout",
+			defaultValue: 10 * time.Second,
+			usage:        "time allowed for in-flight requests to complete at exit",
+		},
+	} {
+		switch v := f.pointer.(type) {
+		case *string:
+			var defaultValue string
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(string)
+			}
+			command.Flags().StringVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetString(f.name)
+		case *int:
+			var defaultValue int
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(int)
+			}
+			command.Flags().IntVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetInt(f.name)
+		case *time.Duration:
+			var defaultValue time.Duration
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(time.Duration)
+			}
+			command.Flags().DurationVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetDuration(f.name)
+		case *bool:
+			var defaultValue bool
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.(bool)
+			}
+			command.Flags().BoolVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetBool(f.name)
+		case *[]string:
+			var defaultValue []string
+			if f.defaultValue != nil {
+				defaultValue = f.defaultValue.([]string)
+			}
+			command.Flags().StringSliceVar(v, f.name, defaultValue, f.usage)
+			if err := viper.BindPFlag(f.name, command.Flags().Lookup(f.name)); err != nil {
+				return err
+			}
+			*v = viper.GetStringSlice(f.name)
+		default:
+			return fmt.Errorf("flag type %T not implemented", f.pointer)
+		}
+	}
+	return nil
+}
+
+// parseHeaders parses key=value pairs; keys are lower case, as required for gRPC metadata.
+func parseHeaders(pairs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, found := strings.Cut(pair, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !found || k == "" {
+			return nil, fmt.Errorf("otlp-header value is invalid '%s': expected key=value", pair)
+		}
+		headers[k] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
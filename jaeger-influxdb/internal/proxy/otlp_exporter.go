@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	headerAuthorization = "authorization"
+	otlpHTTPMetricsPath = "/v1/metrics"
+)
+
+var (
+	// errExportRetryable wraps export errors that the client should retry.
+	errExportRetryable = errors.New("OTLP export failed, retry later")
+	// errExportUnauthorized wraps export errors caused by missing or rejected credentials.
+	errExportUnauthorized = errors.New("OTLP receiver rejected the credentials")
+)
+
+// metricsExporter sends metrics to an OTLP receiver.
+// If authorization is not empty, it replaces any configured authorization header.
+type metricsExporter interface {
+	Export(ctx context.Context, metrics pmetric.Metrics, authorization string) error
+	Close() error
+}
+
+func newMetricsExporter(logger *zap.Logger, config *Config) (metricsExporter, error) {
+	if config.OTLPEndpoint == "" {
+		return nil, fmt.Errorf("otlp-endpoint not specified, either by flag or env var")
+	}
+	headers, err := parseHeaders(config.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	switch config.OTLPProtocol {
+	case otlpProtocolGRPC:
+		return newGRPCMetricsExporter(logger, config, headers)
+	case otlpProtocolHTTPProtobuf:
+		return newHTTPMetricsExporter(logger, config, headers)
+	default:
+		return nil, fmt.Errorf("otlp-protocol value is invalid '%s'", config.OTLPProtocol)
+	}
+}
+
+type grpcMetricsExporter struct {
+	logger  *zap.Logger
+	conn    *grpc.ClientConn
+	client  pmetricotlp.GRPCClient
+	timeout time.Duration
+	headers map[string]string
+}
+
+// newGRPCMetricsExporter accepts otlp-endpoint as host:port, or a URL with http or https scheme.
+func newGRPCMetricsExporter(logger *zap.Logger, config *Config, headers map[string]string) (*grpcMetricsExporter, error) {
+	target := config.OTLPEndpoint
+	tlsDisable := config.OTLPInsecure
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("otlp-endpoint value is invalid '%s': %w", target, err)
+		}
+		switch u.Scheme {
+		case "http":
+			tlsDisable = true
+		case "https":
+		default:
+			return nil, fmt.Errorf("otlp-endpoint value is invalid '%s': URL scheme '%s' is not recognized", target, u.Scheme)
+		}
+		target = u.Host
+	}
+
+	var transportCredentials credentials.TransportCredentials
+	if tlsDisable {
+		transportCredentials = insecure.NewCredentials()
+	} else {
+		transportCredentials = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP/gRPC client: %w", err)
+	}
+	return &grpcMetricsExporter{
+		logger:  logger,
+		conn:    conn,
+		client:  pmetricotlp.NewGRPCClient(conn),
+		timeout: config.OTLPTimeout,
+		headers: headers,
+	}, nil
+}
+
+func (e *grpcMetricsExporter) Export(ctx context.Context, metrics pmetric.Metrics, authorization string) error {
+	md := metadata.New(e.headers)
+	if authorization != "" {
+		md.Set(headerAuthorization, authorization)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	response, err := e.client.Export(ctx, pmetricotlp.NewExportRequestFromMetrics(metrics))
+	if err != nil {
+		// https://opentelemetry.io/docs/specs/otlp/#failures
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+			return fmt.Errorf("%w: %w", errExportRetryable, err)
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return fmt.Errorf("%w: %w", errExportUnauthorized, err)
+		default:
+			return err
+		}
+	}
+	logPartialSuccess(e.logger, response)
+	return nil
+}
+
+func (e *grpcMetricsExporter) Close() error {
+	return e.conn.Close()
+}
+
+type httpMetricsExporter struct {
+	logger     *zap.Logger
+	httpClient *http.Client
+	url        string
+	headers    map[string]string
+}
+
+func newHTTPMetricsExporter(logger *zap.Logger, config *Config, headers map[string]string) (*httpMetricsExporter, error) {
+	exportURL, err := composeHTTPExportURL(config.OTLPEndpoint, config.OTLPInsecure)
+	if err != nil {
+		return nil, err
+	}
+	return &httpMetricsExporter{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: config.OTLPTimeout},
+		url:        exportURL,
+		headers:    headers,
+	}, nil
+}
+
+// composeHTTPExportURL accepts otlp-endpoint as host:port, or a URL with http or https scheme.
+// The signal path /v1/metrics is appended if the URL has no path.
+func composeHTTPExportURL(endpoint string, tlsDisable bool) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		if tlsDisable {
+			endpoint = "http://" + endpoint
+		} else {
+			endpoint = "https://" + endpoint
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("otlp-endpoint value is invalid '%s': %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("otlp-endpoint value is invalid '%s': URL scheme '%s' is not recognized", endpoint, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("otlp-endpoint value is invalid '%s': host is missing", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPMetricsPath
+	}
+	return u.String(), nil
+}
+
+func (e *httpMetricsExporter) Export(ctx context.Context, metrics pmetric.Metrics, authorization string) error {
+	body, err := pmetricotlp.NewExportRequestFromMetrics(metrics).MarshalProto()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	if authorization != "" {
+		req.Header.Set(headerAuthorization, authorization)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	res, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errExportRetryable, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errExportRetryable, err)
+	}
+
+	if res.StatusCode/100 != 2 {
+		err = fmt.Errorf("OTLP receiver returned status %s: %s", res.Status, strings.TrimSpace(string(resBody)))
+		// https://opentelemetry.io/docs/specs/otlp/#retryable-response-codes
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return fmt.Errorf("%w: %w", errExportRetryable, err)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%w: %w", errExportUnauthorized, err)
+		default:
+			return err
+		}
+	}
+	response := pmetricotlp.NewExportResponse()
+	if err = response.UnmarshalProto(resBody); err != nil {
+		e.logger.Debug("failed to decode OTLP export response", zap.Error(err))
+		return nil
+	}
+	logPartialSuccess(e.logger, response)
+	return nil
+}
+
+func (e *httpMetricsExporter) Close() error {
+	e.httpClient.CloseIdleConnections()
+	return nil
+}
+
+func logPartialSuccess(logger *zap.Logger, response pmetricotlp.ExportResponse) {
+	if partialSuccess := response.PartialSuccess(); partialSuccess.RejectedDataPoints() > 0 {
+		logger.Warn("OTLP receiver rejected data points",
+			zap.Int64("rejected", partialSuccess.RejectedDataPoints()),
+			zap.String("message", partialSuccess.ErrorMessage()))
+	}
+}
@@ -0,0 +1,389 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+	"github.com/influxdata/influxdb-observability/jaeger-influxdb/internal"
+)
+
+const (
+	pathWriteV1 = "/write"
+	pathWriteV2 = "/api/v2/write"
+	pathWriteV3 = "/api/v3/write_lp"
+	pathHealth  = "/health"
+	pathPing    = "/ping"
+)
+
+// Proxy receives line protocol with the InfluxDB v1, v2 and v3 write APIs,
+// converts it to metrics with influx2otel, and exports the metrics to an OTLP receiver.
+type Proxy struct {
+	logger          *zap.Logger
+	converter       *influx2otel.LineProtocolToOtelMetrics
+	exporter        metricsExporter
+	authPassthrough bool
+	maxBodySize     int64
+
+	httpServer *http.Server
+}
+
+func NewProxy(ctx context.Context, config *Config) (*Proxy, error) {
+	logger := internal.LoggerFromContext(ctx)
+	if config.MaxBodySize < 1 {
+		return nil, fmt.Errorf("max-body-size must be positive, got %d", config.MaxBodySize)
+	}
+	converter, err := influx2otel.NewLineProtocolToOtelMetrics(internal.CommonLogger(logger))
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := newMetricsExporter(logger.With(zap.String("otlp", "exporter")), config)
+	if err != nil {
+		return nil, err
+	}
+	return newProxy(logger, config, converter, exporter), nil
+}
+
+func newProxy(logger *zap.Logger, config *Config, converter *influx2otel.LineProtocolToOtelMetrics, exporter metricsExporter) *Proxy {
+	p := &Proxy{
+		logger:          logger,
+		converter:       converter,
+		exporter:        exporter,
+		authPassthrough: config.AuthPassthrough,
+		maxBodySize:     int64(config.MaxBodySize),
+	}
+	p.httpServer = &http.Server{Handler: p.httpHandler()}
+	return p
+}
+
+// Serve serves the write API on listener until Shutdown is called.
+func (p *Proxy) Serve(listener net.Listener) error {
+	if err := p.httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops receiving, and waits for in-flight requests within ctx.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	return multierr.Combine(p.httpServer.Shutdown(ctx), p.exporter.Close())
+}
+
+func (p *Proxy) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(pathWriteV1, p.writeHandler(apiV1))
+	mux.Handle(pathWriteV2, p.writeHandler(apiV2))
+	mux.Handle(pathWriteV3, p.writeHandler(apiV3))
+	mux.HandleFunc(pathHealth, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"name":"influxdb-otlp","message":"ready for writes","status":"pass"}`)
+	})
+	mux.HandleFunc(pathPing, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+type writeAPI uint8
+
+const (
+	apiV1 writeAPI = iota
+	apiV2
+	apiV3
+)
+
+func (p *Proxy) writeHandler(api writeAPI) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, api, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		precision, err := parsePrecision(api, r.URL.Query().Get("precision"))
+		if err != nil {
+			writeError(w, api, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "", "identity":
+		case "gzip":
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				writeError(w, api, http.StatusBadRequest, err.Error())
+				return
+			}
+			defer func() { _ = gzipReader.Close() }()
+			body = gzipReader
+		default:
+			writeError(w, api, http.StatusUnsupportedMediaType, "unsupported content encoding")
+			return
+		}
+		buf, err := io.ReadAll(io.LimitReader(body, p.maxBodySize+1))
+		if err != nil {
+			writeError(w, api, http.StatusBadRequest, err.Error())
+			return
+		}
+		if int64(len(buf)) > p.maxBodySize {
+			writeError(w, api, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", p.maxBodySize))
+			return
+		}
+
+		batch := p.converter.NewBatch()
+		var partialErr *partialWriteError
+		if err = p.addLineProtocol(batch, buf, precision, time.Now()); err != nil && !errors.As(err, &partialErr) {
+			writeError(w, api, http.StatusBadRequest, err.Error())
+			return
+		}
+		metrics := batch.GetMetrics()
+		if metrics.DataPointCount() == 0 {
+			if partialErr != nil {
+				writeError(w, api, http.StatusBadRequest, partialErr.Error())
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		var authorization string
+		if p.authPassthrough {
+			authorization = requestAuthorization(r, api)
+		}
+		if err = p.exporter.Export(r.Context(), metrics, authorization); err != nil {
+			switch {
+			case errors.Is(err, errExportUnauthorized):
+				writeError(w, api, http.StatusUnauthorized, err.Error())
+			case errors.Is(err, errExportRetryable):
+				w.Header().Set("Retry-After", "1")
+				writeError(w, api, http.StatusServiceUnavailable, err.Error())
+			default:
+				p.logger.Debug("export failed", zap.Error(err))
+				writeError(w, api, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		if partialErr != nil {
+			// the accepted points are exported, like an InfluxDB partial write
+			writeError(w, api, http.StatusBadRequest, partialErr.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// partialWriteError reports points that the converter rejected,
+// in the format of an InfluxDB partial write error.
+type partialWriteError struct {
+	dropped int
+	first   error
+}
+
+func (e *partialWriteError) Error() string {
+	return fmt.Sprintf("partial write: %s dropped=%d", e.first, e.dropped)
+}
+
+// addLineProtocol decodes lines and adds them to batch.
+// Lines without a timestamp get defaultTime.
+// Points that the converter rejects are dropped and reported as a *partialWriteError, after all lines are added;
+// a syntax error fails the whole request.
+func (p *Proxy) addLineProtocol(batch *influx2otel.MetricsBatch, buf []byte, precision time.Duration, defaultTime time.Time) error {
+	var partialErr *partialWriteError
+	decoder := lineprotocol.NewDecoderWithBytes(buf)
+	for decoder.Next() {
+		measurement, err := decoder.Measurement()
+		if err != nil {
+			return err
+		}
+		tags := make(map[string]string)
+		for {
+			k, v, err := decoder.NextTag()
+			if err != nil {
+				return err
+			}
+			if k == nil {
+				break
+			}
+			tags[string(k)] = string(v)
+		}
+		fields := make(map[string]interface{})
+		for {
+			k, v, err := decoder.NextField()
+			if err != nil {
+				return err
+			}
+			if k == nil {
+				break
+			}
+			fields[string(k)] = v.Interface()
+		}
+		timestampBytes, err := decoder.TimeBytes()
+		if err != nil {
+			return err
+		}
+		ts, err := parseTimestamp(timestampBytes, precision, defaultTime)
+		if err != nil {
+			return err
+		}
+
+		if err = batch.AddPoint(string(measurement), tags, fields, ts, common.InfluxMetricValueTypeUntyped); err != nil {
+			if partialErr == nil {
+				partialErr = &partialWriteError{first: fmt.Errorf("failed to convert point '%s': %w", measurement, err)}
+			}
+			partialErr.dropped++
+		}
+	}
+	if partialErr != nil {
+		return partialErr
+	}
+	return nil
+}
+
+// precisionAuto selects the timestamp precision by magnitude, like the InfluxDB v3 write_lp API.
+const precisionAuto time.Duration = 0
+
+// parsePrecision parses the precision query parameter of each write API.
+func parsePrecision(api writeAPI, precision string) (time.Duration, error) {
+	switch api {
+	case apiV1:
+		switch precision {
+		case "", "n", "ns":
+			return time.Nanosecond, nil
+		case "u", "us":
+			return time.Microsecond, nil
+		case "ms":
+			return time.Millisecond, nil
+		case "s":
+			return time.Second, nil
+		case "m":
+			return time.Minute, nil
+		case "h":
+			return time.Hour, nil
+		}
+	case apiV2:
+		switch precision {
+		case "", "ns":
+			return time.Nanosecond, nil
+		case "us":
+			return time.Microsecond, nil
+		case "ms":
+			return time.Millisecond, nil
+		case "s":
+			return time.Second, nil
+		}
+	case apiV3:
+		switch precision {
+		case "", "auto":
+			return precisionAuto, nil
+		case "nanosecond", "ns":
+			return time.Nanosecond, nil
+		case "microsecond", "us":
+			return time.Microsecond, nil
+		case "millisecond", "ms":
+			return time.Millisecond, nil
+		case "second", "s":
+			return time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("precision value is invalid '%s'", precision)
+}
+
+func parseTimestamp(timestampBytes []byte, precision time.Duration, defaultTime time.Time) (time.Time, error) {
+	if len(timestampBytes) == 0 {
+		return defaultTime, nil
+	}
+	n, err := strconv.ParseInt(string(timestampBytes), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp value is invalid '%s': %w", timestampBytes, err)
+	}
+	if precision == precisionAuto {
+		precision = guessPrecision(n)
+	}
+	if n > math.MaxInt64/int64(precision) || n < math.MinInt64/int64(precision) {
+		return time.Time{}, fmt.Errorf("timestamp value is out of range '%s'", timestampBytes)
+	}
+	return time.Unix(0, n*int64(precision)), nil
+}
+
+// guessPrecision assumes that the timestamp is within a few decades of the present.
+func guessPrecision(n int64) time.Duration {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n < 5e9:
+		return time.Second
+	case n < 5e12:
+		return time.Millisecond
+	case n < 5e15:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// requestAuthorization returns the credentials of a write request, as an authorization header value.
+// The v1 API also accepts credentials as u and p query parameters.
+func requestAuthorization(r *http.Request, api writeAPI) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		return authorization
+	}
+	if api == apiV1 {
+		query := r.URL.Query()
+		if username, password := query.Get("u"), query.Get("p"); password != "" {
+			if username == "" {
+				return "Token " + password
+			}
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		}
+	}
+	return ""
+}
+
+// writeError writes an error in the format of each write API.
+func writeError(w http.ResponseWriter, api writeAPI, httpStatus int, message string) {
+	var body interface{}
+	if api == apiV1 {
+		body = map[string]string{"error": message}
+	} else {
+		body = map[string]string{"code": errorCode(httpStatus), "message": message}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func errorCode(httpStatus int) string {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return "invalid"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusMethodNotAllowed:
+		return "method not allowed"
+	case http.StatusRequestEntityTooLarge:
+		return "request too large"
+	case http.StatusUnsupportedMediaType:
+		return "unsupported media type"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "internal error"
+	}
+}
@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+)
+
+type exportCall struct {
+	metrics       pmetric.Metrics
+	authorization string
+}
+
+type fakeExporter struct {
+	calls []exportCall
+	err   error
+}
+
+func (e *fakeExporter) Export(_ context.Context, metrics pmetric.Metrics, authorization string) error {
+	e.calls = append(e.calls, exportCall{metrics: metrics, authorization: authorization})
+	return e.err
+}
+
+func (e *fakeExporter) Close() error {
+	return nil
+}
+
+func newTestProxy(t *testing.T, exporter metricsExporter) *httptest.Server {
+	t.Helper()
+	converter, err := influx2otel.NewLineProtocolToOtelMetrics(new(common.NoopLogger))
+	require.NoError(t, err)
+	config := &Config{AuthPassthrough: true, MaxBodySize: 1 << 10}
+	p := newProxy(zap.NewNop(), config, converter, exporter)
+	server := httptest.NewServer(p.httpHandler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, url, body string, header http.Header) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = res.Body.Close() }()
+	resBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res.StatusCode, string(resBody)
+}
+
+func TestProxy_Write(t *testing.T) {
+	for _, testCase := range []struct {
+		name                  string
+		path                  string
+		header                http.Header
+		body                  string
+		expectedTime          time.Time
+		expectedAuthorization string
+	}{
+		{
+			name:                  "v2",
+			path:                  "/api/v2/write?org=o&bucket=b&precision=s",
+			header:                http.Header{"Authorization": {"Token my-token"}},
+			body:                  "cpu_temp,host=a gauge=87.3 1395066363",
+			expectedTime:          time.Unix(1395066363, 0),
+			expectedAuthorization: "Token my-token",
+		},
+		{
+			name:                  "v1 query credentials",
+			path:                  "/write?db=d&u=user&p=pass&precision=ms",
+			body:                  "cpu_temp,host=a gauge=87.3 1395066363000",
+			expectedTime:          time.Unix(1395066363, 0),
+			expectedAuthorization: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:         "v1 minutes",
+			path:         "/write?db=d&precision=m",
+			body:         "cpu_temp,host=a gauge=87.3 23251106",
+			expectedTime: time.Unix(1395066360, 0),
+		},
+		{
+			name:                  "v3 auto",
+			path:                  "/api/v3/write_lp?db=d",
+			header:                http.Header{"Authorization": {"Bearer my-token"}},
+			body:                  "cpu_temp,host=a gauge=87.3 1395066363000000",
+			expectedTime:          time.Unix(1395066363, 0),
+			expectedAuthorization: "Bearer my-token",
+		},
+		{
+			name:         "v3 nanosecond",
+			path:         "/api/v3/write_lp?db=d&precision=nanosecond",
+			body:         "cpu_temp,host=a gauge=87.3 1395066363000000000",
+			expectedTime: time.Unix(1395066363, 0),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			exporter := new(fakeExporter)
+			server := newTestProxy(t, exporter)
+
+			statusCode, body := post(t, server.URL+testCase.path, testCase.body, testCase.header)
+			assert.Equal(t, http.StatusNoContent, statusCode, body)
+			require.Len(t, exporter.calls, 1)
+			call := exporter.calls[0]
+			assert.Equal(t, testCase.expectedAuthorization, call.authorization)
+
+			require.Equal(t, 1, call.metrics.DataPointCount())
+			resourceMetrics := call.metrics.ResourceMetrics().At(0)
+			metric := resourceMetrics.ScopeMetrics().At(0).Metrics().At(0)
+			assert.Equal(t, "cpu_temp", metric.Name())
+			dataPoint := metric.Gauge().DataPoints().At(0)
+			assert.Equal(t, 87.3, dataPoint.DoubleValue())
+			assert.Equal(t, testCase.expectedTime.UnixNano(), dataPoint.Timestamp().AsTime().UnixNano())
+			host, _ := dataPoint.Attributes().Get("host")
+			assert.Equal(t, "a", host.Str())
+		})
+	}
+}
+
+func TestProxy_WriteErrors(t *testing.T) {
+	exporter := new(fakeExporter)
+	server := newTestProxy(t, exporter)
+
+	statusCode, body := post(t, server.URL+"/api/v2/write?precision=m", "cpu_temp gauge=1", nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.JSONEq(t, `{"code":"invalid","message":"precision value is invalid 'm'"}`, body)
+
+	statusCode, body = post(t, server.URL+"/write", "cpu_temp gauge=", nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.Contains(t, body, `"error":`)
+
+	statusCode, _ = post(t, server.URL+"/api/v2/write", strings.Repeat("cpu_temp gauge=1\n", 100), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusCode)
+
+	statusCode, body = post(t, server.URL+"/write", `cpu_temp gauge="hot"`, nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.JSONEq(t, `{"error":"partial write: failed to convert point 'cpu_temp': unsupported gauge value type string dropped=1"}`, body)
+
+	assert.Empty(t, exporter.calls)
+
+	// accepted points are exported, and rejected points are counted
+	statusCode, body = post(t, server.URL+"/api/v2/write", "cpu_temp gauge=1\ncpu_temp gauge=\"hot\"\ncpu_temp gauge=true", nil)
+	assert.Equal(t, http.StatusBadRequest, statusCode)
+	assert.JSONEq(t, `{"code":"invalid","message":"partial write: failed to convert point 'cpu_temp': unsupported gauge value type string dropped=2"}`, body)
+	require.Len(t, exporter.calls, 1)
+	assert.Equal(t, 1, exporter.calls[0].metrics.DataPointCount())
+	exporter.calls = nil
+
+	for _, testCase := range []struct {
+		err            error
+		expectedStatus int
+	}{
+		{errors.Join(errExportRetryable, errors.New("unavailable")), http.StatusServiceUnavailable},
+		{errors.Join(errExportUnauthorized, errors.New("denied")), http.StatusUnauthorized},
+		{errors.New("bad"), http.StatusInternalServerError},
+	} {
+		exporter.err = testCase.err
+		statusCode, _ = post(t, server.URL+"/api/v2/write", "cpu_temp gauge=1", nil)
+		assert.Equal(t, testCase.expectedStatus, statusCode)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	defaultTime := time.Unix(1, 0)
+	for _, testCase := range []struct {
+		value        string
+		precision    time.Duration
+		expectedTime time.Time
+		expectError  bool
+	}{
+		{"", time.Second, defaultTime, false},
+		{"1395066363", precisionAuto, time.Unix(1395066363, 0), false},
+		{"1395066363123", precisionAuto, time.UnixMilli(1395066363123), false},
+		{"1395066363123456", precisionAuto, time.UnixMicro(1395066363123456), false},
+		{"1395066363123456789", precisionAuto, time.Unix(0, 1395066363123456789), false},
+		{"-1", time.Hour, time.Unix(-3600, 0), false},
+		{"9223372036854775807", time.Second, time.Time{}, true},
+		{"1.5", time.Second, time.Time{}, true},
+	} {
+		t.Run(testCase.value, func(t *testing.T) {
+			ts, err := parseTimestamp([]byte(testCase.value), testCase.precision, defaultTime)
+			if testCase.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, testCase.expectedTime.Equal(ts), ts)
+			}
+		})
+	}
+}
+
+func TestHTTPMetricsExporter(t *testing.T) {
+	received := make(chan pmetricotlp.ExportRequest, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Token bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, otlpHTTPMetricsPath, r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "v", r.Header.Get("X-Custom"))
+		assert.Equal(t, "Token my-token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		request := pmetricotlp.NewExportRequest()
+		assert.NoError(t, request.UnmarshalProto(body))
+		received <- request
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	exporter, err := newMetricsExporter(zap.NewNop(), &Config{
+		OTLPEndpoint: strings.TrimPrefix(receiver.URL, "http://"),
+		OTLPProtocol: otlpProtocolHTTPProtobuf,
+		OTLPInsecure: true,
+		OTLPTimeout:  time.Second,
+		OTLPHeaders:  []string{"X-Custom=v", "Authorization=Token configured"},
+	})
+	require.NoError(t, err)
+	defer func() { _ = exporter.Close() }()
+
+	metrics := pmetric.NewMetrics()
+	metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+	require.NoError(t, exporter.Export(context.Background(), metrics, "Token my-token"))
+	assert.Equal(t, 1, (<-received).Metrics().DataPointCount())
+
+	assert.ErrorIs(t, exporter.Export(context.Background(), metrics, "Token bad"), errExportUnauthorized)
+}
+
+func TestComposeHTTPExportURL(t *testing.T) {
+	for _, testCase := range []struct {
+		endpoint      string
+		disableTLS    bool
+		expectedValue string
+		expectError   bool
+	}{
+		{"host:4318", false, "https://host:4318/v1/metrics", false},
+		{"host:4318", true, "http://host:4318/v1/metrics", false},
+		{"http://host:4318/", false, "http://host:4318/v1/metrics", false},
+		{"https://host/otlp/v1/metrics", true, "https://host/otlp/v1/metrics", false},
+
+		{"grpc://host:4317", false, "", true},
+		{"http://", false, "", true},
+	} {
+		t.Run(testCase.endpoint, func(t *testing.T) {
+			actualValue, err := composeHTTPExportURL(testCase.endpoint, testCase.disableTLS)
+			if testCase.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, testCase.expectedValue, actualValue)
+			}
+		})
+	}
+}
+
+type fakeGRPCReceiver struct {
+	pmetricotlp.UnimplementedGRPCServer
+	authorization chan []string
+}
+
+func (r *fakeGRPCReceiver) Export(ctx context.Context, _ pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.authorization <- md.Get(headerAuthorization)
+	if md.Get("x-custom")[0] != "v" {
+		return pmetricotlp.NewExportResponse(), status.Error(codes.InvalidArgument, "missing header")
+	}
+	return pmetricotlp.NewExportResponse(), nil
+}
+
+func TestGRPCMetricsExporter(t *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	receiver := &fakeGRPCReceiver{authorization: make(chan []string, 1)}
+	pmetricotlp.RegisterGRPCServer(server, receiver)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	exporter, err := newMetricsExporter(zap.NewNop(), &Config{
+		OTLPEndpoint: "http://" + listener.Addr().String(),
+		OTLPProtocol: otlpProtocolGRPC,
+		OTLPTimeout:  5 * time.Second,
+		OTLPHeaders:  []string{"X-Custom=v"},
+	})
+	require.NoError(t, err)
+	defer func() { _ = exporter.Close() }()
+
+	require.NoError(t, exporter.Export(context.Background(), pmetric.NewMetrics(), "Token my-token"))
+	assert.Equal(t, []string{"Token my-token"}, <-receiver.authorization)
+}
@@ -1,12 +1,19 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
 
 	"github.com/influxdata/influxdb-observability/common"
@@ -17,53 +24,150 @@ func traceIDToString(traceID model.TraceID) string {
 	return fmt.Sprintf("%016x%016x", traceID.High, traceID.Low)
 }
 
-func queryGetAllWhereTraceID(table string, traceIDs ...model.TraceID) string {
+// quoteIdentifier quotes a table or column name for InfluxDB SQL.
+// Embedded double quotes are escaped by doubling, per the SQL standard.
+func quoteIdentifier(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes a string literal for InfluxDB SQL.
+// Embedded single quotes are escaped by doubling, per the SQL standard.
+// Backslash is an escape character in string literals of some SQL dialects but not others,
+// so backslashes are written as chr(92), which means the same in either case.
+func quoteLiteral(literal string) string {
+	parts := strings.Split(literal, `\`)
+	for i, part := range parts {
+		parts[i] = `'` + strings.ReplaceAll(part, `'`, `''`) + `'`
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return `concat(` + strings.Join(parts, `, chr(92), `) + `)`
+}
+
+// timeRange bounds the time column of trace queries; a zero start or end is unbounded.
+type timeRange struct {
+	start, end time.Time
+}
+
+func (tr timeRange) predicates() []string {
+	var predicates []string
+	if !tr.start.IsZero() {
+		predicates = append(predicates, fmt.Sprintf(`%s >= to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), tr.start.UnixNano()))
+	}
+	if !tr.end.IsZero() {
+		predicates = append(predicates, fmt.Sprintf(`%s <= to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), tr.end.UnixNano()))
+	}
+	return predicates
+}
+
+func queryGetAllWhereTraceID(table string, tr timeRange, traceIDs ...model.TraceID) string {
 	if len(traceIDs) == 0 {
-		return fmt.Sprintf(`SELECT * FROM '%s' WHERE false`, table)
+		return fmt.Sprintf(`SELECT * FROM %s WHERE false`, quoteIdentifier(table))
 	}
-	traceIDStrings := make([]string, len(traceIDs))
+	traceIDLiterals := make([]string, len(traceIDs))
 	for i, traceID := range traceIDs {
-		traceIDStrings[i] = traceIDToString(traceID)
+		traceIDLiterals[i] = quoteLiteral(traceIDToString(traceID))
 	}
-	return fmt.Sprintf(`SELECT * FROM '%s' WHERE "%s" IN ('%s')`,
-		table, common.AttributeTraceID, strings.Join(traceIDStrings, `','`))
+	predicates := append([]string{
+		fmt.Sprintf(`%s IN (%s)`, quoteIdentifier(common.AttributeTraceID), strings.Join(traceIDLiterals, `,`)),
+	}, tr.predicates()...)
+	return fmt.Sprintf(`SELECT * FROM %s WHERE %s`, quoteIdentifier(table), strings.Join(predicates, " AND "))
 }
 
-func queryGetTraceSpans(tableSpans string, traceIDs ...model.TraceID) string {
-	return queryGetAllWhereTraceID(tableSpans, traceIDs...)
+// columnSpanRank is the rank of a span within its trace, by start time, in queryGetTraceSpans results.
+const columnSpanRank = "jaeger_span_rank"
+
+// queryGetTraceSpans selects the spans of traces.
+// If limit is positive, it selects the earliest limit+1 spans of each trace,
+// so that a caller keeping limit spans knows which traces are truncated.
+func queryGetTraceSpans(tableSpans string, tr timeRange, limit int, traceIDs ...model.TraceID) string {
+	query := queryGetAllWhereTraceID(tableSpans, tr, traceIDs...)
+	if limit <= 0 {
+		return query
+	}
+	rank := quoteIdentifier(columnSpanRank)
+	return fmt.Sprintf(`SELECT * FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s, %s) AS %s%s) WHERE %s <= %d`,
+		quoteIdentifier(common.AttributeTraceID), quoteIdentifier(common.AttributeTime), quoteIdentifier(common.AttributeSpanID),
+		rank, strings.TrimPrefix(query, `SELECT *`), rank, limit+1)
 }
 
-func queryGetTraceEvents(tableLogs string, traceIDs ...model.TraceID) string {
-	return queryGetAllWhereTraceID(tableLogs, traceIDs...)
+func queryGetTraceEvents(tableLogs string, tr timeRange, traceIDs ...model.TraceID) string {
+	return queryGetAllWhereTraceID(tableLogs, tr, traceIDs...)
 }
 
-func queryGetTraceLinks(tableSpanLinks string, traceIDs ...model.TraceID) string {
-	return queryGetAllWhereTraceID(tableSpanLinks, traceIDs...)
+func queryGetTraceLinks(tableSpanLinks string, tr timeRange, traceIDs ...model.TraceID) string {
+	return queryGetAllWhereTraceID(tableSpanLinks, tr, traceIDs...)
 }
 
 func queryGetServices() string {
-	return fmt.Sprintf(`SELECT "%s" FROM '%s' GROUP BY "%s"`,
-		semconv.AttributeServiceName, tableSpanMetricsCalls, semconv.AttributeServiceName)
+	return fmt.Sprintf(`SELECT %s FROM %s GROUP BY %s`,
+		quoteIdentifier(semconv.AttributeServiceName), quoteIdentifier(tableSpanMetricsCalls), quoteIdentifier(semconv.AttributeServiceName))
 }
 
 func queryGetOperations(serviceName string) string {
-	return fmt.Sprintf(`SELECT "%s", "%s" FROM '%s' WHERE "%s" = '%s' GROUP BY "%s", "%s"`,
-		common.AttributeSpanName, common.AttributeSpanKind, tableSpanMetricsCalls, semconv.AttributeServiceName, serviceName, common.AttributeSpanName, common.AttributeSpanKind)
+	return fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s = %s GROUP BY %s, %s`,
+		quoteIdentifier(common.AttributeSpanName), quoteIdentifier(common.AttributeSpanKind), quoteIdentifier(tableSpanMetricsCalls),
+		quoteIdentifier(semconv.AttributeServiceName), quoteLiteral(serviceName),
+		quoteIdentifier(common.AttributeSpanName), quoteIdentifier(common.AttributeSpanKind))
 }
 
 func queryGetDependencies(endTs time.Time, lookback time.Duration) string {
 	return fmt.Sprintf(`
-SELECT "%s", "%s", SUM("%s") AS "%s"
-FROM '%s'
-WHERE "%s" >= to_timestamp(%d) AND "%s" <= to_timestamp(%d)
-GROUP BY "%s", "%s"`,
-		columnServiceGraphClient, columnServiceGraphServer, columnServiceGraphCount, columnServiceGraphCount,
-		tableServiceGraphRequestCount,
-		common.AttributeTime, endTs.Add(-lookback).UnixNano(), common.AttributeTime, endTs.UnixNano(),
-		columnServiceGraphClient, columnServiceGraphServer)
+SELECT %s, %s, SUM(%s) AS %s
+FROM %s
+WHERE %s >= to_timestamp(%d) AND %s <= to_timestamp(%d)
+GROUP BY %s, %s`,
+		quoteIdentifier(columnServiceGraphClient), quoteIdentifier(columnServiceGraphServer), quoteIdentifier(columnServiceGraphCount), quoteIdentifier(columnServiceGraphCount),
+		quoteIdentifier(tableServiceGraphRequestCount),
+		quoteIdentifier(common.AttributeTime), endTs.Add(-lookback).UnixNano(), quoteIdentifier(common.AttributeTime), endTs.UnixNano(),
+		quoteIdentifier(columnServiceGraphClient), quoteIdentifier(columnServiceGraphServer))
+}
+
+func queryGetServicesFromSpans(tableSpans string, since time.Time) string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE %s >= to_timestamp(%d) GROUP BY %s`,
+		quoteIdentifier(semconv.AttributeServiceName), quoteIdentifier(tableSpans),
+		quoteIdentifier(common.AttributeTime), since.UnixNano(),
+		quoteIdentifier(semconv.AttributeServiceName))
+}
+
+func queryGetOperationsFromSpans(tableSpans, serviceName string, since time.Time) string {
+	return fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s = %s AND %s >= to_timestamp(%d) GROUP BY %s, %s`,
+		quoteIdentifier(common.AttributeSpanName), quoteIdentifier(common.AttributeSpanKind), quoteIdentifier(tableSpans),
+		quoteIdentifier(semconv.AttributeServiceName), quoteLiteral(serviceName),
+		quoteIdentifier(common.AttributeTime), since.UnixNano(),
+		quoteIdentifier(common.AttributeSpanName), quoteIdentifier(common.AttributeSpanKind))
+}
+
+// queryGetDependenciesFromSpans joins child spans to parent spans of other services,
+// with the same result columns as queryGetDependencies.
+func queryGetDependenciesFromSpans(tableSpans string, endTs time.Time, lookback time.Duration) string {
+	serviceName := quoteIdentifier(semconv.AttributeServiceName)
+	traceID, spanID, parentSpanID := quoteIdentifier(common.AttributeTraceID), quoteIdentifier(common.AttributeSpanID), quoteIdentifier(common.AttributeParentSpanID)
+	t := quoteIdentifier(common.AttributeTime)
+	start, end := endTs.Add(-lookback).UnixNano(), endTs.UnixNano()
+	return fmt.Sprintf(`
+SELECT parent.%s AS %s, child.%s AS %s, COUNT(*) AS %s
+FROM %s AS child JOIN %s AS parent ON child.%s = parent.%s AND child.%s = parent.%s
+WHERE child.%s >= to_timestamp(%d) AND child.%s <= to_timestamp(%d)
+AND parent.%s >= to_timestamp(%d) AND parent.%s <= to_timestamp(%d)
+AND parent.%s <> child.%s
+GROUP BY parent.%s, child.%s`,
+		serviceName, quoteIdentifier(columnServiceGraphClient), serviceName, quoteIdentifier(columnServiceGraphServer), quoteIdentifier(columnServiceGraphCount),
+		quoteIdentifier(tableSpans), quoteIdentifier(tableSpans), traceID, traceID, parentSpanID, spanID,
+		t, start, t, end,
+		t, start, t, end,
+		serviceName, serviceName,
+		serviceName, serviceName)
 }
 
-func queryFindTraceIDs(tableSpans string, tqp *spanstore.TraceQueryParameters) string {
+func queryGetColumns(table string) string {
+	return fmt.Sprintf(`SELECT column_name FROM information_schema.columns WHERE table_name = %s`, quoteLiteral(table))
+}
+
+// queryFindTraceIDs finds the most recent traces that match tqp.
+// Tags that are not columns, according to isColumn, are matched against the JSON attributes column.
+func queryFindTraceIDs(tableSpans string, tqp *spanstore.TraceQueryParameters, isColumn func(column string) bool) string {
 	tags := make(map[string]string, len(tqp.Tags)+2)
 	for k, v := range tqp.Tags {
 		tags[k] = v
@@ -74,31 +178,104 @@ func queryFindTraceIDs(tableSpans string, tqp *spanstore.TraceQueryParameters) s
 	if tqp.OperationName != "" {
 		tags[common.AttributeSpanName] = tqp.OperationName
 	}
+	tagKeys := make([]string, 0, len(tags))
+	for k := range tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
 
 	predicates := make([]string, 0, len(tags)+4)
-	for k, v := range tags {
-		predicates = append(predicates, fmt.Sprintf(`"%s" = '%s'`, k, v))
+	for _, k := range tagKeys {
+		predicates = append(predicates, tagPredicate(k, tags[k], isColumn))
 	}
 	if !tqp.StartTimeMin.IsZero() {
-		predicates = append(predicates, fmt.Sprintf(`"%s" >= to_timestamp(%d)`, common.AttributeTime, tqp.StartTimeMin.UnixNano()))
+		predicates = append(predicates, fmt.Sprintf(`%s >= to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), tqp.StartTimeMin.UnixNano()))
 	}
 	if !tqp.StartTimeMax.IsZero() {
-		predicates = append(predicates, fmt.Sprintf(`"%s" <= to_timestamp(%d)`, common.AttributeTime, tqp.StartTimeMax.UnixNano()))
+		predicates = append(predicates, fmt.Sprintf(`%s <= to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), tqp.StartTimeMax.UnixNano()))
 	}
 	if tqp.DurationMin > 0 {
 		predicates = append(predicates,
-			fmt.Sprintf(`"%s" >= %d`, common.AttributeDurationNano, tqp.DurationMin.Nanoseconds()))
+			fmt.Sprintf(`%s >= %d`, quoteIdentifier(common.AttributeDurationNano), tqp.DurationMin.Nanoseconds()))
 	}
 	if tqp.DurationMax > 0 {
 		predicates = append(predicates,
-			fmt.Sprintf(`"%s" <= %d`, common.AttributeDurationNano, tqp.DurationMax.Nanoseconds()))
+			fmt.Sprintf(`%s <= %d`, quoteIdentifier(common.AttributeDurationNano), tqp.DurationMax.Nanoseconds()))
 	}
 
-	query := fmt.Sprintf(`SELECT "%s", MAX("%s") AS t FROM '%s'`, common.AttributeTraceID, common.AttributeTime, tableSpans)
+	query := fmt.Sprintf(`SELECT %s, MAX(%s) AS t FROM %s`,
+		quoteIdentifier(common.AttributeTraceID), quoteIdentifier(common.AttributeTime), quoteIdentifier(tableSpans))
 	if len(predicates) > 0 {
 		query += fmt.Sprintf(" WHERE %s", strings.Join(predicates, " AND "))
 	}
-	query += fmt.Sprintf(` GROUP BY "%s" ORDER BY t DESC LIMIT %d`, common.AttributeTraceID, tqp.NumTraces)
+	query += fmt.Sprintf(` GROUP BY %s ORDER BY t DESC LIMIT %d`, quoteIdentifier(common.AttributeTraceID), tqp.NumTraces)
 
 	return query
 }
+
+// querySpanMetrics selects the raw points of a spanmetrics connector table,
+// in the time range (start, end], ordered by time.
+func querySpanMetrics(table string, bqp *metricsstore.BaseQueryParameters, start, end time.Time) string {
+	predicates := make([]string, 0, 4)
+	predicates = append(predicates, fmt.Sprintf(`%s IN (%s)`, quoteIdentifier(semconv.AttributeServiceName), quoteLiterals(bqp.ServiceNames)))
+	if len(bqp.SpanKinds) > 0 {
+		predicates = append(predicates, fmt.Sprintf(`%s IN (%s)`, quoteIdentifier(common.AttributeSpanKind), quoteLiterals(bqp.SpanKinds)))
+	}
+	predicates = append(predicates,
+		fmt.Sprintf(`%s > to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), start.UnixNano()),
+		fmt.Sprintf(`%s <= to_timestamp(%d)`, quoteIdentifier(common.AttributeTime), end.UnixNano()))
+
+	return fmt.Sprintf(`SELECT * FROM %s WHERE %s ORDER BY %s`,
+		quoteIdentifier(table), strings.Join(predicates, " AND "), quoteIdentifier(common.AttributeTime))
+}
+
+func quoteLiterals(literals []string) string {
+	quoted := make([]string, len(literals))
+	for i, literal := range literals {
+		quoted[i] = quoteLiteral(literal)
+	}
+	return strings.Join(quoted, `,`)
+}
+
+// tagPredicate matches a Jaeger tag to a span.
+// Jaeger conventions error=true and span.kind=server are mapped to the OpenTelemetry status code and span kind,
+// if the table has those columns; otherwise, the tag is matched like any other.
+func tagPredicate(k, v string, isColumn func(column string) bool) string {
+	switch k {
+	case string(ext.Error):
+		if !isColumn(semconv.OtelStatusCode) {
+			break
+		}
+		statusCode, statusCodeError := quoteIdentifier(semconv.OtelStatusCode), quoteLiteral(ptrace.StatusCodeError.String())
+		switch v {
+		case "true":
+			return fmt.Sprintf(`%s = %s`, statusCode, statusCodeError)
+		case "false":
+			return fmt.Sprintf(`(%s IS NULL OR %s <> %s)`, statusCode, statusCode, statusCodeError)
+		}
+	case common.AttributeSpanKind:
+		if !isColumn(common.AttributeSpanKind) {
+			break
+		}
+		if spanKind := spanKindToOtel(strings.ToLower(v)); spanKind != ptrace.SpanKindUnspecified {
+			return fmt.Sprintf(`%s = %s`, quoteIdentifier(common.AttributeSpanKind), quoteLiteral(spanKind.String()))
+		}
+	}
+	if isColumn(k) {
+		return fmt.Sprintf(`%s = %s`, quoteIdentifier(k), quoteLiteral(v))
+	}
+	return fmt.Sprintf(`%s ~ %s`, quoteIdentifier(common.AttributeAttributes), quoteLiteral(attributeRegexp(k, v)))
+}
+
+// attributeRegexp matches a top-level key and value in the JSON attributes column, as encoded by otel2influx.
+// Jaeger tag values are strings, so values that are valid JSON numbers or booleans also match unquoted.
+func attributeRegexp(k, v string) string {
+	// json.Marshal does not fail for strings, and escapes them the same way as the otel2influx encoding
+	key, _ := json.Marshal(k)
+	value, _ := json.Marshal(v)
+	values := []string{regexp.QuoteMeta(string(value))}
+	if _, err := strconv.ParseFloat(v, 64); (err == nil && json.Valid([]byte(v))) || v == "true" || v == "false" {
+		values = append(values, regexp.QuoteMeta(v))
+	}
+	return fmt.Sprintf(`(?:^\{|,)%s:(?:%s)[,}]`, regexp.QuoteMeta(string(key)), strings.Join(values, "|"))
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/metricsstore"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sqlToken struct {
+	kind  byte // '"' identifier, '\'' literal, 0 other
+	value string
+}
+
+// tokenizeSQL splits a query into quoted identifiers, quoted literals, and other runs of non-space characters,
+// following standard SQL quoting, where a doubled quote character is an escaped quote.
+// A literal must not contain a backslash, whose meaning depends on the SQL dialect;
+// the concat(..., chr(92), ...) expressions written by quoteLiteral are read as one literal.
+func tokenizeSQL(t *testing.T, query string) []sqlToken {
+	t.Helper()
+	const concatPrefix, backslash = `concat('`, `, chr(92), `
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '"':
+			var value string
+			value, i = scanQuoted(t, query, i)
+			tokens = append(tokens, sqlToken{kind: c, value: value})
+		case c == '\'':
+			var value string
+			value, i = scanQuoted(t, query, i)
+			require.NotContains(t, value, `\`, "backslash in literal in query %s", query)
+			tokens = append(tokens, sqlToken{kind: c, value: value})
+		case strings.HasPrefix(query[i:], concatPrefix):
+			var value strings.Builder
+			i += len(concatPrefix) - 1
+			for {
+				var part string
+				part, i = scanQuoted(t, query, i)
+				require.NotContains(t, part, `\`, "backslash in literal in query %s", query)
+				value.WriteString(part)
+				if !strings.HasPrefix(query[i:], backslash) {
+					break
+				}
+				value.WriteByte('\\')
+				i += len(backslash)
+			}
+			require.True(t, strings.HasPrefix(query[i:], ")"), "unterminated concat in query %s", query)
+			i++
+			tokens = append(tokens, sqlToken{kind: '\'', value: value.String()})
+		case c == ' ' || c == '\n' || c == '\t':
+			i++
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \n\t\"'", rune(query[i])) && !strings.HasPrefix(query[i:], concatPrefix) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{value: query[start:i]})
+		}
+	}
+	return tokens
+}
+
+// scanQuoted returns the unescaped value of the quoted string at query[i], and the index after it.
+func scanQuoted(t *testing.T, query string, i int) (string, int) {
+	t.Helper()
+	c := query[i]
+	var value strings.Builder
+	i++
+	for {
+		require.Less(t, i, len(query), "unterminated quote in query %s", query)
+		if query[i] == c {
+			if i+1 < len(query) && query[i+1] == c {
+				value.WriteByte(c)
+				i += 2
+				continue
+			}
+			return value.String(), i + 1
+		}
+		value.WriteByte(query[i])
+		i++
+	}
+}
+
+var hostileInputs = []string{
+	`x' OR '1'='1`,
+	`'; DROP TABLE spans; --`,
+	`a" = 'b' OR "c`,
+	`back\slash\'`,
+	`\' OR '1'='1' --`,
+	`trailing\`,
+	`''`,
+	`"`,
+	`ünïcödé 'quoted'`,
+}
+
+func TestQuoting(t *testing.T) {
+	assert.Equal(t, `'it''s'`, quoteLiteral(`it's`))
+	assert.Equal(t, `concat('', chr(92), 'n''', chr(92), '')`, quoteLiteral(`\n'\`))
+
+	for _, input := range hostileInputs {
+		t.Run(input, func(t *testing.T) {
+			assert.Equal(t, []sqlToken{{kind: '\'', value: input}}, tokenizeSQL(t, quoteLiteral(input)))
+			assert.Equal(t, []sqlToken{{kind: '"', value: input}}, tokenizeSQL(t, quoteIdentifier(input)))
+		})
+	}
+}
+
+func TestQueryGetOperations(t *testing.T) {
+	assert.Equal(t,
+		`SELECT "span.name", "span.kind" FROM "calls__sum" WHERE "service.name" = 'my-service' GROUP BY "span.name", "span.kind"`,
+		queryGetOperations("my-service"))
+
+	for _, serviceName := range hostileInputs {
+		t.Run(serviceName, func(t *testing.T) {
+			tokens := tokenizeSQL(t, queryGetOperations(serviceName))
+			require.Len(t, tokens, 15)
+			assert.Equal(t, sqlToken{kind: '"', value: "service.name"}, tokens[7])
+			assert.Equal(t, sqlToken{value: "="}, tokens[8])
+			assert.Equal(t, sqlToken{kind: '\'', value: serviceName}, tokens[9])
+			assert.Equal(t, sqlToken{value: "GROUP"}, tokens[10])
+		})
+	}
+}
+
+func allColumns(string) bool { return true }
+
+func TestQueryFindTraceIDs(t *testing.T) {
+	tqp := &spanstore.TraceQueryParameters{
+		ServiceName:   "my-service",
+		OperationName: "GET /",
+		Tags:          map[string]string{"http.method": "GET"},
+		StartTimeMin:  time.Unix(1, 0),
+		DurationMin:   time.Millisecond,
+		NumTraces:     20,
+	}
+	assert.Equal(t,
+		`SELECT "trace_id", MAX("time") AS t FROM "spans" WHERE "http.method" = 'GET' AND "service.name" = 'my-service' AND "span.name" = 'GET /' AND "time" >= to_timestamp(1000000000) AND "duration_nano" >= 1000000 GROUP BY "trace_id" ORDER BY t DESC LIMIT 20`,
+		queryFindTraceIDs(tableSpans, tqp, allColumns))
+
+	for _, input := range hostileInputs {
+		t.Run(input, func(t *testing.T) {
+			tqp := &spanstore.TraceQueryParameters{
+				ServiceName:   input,
+				OperationName: input,
+				Tags:          map[string]string{input: input},
+				NumTraces:     20,
+			}
+			tokens := tokenizeSQL(t, queryFindTraceIDs(tableSpans, tqp, allColumns))
+			// SELECT "trace_id" , MAX( "time" ) AS t FROM "spans" WHERE
+			require.Greater(t, len(tokens), 11)
+			assert.Equal(t, sqlToken{value: "WHERE"}, tokens[10])
+			predicates := tokens[11:]
+			// 3 predicates of 3 tokens, joined by AND, then GROUP BY "trace_id" ORDER BY t DESC LIMIT 20
+			require.Len(t, predicates, 3*3+2+9)
+			var predicateValues []sqlToken
+			for i := 0; i < 3; i++ {
+				identifier, operator, literal := predicates[i*4], predicates[i*4+1], predicates[i*4+2]
+				assert.Equal(t, byte('"'), identifier.kind)
+				assert.Equal(t, sqlToken{value: "="}, operator)
+				assert.Equal(t, byte('\''), literal.kind)
+				predicateValues = append(predicateValues, literal)
+				if i < 2 {
+					assert.Equal(t, sqlToken{value: "AND"}, predicates[i*4+3])
+				}
+			}
+			for _, literal := range predicateValues {
+				assert.Equal(t, input, literal.value)
+			}
+			assert.Equal(t, sqlToken{value: "GROUP"}, predicates[11])
+		})
+	}
+}
+
+func TestQueryGetAllWhereTraceID(t *testing.T) {
+	assert.Equal(t, `SELECT * FROM "span-links" WHERE false`, queryGetTraceLinks(tableSpanLinks, timeRange{}))
+	assert.Equal(t,
+		`SELECT * FROM "spans" WHERE "trace_id" IN ('00000000000000010000000000000002','00000000000000000000000000000003')`,
+		queryGetTraceSpans(tableSpans, timeRange{}, 0, model.NewTraceID(1, 2), model.NewTraceID(0, 3)))
+	assert.Equal(t,
+		`SELECT * FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY "trace_id" ORDER BY "time", "span_id") AS "jaeger_span_rank" FROM "spans" WHERE "trace_id" IN ('00000000000000010000000000000002')) WHERE "jaeger_span_rank" <= 101`,
+		queryGetTraceSpans(tableSpans, timeRange{}, 100, model.NewTraceID(1, 2)))
+	assert.Equal(t,
+		`SELECT * FROM "logs" WHERE "trace_id" IN ('00000000000000010000000000000002') AND "time" >= to_timestamp(1000000000)`,
+		queryGetTraceEvents(tableLogs, timeRange{start: time.Unix(1, 0)}, model.NewTraceID(1, 2)))
+	assert.Equal(t,
+		`SELECT * FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY "trace_id" ORDER BY "time", "span_id") AS "jaeger_span_rank" FROM "spans" WHERE "trace_id" IN ('00000000000000010000000000000002') AND "time" >= to_timestamp(1000000000) AND "time" <= to_timestamp(2000000000)) WHERE "jaeger_span_rank" <= 101`,
+		queryGetTraceSpans(tableSpans, timeRange{start: time.Unix(1, 0), end: time.Unix(2, 0)}, 100, model.NewTraceID(1, 2)))
+}
+
+func TestQuerySpanMetrics(t *testing.T) {
+	bqp := &metricsstore.BaseQueryParameters{
+		ServiceNames: []string{"my-service", `x' OR '1'='1`},
+		SpanKinds:    []string{"SPAN_KIND_SERVER"},
+	}
+	assert.Equal(t,
+		`SELECT * FROM "calls__sum" WHERE "service.name" IN ('my-service','x'' OR ''1''=''1') AND "span.kind" IN ('SPAN_KIND_SERVER') AND "time" > to_timestamp(1000000000) AND "time" <= to_timestamp(2000000000) ORDER BY "time"`,
+		querySpanMetrics(tableSpanMetricsCalls, bqp, time.Unix(1, 0), time.Unix(2, 0)))
+
+	bqp.SpanKinds = nil
+	assert.Equal(t,
+		`SELECT * FROM "calls__sum" WHERE "service.name" IN ('my-service','x'' OR ''1''=''1') AND "time" > to_timestamp(1000000000) AND "time" <= to_timestamp(2000000000) ORDER BY "time"`,
+		querySpanMetrics(tableSpanMetricsCalls, bqp, time.Unix(1, 0), time.Unix(2, 0)))
+}
+
+func TestQueryMetadataFromSpans(t *testing.T) {
+	assert.Equal(t,
+		`SELECT "service.name" FROM "spans" WHERE "time" >= to_timestamp(1000000000) GROUP BY "service.name"`,
+		queryGetServicesFromSpans(tableSpans, time.Unix(1, 0)))
+	assert.Equal(t,
+		`SELECT "span.name", "span.kind" FROM "spans" WHERE "service.name" = 'my''service' AND "time" >= to_timestamp(1000000000) GROUP BY "span.name", "span.kind"`,
+		queryGetOperationsFromSpans(tableSpans, "my'service", time.Unix(1, 0)))
+	assert.Equal(t, `
+SELECT parent."service.name" AS "client", child."service.name" AS "server", COUNT(*) AS "value_cumulative_monotonic_int"
+FROM "spans" AS child JOIN "spans" AS parent ON child."trace_id" = parent."trace_id" AND child."parent_span_id" = parent."span_id"
+WHERE child."time" >= to_timestamp(1000000000) AND child."time" <= to_timestamp(3000000000)
+AND parent."time" >= to_timestamp(1000000000) AND parent."time" <= to_timestamp(3000000000)
+AND parent."service.name" <> child."service.name"
+GROUP BY parent."service.name", child."service.name"`,
+		queryGetDependenciesFromSpans(tableSpans, time.Unix(3, 0), 2*time.Second))
+}
+
+func TestTagPredicate(t *testing.T) {
+	isColumn := func(column string) bool {
+		return column == "service.name" || column == "http.method" || column == "otel.status_code" || column == "span.kind"
+	}
+	for _, testCase := range []struct {
+		k, v     string
+		expected string
+	}{
+		{"http.method", "GET", `"http.method" = 'GET'`},
+		{"error", "true", `"otel.status_code" = 'Error'`},
+		{"error", "false", `("otel.status_code" IS NULL OR "otel.status_code" <> 'Error')`},
+		{"span.kind", "server", `"span.kind" = 'Server'`},
+		{"span.kind", "Client", `"span.kind" = 'Client'`},
+		{"http.status_code", "500", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"http\.status_code":(?:"500"|500)[,}]`)},
+		{"http.route", "/users/{id}", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"http\.route":(?:"/users/\{id\}")[,}]`)},
+		{"k", "it's", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"k":(?:"it's")[,}]`)},
+	} {
+		assert.Equal(t, testCase.expected, tagPredicate(testCase.k, testCase.v, isColumn), "%s=%s", testCase.k, testCase.v)
+	}
+
+	// Without the status code and span kind columns, the tags are matched in the attributes column.
+	noColumns := func(string) bool { return false }
+	for _, testCase := range []struct {
+		k, v     string
+		expected string
+	}{
+		{"error", "true", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"error":(?:"true"|true)[,}]`)},
+		{"error", "false", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"error":(?:"false"|false)[,}]`)},
+		{"span.kind", "server", `"attributes" ~ ` + quoteLiteral(`(?:^\{|,)"span\.kind":(?:"server")[,}]`)},
+	} {
+		assert.Equal(t, testCase.expected, tagPredicate(testCase.k, testCase.v, noColumns), "%s=%s", testCase.k, testCase.v)
+	}
+}
+
+func TestAttributeRegexp(t *testing.T) {
+	attributes, err := json.Marshal(map[string]interface{}{
+		"http.status_code": int64(500),
+		"http.target":      "/a?b=c&d=<e>",
+		"retry":            true,
+		"ratio":            0.25,
+		"xhttp.method":     "GET",
+		"nested":           map[string]interface{}{"http.method": "POST"},
+	})
+	require.NoError(t, err)
+
+	for _, testCase := range []struct {
+		k, v     string
+		expected bool
+	}{
+		{"http.status_code", "500", true},
+		{"http.status_code", "50", false},
+		{"http.status_code", "5000", false},
+		{"http.target", "/a?b=c&d=<e>", true},
+		{"http.target", "/a", false},
+		{"retry", "true", true},
+		{"retry", "false", false},
+		{"ratio", "0.25", true},
+		{"http.method", "GET", false},
+		{"http.method", "POST", false},
+		{"missing", "x", false},
+	} {
+		re := regexp.MustCompile(attributeRegexp(testCase.k, testCase.v))
+		assert.Equal(t, testCase.expected, re.Match(attributes), "%s=%s in %s", testCase.k, testCase.v, attributes)
+	}
+}
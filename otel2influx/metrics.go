@@ -3,6 +3,8 @@ package otel2influx
 import (
 	"context"
 	"fmt"
+	"math"
+	"strings"
 
 	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/pdata/pcommon"
@@ -15,6 +17,16 @@ type OtelMetricsToLineProtocolConfig struct {
 	Logger common.Logger
 	Writer InfluxWriter
 	Schema common.MetricsSchema
+	// AddNameSuffixes appends unit suffixes, such as _seconds or _bytes, and the _total suffix of monotonic sums
+	// to metric names written with the Telegraf Prometheus schemas, per the OpenTelemetry-Prometheus compatibility specification.
+	// Names are first normalized, replacing characters such as '.' with '_'.
+	// Names that already end with the suffix are not changed.
+	AddNameSuffixes bool
+	// HistogramQuantiles are quantiles, between 0 and 1, estimated from histogram buckets
+	// and written as additional fields of histograms with the Telegraf Prometheus schemas.
+	// For example, quantile 0.99 is written as field "p99" (schema v1) or "<metric>_p99" (schema v2).
+	// influx2otel ignores these fields when it converts the histograms back.
+	HistogramQuantiles []float64
 }
 
 func DefaultOtelMetricsToLineProtocolConfig() *OtelMetricsToLineProtocolConfig {
@@ -35,15 +47,25 @@ type OtelMetricsToLineProtocol struct {
 }
 
 func NewOtelMetricsToLineProtocol(config *OtelMetricsToLineProtocolConfig) (*OtelMetricsToLineProtocol, error) {
+	for _, q := range config.HistogramQuantiles {
+		if q < 0 || q > 1 || math.IsNaN(q) {
+			return nil, fmt.Errorf("histogram quantile %v is not between 0 and 1", q)
+		}
+	}
+
 	var mw metricWriter
 	switch config.Schema {
 	case common.MetricsSchemaTelegrafPrometheusV1:
 		mw = &metricWriterTelegrafPrometheusV1{
-			logger: config.Logger,
+			logger:             config.Logger,
+			addNameSuffixes:    config.AddNameSuffixes,
+			histogramQuantiles: config.HistogramQuantiles,
 		}
 	case common.MetricsSchemaTelegrafPrometheusV2:
 		mw = &metricWriterTelegrafPrometheusV2{
-			logger: config.Logger,
+			logger:             config.Logger,
+			addNameSuffixes:    config.AddNameSuffixes,
+			histogramQuantiles: config.HistogramQuantiles,
 		}
 	case common.MetricsSchemaOtelV1:
 		mw = &metricWriterOtelV1{
@@ -80,3 +102,96 @@ type basicDataPoint interface {
 	StartTimestamp() pcommon.Timestamp
 	Attributes() pcommon.Map
 }
+
+// prometheusMetricName returns the metric name with unit and _total suffixes,
+// as a Prometheus exporter would name the metric.
+func prometheusMetricName(metric pmetric.Metric) string {
+	name := normalizePrometheusName(metric.Name())
+	isCounter := metric.Type() == pmetric.MetricTypeSum && metric.Sum().IsMonotonic()
+	if isCounter {
+		name = strings.TrimSuffix(name, common.MetricCounterSuffix)
+	}
+
+	unitSuffix := common.PrometheusUnitSuffix(metric.Unit())
+	if unitSuffix != "" {
+		unitSuffix = "_" + unitSuffix
+	} else if metric.Unit() == "1" && metric.Type() == pmetric.MetricTypeGauge {
+		unitSuffix = common.MetricRatioSuffix
+	}
+	if unitSuffix != "" && !strings.HasSuffix(name, unitSuffix) {
+		name += unitSuffix
+	}
+
+	if isCounter {
+		name += common.MetricCounterSuffix
+	}
+	return name
+}
+
+// normalizePrometheusName replaces characters that are invalid in Prometheus metric names, such as '.', with '_',
+// collapses consecutive '_', and prefixes a leading digit with '_',
+// per the OpenTelemetry-Prometheus compatibility specification.
+func normalizePrometheusName(name string) string {
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	var previous rune
+	for i, r := range name {
+		isDigit := r >= '0' && r <= '9'
+		if !isDigit && r != ':' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			r = '_'
+		}
+		if i == 0 && isDigit {
+			sb.WriteByte('_')
+		} else if r == '_' && previous == '_' {
+			continue
+		}
+		sb.WriteRune(r)
+		previous = r
+	}
+	return sb.String()
+}
+
+// histogramQuantile estimates quantile q of a histogram data point by linear interpolation within
+// the bucket containing the quantile, as the Prometheus histogram_quantile function does.
+// The lower bound of the first bucket is min if present, otherwise 0;
+// the upper bound of the +Inf bucket is max if present, otherwise the highest explicit bound is returned.
+func histogramQuantile(dataPoint pmetric.HistogramDataPoint, q float64) (float64, bool) {
+	bucketCounts, explicitBounds := dataPoint.BucketCounts(), dataPoint.ExplicitBounds()
+	var total uint64
+	for i := 0; i < bucketCounts.Len(); i++ {
+		total += bucketCounts.At(i)
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	rank := q * float64(total)
+	var cumulative uint64
+	for i := 0; i < bucketCounts.Len(); i++ {
+		bucketCount := bucketCounts.At(i)
+		if bucketCount == 0 || float64(cumulative+bucketCount) < rank {
+			cumulative += bucketCount
+			continue
+		}
+
+		var lower, upper float64
+		if i < explicitBounds.Len() {
+			upper = explicitBounds.At(i)
+		} else if dataPoint.HasMax() {
+			upper = dataPoint.Max()
+		} else if explicitBounds.Len() > 0 {
+			return explicitBounds.At(explicitBounds.Len() - 1), true
+		} else {
+			return 0, false
+		}
+		if i > 0 {
+			lower = explicitBounds.At(i - 1)
+		} else if dataPoint.HasMin() {
+			lower = dataPoint.Min()
+		} else if upper <= 0 {
+			return upper, true
+		}
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(bucketCount), true
+	}
+	return 0, false
+}
@@ -445,3 +445,91 @@ func TestWriteMetric_v1_summary(t *testing.T) {
 
 	assert.Equal(t, expected, w.points)
 }
+
+func TestWriteMetric_v1_addNameSuffixes(t *testing.T) {
+	w := new(MockInfluxWriter)
+	cfg := otel2influx.DefaultOtelMetricsToLineProtocolConfig()
+	cfg.Writer = w
+	cfg.Schema = common.MetricsSchemaTelegrafPrometheusV1
+	cfg.AddNameSuffixes = true
+	c, err := otel2influx.NewOtelMetricsToLineProtocol(cfg)
+	require.NoError(t, err)
+
+	metrics := pmetric.NewMetrics()
+	isMetrics := metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	m := isMetrics.Metrics().AppendEmpty()
+	m.SetName("process.cpu.time")
+	m.SetUnit("s")
+	m.SetEmptySum()
+	m.Sum().SetIsMonotonic(true)
+	m.Sum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.SetTimestamp(timestamp)
+	dp.SetDoubleValue(12.5)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("system.cpu.utilization")
+	m.SetUnit("1")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(timestamp)
+	dp.SetDoubleValue(0.5)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("cache_age_seconds")
+	m.SetUnit("s")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(timestamp)
+	dp.SetDoubleValue(23.9)
+	m = isMetrics.Metrics().AppendEmpty()
+	m.SetName("2xx..responses")
+	m.SetEmptyGauge()
+	dp = m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(timestamp)
+	dp.SetDoubleValue(3)
+
+	err = c.WriteMetrics(context.Background(), metrics)
+	require.NoError(t, err)
+
+	require.Len(t, w.points, 4)
+	assert.Equal(t, "process_cpu_time_seconds_total", w.points[0].measurement)
+	assert.Equal(t, "system_cpu_utilization_ratio", w.points[1].measurement)
+	assert.Equal(t, "cache_age_seconds", w.points[2].measurement)
+	assert.Equal(t, "_2xx_responses", w.points[3].measurement)
+}
+
+func TestWriteMetric_v1_histogramQuantiles(t *testing.T) {
+	w := new(MockInfluxWriter)
+	cfg := otel2influx.DefaultOtelMetricsToLineProtocolConfig()
+	cfg.Writer = w
+	cfg.Schema = common.MetricsSchemaTelegrafPrometheusV1
+	cfg.HistogramQuantiles = []float64{0.5, 0.9, 0.999}
+	c, err := otel2influx.NewOtelMetricsToLineProtocol(cfg)
+	require.NoError(t, err)
+
+	metrics := pmetric.NewMetrics()
+	m := metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.SetTimestamp(timestamp)
+	dp.SetCount(100)
+	dp.SetSum(30)
+	dp.BucketCounts().FromRaw([]uint64{40, 40, 20})
+	dp.ExplicitBounds().FromRaw([]float64{0.1, 0.5})
+
+	err = c.WriteMetrics(context.Background(), metrics)
+	require.NoError(t, err)
+
+	require.Len(t, w.points, 1)
+	fields := w.points[0].fields
+	assert.InDelta(t, 0.2, fields["p50"], 1e-9)
+	// the quantile falls in the +Inf bucket, and max is unknown
+	assert.Equal(t, 0.5, fields["p90"])
+	assert.Equal(t, 0.5, fields["p99.9"])
+	assert.Equal(t, float64(100), fields["count"])
+
+	cfg.HistogramQuantiles = []float64{1.5}
+	_, err = otel2influx.NewOtelMetricsToLineProtocol(cfg)
+	assert.Error(t, err)
+}
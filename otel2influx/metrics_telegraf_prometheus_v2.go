@@ -15,23 +15,29 @@ import (
 )
 
 type metricWriterTelegrafPrometheusV2 struct {
-	logger common.Logger
+	logger             common.Logger
+	addNameSuffixes    bool
+	histogramQuantiles []float64
 }
 
 func (c *metricWriterTelegrafPrometheusV2) enqueueMetric(ctx context.Context, resource pcommon.Resource, instrumentationScope pcommon.InstrumentationScope, metric pmetric.Metric, batch InfluxWriterBatch) error {
-	// Ignore metric.Description() and metric.Unit() .
+	// Ignore metric.Description(); metric.Unit() is used only for name suffixes.
+	name := metric.Name()
+	if c.addNameSuffixes {
+		name = prometheusMetricName(metric)
+	}
 	switch metric.Type() {
 	case pmetric.MetricTypeGauge:
-		return c.enqueueGauge(ctx, resource, instrumentationScope, metric.Name(), metric.Gauge(), batch)
+		return c.enqueueGauge(ctx, resource, instrumentationScope, name, metric.Gauge(), batch)
 	case pmetric.MetricTypeSum:
 		if metric.Sum().IsMonotonic() && metric.Sum().AggregationTemporality() == pmetric.AggregationTemporalityCumulative {
-			return c.enqueueCounterFromSum(ctx, resource, instrumentationScope, metric.Name(), metric.Sum(), batch)
+			return c.enqueueCounterFromSum(ctx, resource, instrumentationScope, name, metric.Sum(), batch)
 		}
-		return c.enqueueGaugeFromSum(ctx, resource, instrumentationScope, metric.Name(), metric.Sum(), batch)
+		return c.enqueueGaugeFromSum(ctx, resource, instrumentationScope, name, metric.Sum(), batch)
 	case pmetric.MetricTypeHistogram:
-		return c.enqueueHistogram(ctx, resource, instrumentationScope, metric.Name(), metric.Histogram(), batch)
+		return c.enqueueHistogram(ctx, resource, instrumentationScope, name, metric.Histogram(), batch)
 	case pmetric.MetricTypeSummary:
-		return c.enqueueSummary(ctx, resource, instrumentationScope, metric.Name(), metric.Summary(), batch)
+		return c.enqueueSummary(ctx, resource, instrumentationScope, name, metric.Summary(), batch)
 	case pmetric.MetricTypeEmpty:
 		return nil
 	default:
@@ -187,6 +193,11 @@ func (c *metricWriterTelegrafPrometheusV2) enqueueHistogram(ctx context.Context,
 		if dataPoint.HasMax() {
 			fields[measurement+common.MetricHistogramMaxSuffix] = dataPoint.Max()
 		}
+		for _, q := range c.histogramQuantiles {
+			if value, ok := histogramQuantile(dataPoint, q); ok {
+				fields[measurement+"_"+common.HistogramQuantileFieldKey(q)] = value
+			}
+		}
 		if err = batch.EnqueuePoint(ctx, common.MeasurementPrometheus, tags, fields, ts, common.InfluxMetricValueTypeHistogram); err != nil {
 			return fmt.Errorf("failed to write point for histogram: %w", err)
 		}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/influxdata/influxdb-observability/common"
+	"github.com/influxdata/influxdb-observability/influx2otel"
+	"github.com/influxdata/influxdb-observability/otel2influx"
+)
+
+// untypedInfluxWriter passes points written by otel2influx to an influx2otel batch,
+// dropping the metric value type as storing the points in InfluxDB would.
+type untypedInfluxWriter struct {
+	batch *influx2otel.MetricsBatch
+}
+
+func (w *untypedInfluxWriter) NewBatch() otel2influx.InfluxWriterBatch {
+	return w
+}
+
+func (w *untypedInfluxWriter) EnqueuePoint(_ context.Context, measurement string, tags map[string]string, fields map[string]interface{}, ts time.Time, _ common.InfluxMetricValueType) error {
+	return w.batch.AddPoint(measurement, tags, fields, ts, common.InfluxMetricValueTypeUntyped)
+}
+
+func (w *untypedInfluxWriter) WriteBatch(context.Context) error {
+	return nil
+}
+
+func TestRoundTrip_histogramQuantiles(t *testing.T) {
+	expect := pmetric.NewMetrics()
+	m := expect.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("http_request_duration_seconds")
+	m.SetEmptyHistogram()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	dp := m.Histogram().DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("method", "post")
+	dp.SetTimestamp(pcommon.Timestamp(1622848686000000000))
+	dp.SetCount(144320)
+	dp.SetSum(53423)
+	dp.ExplicitBounds().FromRaw([]float64{0.05, 0.1, 0.2, 0.5, 1})
+	dp.BucketCounts().FromRaw([]uint64{24054, 9390, 66948, 28997, 4599, 10332})
+
+	for _, schema := range []common.MetricsSchema{common.MetricsSchemaTelegrafPrometheusV1, common.MetricsSchemaTelegrafPrometheusV2} {
+		for _, distributions := range []influx2otel.DistributionConversion{influx2otel.DistributionsAsHistogram, influx2otel.DistributionsAsSummary} {
+			if schema == common.MetricsSchemaTelegrafPrometheusV1 && distributions == influx2otel.DistributionsAsSummary {
+				// Schema v1 histograms and summaries are indistinguishable without type information.
+				continue
+			}
+			t.Run(schema.String()+"/"+distributions.String(), func(t *testing.T) {
+				decoderConfig := influx2otel.DefaultLineProtocolToOtelMetricsConfig()
+				decoderConfig.AmbiguousDistributions = distributions
+				decoder, err := influx2otel.NewLineProtocolToOtelMetricsWithConfig(decoderConfig)
+				require.NoError(t, err)
+				w := &untypedInfluxWriter{batch: decoder.NewBatch()}
+
+				encoderConfig := otel2influx.DefaultOtelMetricsToLineProtocolConfig()
+				encoderConfig.Writer = w
+				encoderConfig.Schema = schema
+				encoderConfig.HistogramQuantiles = []float64{0.5, 0.9, 0.99}
+				encoder, err := otel2influx.NewOtelMetricsToLineProtocol(encoderConfig)
+				require.NoError(t, err)
+
+				clone := pmetric.NewMetrics()
+				expect.CopyTo(clone)
+				require.NoError(t, encoder.WriteMetrics(context.Background(), clone))
+
+				assertMetricsEqual(t, expect, w.batch.GetMetrics())
+			})
+		}
+	}
+}